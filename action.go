@@ -6,6 +6,7 @@ package holochain
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +14,11 @@ import (
 	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"time"
 )
@@ -90,6 +94,7 @@ var ErrNotValidForDNAType error = errors.New("Invalid action for DNA type")
 var ErrNotValidForAgentType error = errors.New("Invalid action for Agent type")
 var ErrNotValidForKeyType error = errors.New("Invalid action for Key type")
 var ErrNilEntryInvalid error = errors.New("nil entry invalid")
+var ErrEntryTooLarge error = errors.New("entry too large")
 
 func prepareSources(sources []peer.ID) (srcs []string) {
 	srcs = make([]string, 0)
@@ -114,6 +119,14 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 		return
 	}
 
+	// headers signed with a key after its revocation aren't valid
+	if header := actionHeader(a); header != nil {
+		_, err = h.dht.checkKeyRevocation(header, sources)
+		if err != nil {
+			return
+		}
+	}
+
 	// run the action's system level validations
 	err = a.SysValidation(h, def, pkg, sources)
 	if err != nil {
@@ -131,10 +144,12 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 
 		// run the action's app level validations
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		var release func()
+		n, _, release, err = h.GetRibosome(z.Name)
 		if err != nil {
 			return
 		}
+		defer release()
 
 		err = n.ValidateAction(a, def, vpkg, prepareSources(sources))
 		if err != nil {
@@ -144,6 +159,23 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 	return
 }
 
+// actionHeader returns the header of the entry that an action validates, if it has one
+func actionHeader(a ValidatingAction) (header *Header) {
+	switch t := a.(type) {
+	case *ActionCommit:
+		header = t.header
+	case *ActionPut:
+		header = t.header
+	case *ActionMod:
+		header = t.header
+	case *ActionDel:
+		header = t.header
+	case *ActionLink:
+		header = t.header
+	}
+	return
+}
+
 // GetValidationResponse check the validation request and builds the validation package based
 // on the app's requirements
 func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp ValidateResponse, err error) {
@@ -199,10 +231,12 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 
 		// get the packaging request from the app
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		var release func()
+		n, _, release, err = h.GetRibosome(z.Name)
 		if err != nil {
 			return
 		}
+		defer release()
 
 		var req PackagingReq
 		req, err = n.ValidatePackagingRequest(a, def)
@@ -242,6 +276,12 @@ func MakeActionFromMessage(msg *Message) (a Action, err error) {
 	case LISTADD_REQUEST:
 		a = &ActionListAdd{}
 		t = reflect.TypeOf(ListAddReq{})
+	case MAILBOX_PUT_REQUEST:
+		a = &ActionMailboxPut{}
+		t = reflect.TypeOf(MailboxPutReq{})
+	case MAILBOX_GET_REQUEST:
+		a = &ActionMailboxGet{}
+		t = reflect.TypeOf(MailboxGetReq{})
 	default:
 		err = fmt.Errorf("message type %d not in holochain-action protocol", int(msg.Type))
 	}
@@ -320,6 +360,33 @@ func (a *ActionDebug) Do(h *Holochain) (response interface{}, err error) {
 	return
 }
 
+//------------------------------------------------------------
+// Emit
+
+type ActionEmit struct {
+	zome    string
+	event   string
+	payload string
+}
+
+func NewEmitAction(zome string, event string, payload string) *ActionEmit {
+	a := ActionEmit{zome: zome, event: event, payload: payload}
+	return &a
+}
+
+func (a *ActionEmit) Name() string {
+	return "emit"
+}
+
+func (a *ActionEmit) Args() []Arg {
+	return []Arg{{Name: "eventName", Type: StringArg}, {Name: "payload", Type: ToStrArg}}
+}
+
+func (a *ActionEmit) Do(h *Holochain) (response interface{}, err error) {
+	h.EmitEvent(AppEvent{Name: a.event, Zome: a.zome, Payload: a.payload})
+	return
+}
+
 //------------------------------------------------------------
 // MakeHash
 
@@ -518,6 +585,7 @@ type Callback struct {
 	Function string
 	ID       string
 	zomeType string
+	msg      *AppMsg // the unsealed message, held for the recipient if they can't be reached
 }
 
 type SendOptions struct {
@@ -550,31 +618,139 @@ func (a *ActionSend) Do(h *Holochain) (response interface{}, err error) {
 	if a.options != nil {
 		timeout = time.Duration(a.options.Timeout) * time.Millisecond
 	}
-	msg := h.node.NewMessage(APP_MESSAGE, a.msg)
+	body := a.msg
+	if a.to != h.nodeID {
+		body, err = h.sealAppMsg(a.to, a.msg)
+		if err != nil {
+			return
+		}
+	}
+	msg := h.node.NewMessage(APP_MESSAGE, body)
 	if a.options != nil && a.options.Callback != nil {
+		a.options.Callback.msg = &a.msg
 		err = h.SendAsync(ActionProtocol, a.to, msg, a.options.Callback, timeout)
 	} else {
 
 		r, err = h.Send(h.node.ctx, ActionProtocol, a.to, msg, timeout)
 		if err == nil {
-			response = r.(AppMsg).Body
+			var rsp AppMsg
+			rsp, err = h.openAppMsg(r.(AppMsg))
+			if err == nil {
+				response = rsp.Body
+			}
+		} else if _, unreachable := err.(UnreachableError); unreachable {
+			err = h.HoldMessage(a.to, a.msg)
+			if err == nil {
+				response = SendHeld{Held: true}
+			}
 		}
 	}
 	return
 }
 
 func (a *ActionSend) Receive(dht *DHT, msg *Message, retries int) (response interface{}, err error) {
-	t := msg.Body.(AppMsg)
-	var r Ribosome
-	r, _, err = dht.h.MakeRibosome(t.ZomeType)
+	sealed := msg.Body.(AppMsg).Sealed
+	var t AppMsg
+	t, err = dht.h.openAppMsg(msg.Body.(AppMsg))
 	if err != nil {
 		return
 	}
 	rsp := AppMsg{ZomeType: t.ZomeType}
-	rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
-	if err == nil {
-		response = rsp
+	if t.ZomeType == countersignZomeType {
+		rsp.Body, err = dht.h.receiveCountersign(msg.From, t.Body)
+	} else if t.ZomeType == mailReplyZomeType {
+		err = dht.h.receiveMailReply(msg.From, t.Body)
+	} else {
+		var r Ribosome
+		var release func()
+		r, _, release, err = dht.h.GetRibosome(t.ZomeType)
+		if err != nil {
+			return
+		}
+		defer release()
+		rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
+	}
+	if err != nil {
+		return
+	}
+	// answer sealed messages in kind
+	if len(sealed) > 0 {
+		rsp, err = dht.h.sealAppMsg(msg.From, rsp)
+		if err != nil {
+			return
+		}
+	}
+	response = rsp
+	return
+}
+
+//------------------------------------------------------------
+// Encrypt
+
+type ActionEncrypt struct {
+	to   peer.ID
+	data string
+}
+
+func NewEncryptAction(to peer.ID, data string) *ActionEncrypt {
+	a := ActionEncrypt{to: to, data: data}
+	return &a
+}
+
+func (a *ActionEncrypt) Name() string {
+	return "encrypt"
+}
+
+func (a *ActionEncrypt) Args() []Arg {
+	return []Arg{{Name: "to", Type: HashArg}, {Name: "data", Type: StringArg}}
+}
+
+func (a *ActionEncrypt) Do(h *Holochain) (response interface{}, err error) {
+	var key ic.PubKey
+	key, err = h.agentPubKey(a.to)
+	if err != nil {
+		return
+	}
+	var sealed []byte
+	sealed, err = EncryptFor(key, []byte(a.data))
+	if err != nil {
+		return
 	}
+	response = base64.StdEncoding.EncodeToString(sealed)
+	return
+}
+
+//------------------------------------------------------------
+// Decrypt
+
+type ActionDecrypt struct {
+	data string
+}
+
+func NewDecryptAction(data string) *ActionDecrypt {
+	a := ActionDecrypt{data: data}
+	return &a
+}
+
+func (a *ActionDecrypt) Name() string {
+	return "decrypt"
+}
+
+func (a *ActionDecrypt) Args() []Arg {
+	return []Arg{{Name: "data", Type: StringArg}}
+}
+
+func (a *ActionDecrypt) Do(h *Holochain) (response interface{}, err error) {
+	var sealed, data []byte
+	sealed, err = base64.StdEncoding.DecodeString(a.data)
+	if err != nil {
+		return
+	}
+	data, err = Decrypt(h.agent.PrivKey(), sealed)
+	if err != nil {
+		return
+	}
+	response = string(data)
 	return
 }
 
@@ -900,6 +1076,19 @@ func sysValidateEntry(h *Holochain, def *EntryDef, entry Entry, pkg *Package) (e
 		err = ErrNilEntryInvalid
 		return
 	}
+
+	if max := h.nucleus.dna.DHTConfig.MaxEntrySize; max > 0 {
+		var data []byte
+		data, err = entry.Marshal()
+		if err != nil {
+			return
+		}
+		if len(data) > max {
+			err = ErrEntryTooLarge
+			return
+		}
+	}
+
 	// see if there is a schema validator for the entry type and validate it if so
 	if def.validator != nil {
 		var input interface{}
@@ -1029,8 +1218,27 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message, retries int) (response inter
 		if err != nil {
 			dht.dlog.Logf("Put %v rejected: %v", t.H, err)
 			status = StatusRejected
+			// only the app's validation failing is evidence against the author, not e.g. a
+			// missing definition or a ribosome error, and the warrant is gossiped without
+			// holding up the response to the put
+			if isInvalidEntry(err) {
+				go func(author peer.ID, resp ValidateResponse) {
+					if e := dht.warrantInvalidEntry(author, &resp); e != nil {
+						dht.dlog.Logf("unable to warrant rejected put %v: %v", t.H, e)
+					}
+				}(msg.From, resp)
+			}
 		} else {
 			status = StatusLive
+			// the entry predates its author's key revocation, so it's held with a warning
+			var revokedLater bool
+			revokedLater, err = dht.checkKeyRevocation(&resp.Header, []peer.ID{msg.From})
+			if err != nil {
+				return err
+			}
+			if revokedLater {
+				status = StatusWarning
+			}
 		}
 		entry := resp.Entry
 		var b []byte
@@ -1038,6 +1246,9 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message, retries int) (response inter
 		if err == nil {
 			err = dht.put(msg, resp.Type, t.H, msg.From, b, status)
 		}
+		if err == nil && status != StatusRejected {
+			dht.h.nucleus.DispatchHook(HeldHook, t.H.String(), resp.Type)
+		}
 		return err
 	})
 
@@ -1192,6 +1403,10 @@ func (a *ActionMod) CheckValidationRequest(def *EntryDef) (err error) {
 type ActionModAgent struct {
 	Identity   AgentIdentity
 	Revocation string
+
+	// Seed, when set, is what the new key of a revocation is generated from, so that it
+	// can be rebuilt from a recovery phrase
+	Seed io.Reader
 }
 
 func NewModAgentAction(identity AgentIdentity) *ActionModAgent {
@@ -1216,7 +1431,7 @@ func (a *ActionModAgent) Do(h *Holochain) (response interface{}, err error) {
 
 	var revocation *SelfRevocation
 	if a.Revocation != "" {
-		err = newAgent.GenKeys(nil)
+		err = newAgent.GenKeys(a.Seed)
 		if err != nil {
 			return
 		}
@@ -1224,22 +1439,54 @@ func (a *ActionModAgent) Do(h *Holochain) (response interface{}, err error) {
 		if err != nil {
 			return
 		}
+		err = revocation.SetTime(newAgent.PrivKey(), time.Now())
+		if err != nil {
+			return
+		}
 		ok = true
 	}
 	if !ok {
 		err = errors.New("expecting identity and/or revocation option")
 	} else {
+		// stage the new key before committing to it, so that nothing that can go wrong
+		// saving it does so once the chain has moved on to it
+		var promote func() error
+		if revocation != nil {
+			promote, err = stageRotatedAgent(h.rootPath, &newAgent)
+			if err != nil {
+				return
+			}
+			defer func() {
+				if promote != nil {
+					os.Remove(filepath.Join(h.rootPath, PendingPrivKeyFileName))
+				}
+			}()
+		}
 
 		//TODO: synchronize this, what happens if two new agent request come in back to back?
+		oldAgent := h.agent
 		h.agent = &newAgent
 		// add a new agent entry and update
 		var agentHash Hash
 		_, agentHash, err = h.AddAgentEntry(revocation)
 		if err != nil {
+			h.agent = oldAgent
 			return
 		}
 		h.agentTopHash = agentHash
 
+		// the chain now belongs to the new key, so it must be what the chain comes back up with
+		if promote != nil {
+			err = promote()
+			promote = nil
+			if err != nil {
+				return
+			}
+		}
+
+		// pooled ribosomes still have the old agent
+		h.FlushRibosomes()
+
 		// if there was a revocation put the new key to the DHT and then reset the node ID data
 		// TODO make sure this doesn't introduce race conditions in the DHT between new and old identity #284
 		if revocation != nil {
@@ -1266,10 +1513,20 @@ func (a *ActionModAgent) Do(h *Holochain) (response interface{}, err error) {
 				panic(err)
 			}
 
-			// close the old node and add the new node
+			// close the old node and add the new node, which starts out with the old node's
+			// peers so that the changes below reach the network
 			// TODO currently ignoring the error from node.Close() is this OK?
+			if err = h.SavePeers(); err != nil {
+				h.Debugf("error saving peers: %v", err)
+			}
 			h.node.Close()
-			h.createNode()
+			err = h.createNode()
+			if err != nil {
+				return
+			}
+			if err = h.restorePeers(); err != nil {
+				return
+			}
 
 			h.dht.Change(oldKey, MOD_REQUEST, ModReq{H: oldKey, N: newKey})
 
@@ -1288,7 +1545,6 @@ func (a *ActionModAgent) Do(h *Holochain) (response interface{}, err error) {
 					WarrantType: SelfRevocationType,
 					Warrant:     data,
 				})
-
 		}
 
 		response = agentHash
@@ -1402,6 +1658,7 @@ func (a *ActionDel) Receive(dht *DHT, msg *Message, retries int) (response inter
 		}
 
 		a := NewDelAction(resp.Type, delEntry)
+		a.header = &resp.Header
 		//@TODO what comes back from Validate Del
 		_, err = dht.h.ValidateAction(a, resp.Type, &resp.Package, []peer.ID{from})
 		if err != nil {
@@ -1427,6 +1684,7 @@ type ActionLink struct {
 	entryType      string
 	links          []Link
 	validationBase Hash
+	header         *Header
 }
 
 func NewLinkAction(entryType string, links []Link) *ActionLink {
@@ -1474,6 +1732,7 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message, retries int) (response inte
 
 		a := NewLinkAction(resp.Type, le.Links)
 		a.validationBase = t.Base
+		a.header = &resp.Header
 		_, err = dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{from})
 		//@TODO this is "one bad apple spoils the lot" because the app
 		// has no way to tell us not to link certain of the links.
@@ -1648,21 +1907,73 @@ func (a *ActionListAdd) Receive(dht *DHT, msg *Message, retries int) (response i
 		return
 	}
 
+	// check that the warrant, if valid, is sufficient to allow the list addition before
+	// going to the trouble of verifying it
+	err = checkListWarrant(w, a.list)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", prefix, err)
+		return
+	}
+
 	err = w.Verify(dht.h)
 	if err != nil {
 		err = fmt.Errorf("%s: %v", prefix, err)
 		return
 	}
 
-	// TODO verify that the warrant, if valid, is sufficient to allow list addition #300
+	if a.list.Type == WarrantedList {
+		for i := range a.list.Records {
+			a.list.Records[i].Warrant = string(t.Warrant)
+		}
+	}
 
 	err = dht.addToList(msg, a.list)
 	if err != nil {
 		return
 	}
 
+	// record when a self revoked key was revoked so headers it signs later are rejected
+	if rw, ok := w.(*SelfRevocationWarrant); ok {
+		var parties []Hash
+		parties, err = rw.Parties()
+		if err != nil {
+			return
+		}
+		var revoked peer.ID
+		revoked, err = peer.IDB58Decode(parties[0].String())
+		if err != nil {
+			return
+		}
+		// the time is signed by the new key, and one in the future is taken as now so that
+		// the revoked key can't be kept valid for longer
+		at := time.Now()
+		if rw.Revocation.Time != nil && rw.Revocation.Time.Before(at) {
+			at = *rw.Revocation.Time
+		}
+		err = dht.revokeKey(revoked, at)
+		if err != nil {
+			return
+		}
+	}
+
+	// authors of invalid entries are only blocked if the node is configured to, and only if
+	// validation is deterministic so that the warrant proves the same on every node
+	block := a.list.Type == BlockedList
+	autoBlock := a.list.Type == WarrantedList && dht.h.Config.AutoBlockWarranted
+	if autoBlock && !dht.h.nucleus.dna.StrictValidation {
+		dht.dlog.Logf("not blocking warranted peers as the DNA doesn't have StrictValidation")
+		autoBlock = false
+	}
+	if autoBlock {
+		err = dht.addToList(nil, PeerList{Type: BlockedList, Records: a.list.Records})
+		if err != nil {
+			return
+		}
+		block = true
+	}
+
 	// special case to add blockedlist peers to node cache and delete them from the gossipers list
-	if a.list.Type == BlockedList {
+	if block {
 		for _, node := range a.list.Records {
 			dht.h.node.Block(node.ID)
 			dht.DeleteGossiper(node.ID) // ignore error
@@ -1672,6 +1983,48 @@ func (a *ActionListAdd) Receive(dht *DHT, msg *Message, retries int) (response i
 	return
 }
 
+// checkListWarrant checks that a warrant is of a kind that the list takes and that the peers
+// added to the list are the party the warrant is against, which is its first party: the
+// revoked key of a self revocation or the author of an invalid entry
+func checkListWarrant(w Warrant, list PeerList) (err error) {
+	switch list.Type {
+	case BlockedList:
+		// a countersignature is no reason to block any of its parties
+		if w.Type() != SelfRevocationType && w.Type() != InvalidEntryType {
+			err = errors.New("blocked list requires a self revocation or invalid entry warrant")
+			return
+		}
+	case WarrantedList:
+		if w.Type() != InvalidEntryType {
+			err = errors.New("warranted list requires an invalid entry warrant")
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown list type: %s", list.Type)
+		return
+	}
+	if len(list.Records) == 0 {
+		err = errors.New("no peers to add")
+		return
+	}
+	var parties []Hash
+	parties, err = w.Parties()
+	if err != nil {
+		return
+	}
+	for _, r := range list.Records {
+		if peer.IDB58Encode(r.ID) != parties[0].String() {
+			if w.Type() == SelfRevocationType {
+				err = fmt.Errorf("%v is not the revoked key", r.ID)
+			} else {
+				err = fmt.Errorf("%v is not the author of the warranted entry", r.ID)
+			}
+			return
+		}
+	}
+	return
+}
+
 // retryIfHashNotFound checks to see if the hash is found and if not queues the message for retry
 func (dht *DHT) retryIfHashNotFound(hash Hash, msg *Message, retries int) (response interface{}, err error) {
 	err = dht.exists(hash, StatusDefault)
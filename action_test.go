@@ -131,6 +131,17 @@ func TestSysValidateEntry(t *testing.T) {
 		So(err.Error(), ShouldEqual, "nil entry invalid")
 	})
 
+	Convey("entries larger than the DNA's MaxEntrySize are invalid", t, func() {
+		_, def, _ := h.GetEntryDef("evenNumbers")
+		h.nucleus.dna.DHTConfig.MaxEntrySize = 20
+		defer func() { h.nucleus.dna.DHTConfig.MaxEntrySize = 0 }()
+
+		err := sysValidateEntry(h, def, &GobEntry{C: "2"}, nil)
+		So(err, ShouldBeNil)
+		err = sysValidateEntry(h, def, &GobEntry{C: "2222222222222222"}, nil)
+		So(err, ShouldEqual, ErrEntryTooLarge)
+	})
+
 	Convey("validate on a schema based entry should check entry against the schema", t, func() {
 		profile := `{"firstName":"Eric"}` // missing required lastName
 		_, def, _ := h.GetEntryDef("profile")
@@ -12,6 +12,7 @@ import (
 	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -27,6 +28,10 @@ const (
 	LibP2P = iota
 )
 
+// PendingPrivKeyFileName is the file holding the new key of a key rotation until the agent
+// entry that makes it the chain's key is committed
+const PendingPrivKeyFileName = PrivKeyFileName + ".pending"
+
 // Agent abstracts the key behaviors and connection to a holochain node address
 // Note that this is currently only a partial abstraction because the NodeID is always a libp2p peer.ID
 // to complete the abstraction so we could use other libraries for p2p2 network transaction we
@@ -126,7 +131,8 @@ func NewAgent(agentType AgentType, identity AgentIdentity, seed io.Reader) (agen
 	return
 }
 
-// SaveAgent saves out the keys and agent name to the given directory
+// SaveAgent saves out the keys and agent name to the given directory, encrypting the private
+// key if the agent has a passphrase
 func SaveAgent(path string, agent Agent) (err error) {
 	WriteFile([]byte(agent.Identity()), path, AgentFileName)
 	if err != nil {
@@ -140,12 +146,17 @@ func SaveAgent(path string, agent Agent) (err error) {
 	if err != nil {
 		return
 	}
-	err = WriteFile(k, path, PrivKeyFileName)
-	os.Chmod(filepath.Join(path, PrivKeyFileName), OS_USER_R)
+	var passphrase []byte
+	passphrase, err = agentPassphrase(path, true)
+	if err != nil {
+		return
+	}
+	err = writeKeyFile(path, k, passphrase)
 	return
 }
 
-// LoadAgent gets the agent identity and private key from the specified directory
+// LoadAgent gets the agent identity and private key from the specified directory, asking
+// for the passphrase if the private key is encrypted
 // TODO confirm against chain?
 func LoadAgent(path string) (agent Agent, err error) {
 	var perms os.FileMode
@@ -169,7 +180,7 @@ func LoadAgent(path string) (agent Agent, err error) {
 	a := LibP2PAgent{
 		identity: AgentIdentity(identity),
 	}
-	k, err := ReadFile(path, PrivKeyFileName)
+	k, err := readKeyFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -181,3 +192,60 @@ func LoadAgent(path string) (agent Agent, err error) {
 	agent = &a
 	return
 }
+
+// saveRotatedAgent saves an agent whose key replaces the one in the directory, or in the
+// service directory above it if the directory has no key of its own.  The new key is only
+// encrypted if the one it replaces is, and is saved to the directory itself so that other
+// chains keep the service's key.
+func saveRotatedAgent(path string, agent Agent) (err error) {
+	promote, err := stageRotatedAgent(path, agent)
+	if err != nil {
+		return
+	}
+	err = promote()
+	return
+}
+
+// stageRotatedAgent does all of saveRotatedAgent that can fail for want of a passphrase or
+// such, writing the new key to a pending key file.  The returned promote function then puts
+// the agent in place, and until it's called the pending key file can just be removed.
+func stageRotatedAgent(path string, agent Agent) (promote func() error, err error) {
+	from := path
+	if !FileExists(path, PrivKeyFileName) {
+		from = filepath.Dir(path)
+	}
+	var old []byte
+	old, err = ReadFile(from, PrivKeyFileName)
+	if err != nil {
+		return
+	}
+	var passphrase []byte
+	if IsEncryptedKey(old) {
+		passphrase, err = agentPassphrase(from, false)
+		if err != nil {
+			return
+		}
+		if passphrase == nil {
+			err = ErrNoPassphrase
+			return
+		}
+	}
+	var k []byte
+	k, err = agent.PrivKey().Bytes()
+	if err != nil {
+		return
+	}
+	err = writeKeyFileAs(path, PendingPrivKeyFileName, k, passphrase)
+	if err != nil {
+		return
+	}
+	promote = func() (err error) {
+		err = ioutil.WriteFile(filepath.Join(path, AgentFileName), []byte(agent.Identity()), OS_USER_RW)
+		if err != nil {
+			return
+		}
+		err = os.Rename(filepath.Join(path, PendingPrivKeyFileName), filepath.Join(path, PrivKeyFileName))
+		return
+	}
+	return
+}
@@ -93,3 +93,70 @@ func TestLibP2PAgent(t *testing.T) {
 		So(n1, ShouldNotEqual, n2)
 	})
 }
+
+func TestSaveRotatedAgent(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	a1, _ := NewAgent(LibP2P, AgentIdentity("zippy@someemail.com"), MakeTestSeed(""))
+	a2, _ := NewAgent(LibP2P, AgentIdentity("zippy@someemail.com"), MakeTestSeed("new key"))
+
+	Convey("it should save the new key for the chain and leave the service's key", t, func() {
+		err := SaveAgent(d, a1)
+		So(err, ShouldBeNil)
+		chain := filepath.Join(d, "chain")
+		os.MkdirAll(chain, os.ModePerm)
+		err = saveRotatedAgent(chain, a2)
+		So(err, ShouldBeNil)
+		a, err := LoadAgent(chain)
+		So(err, ShouldBeNil)
+		So(a.Identity(), ShouldEqual, a2.Identity())
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+		a, err = LoadAgent(d)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a1.PrivKey()), ShouldBeTrue)
+
+		// rotating again replaces the chain's own key
+		err = saveRotatedAgent(chain, a1)
+		So(err, ShouldBeNil)
+		a, err = LoadAgent(chain)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a1.PrivKey()), ShouldBeTrue)
+	})
+
+	Convey("it should encrypt the new key if the one it replaces is encrypted", t, func() {
+		e := filepath.Join(d, "encrypted")
+		os.MkdirAll(e, os.ModePerm)
+		os.Setenv(PassphraseEnvVar, "secret")
+		defer os.Unsetenv(PassphraseEnvVar)
+		err := SaveAgent(e, a1)
+		So(err, ShouldBeNil)
+		chain := filepath.Join(e, "chain")
+		os.MkdirAll(chain, os.ModePerm)
+		err = saveRotatedAgent(chain, a2)
+		So(err, ShouldBeNil)
+		k, _ := ReadFile(chain, PrivKeyFileName)
+		So(IsEncryptedKey(k), ShouldBeTrue)
+		a, err := LoadAgent(chain)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+	})
+
+	Convey("it should only replace the key once the staged one is promoted", t, func() {
+		chain := filepath.Join(d, "staged")
+		os.MkdirAll(chain, os.ModePerm)
+		err := SaveAgent(chain, a1)
+		So(err, ShouldBeNil)
+		promote, err := stageRotatedAgent(chain, a2)
+		So(err, ShouldBeNil)
+		So(FileExists(chain, PendingPrivKeyFileName), ShouldBeTrue)
+		a, err := LoadAgent(chain)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a1.PrivKey()), ShouldBeTrue)
+
+		So(promote(), ShouldBeNil)
+		So(FileExists(chain, PendingPrivKeyFileName), ShouldBeFalse)
+		a, err = LoadAgent(chain)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,317 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// generation of the TypeScript typings and Markdown reference of the API for zome authors
+//
+// Both are built from the HostFns registry, the Args specs of the actions, and the tables
+// below of the constants and App globals the ribosomes expose, so they match the bindings.
+
+package holochain
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// HostConstant describes a constant that the ribosomes expose to zome code
+type HostConstant struct {
+	// Path is the constant's place in the JS HC object, e.g. Status.Live, which in Zygo
+	// is the global HC_Status_Live
+	Path  string
+	Value interface{}
+	Doc   string
+}
+
+// HostConstants are the constants defined by JSLibrary and ZygoLibrary
+var HostConstants = []HostConstant{
+	{"Version", VersionStr, "the version of holochain"},
+	{"Status.Live", StatusLive, "status mask of live entries and links"},
+	{"Status.Rejected", StatusRejected, "status mask of entries rejected by validation"},
+	{"Status.Deleted", StatusDeleted, "status mask of removed entries and links"},
+	{"Status.Modified", StatusModified, "status mask of updated entries"},
+	{"Status.Warning", StatusWarning, "status mask of entries held from an agent whose key was later revoked"},
+	{"Status.Any", StatusAny, "status mask of entries of any status"},
+	{"GetMask.Default", GetMaskDefault, "get returns what it does without a mask, the entry"},
+	{"GetMask.Entry", GetMaskEntry, "get returns the entry"},
+	{"GetMask.EntryType", GetMaskEntryType, "get returns the entry type"},
+	{"GetMask.Sources", GetMaskSources, "get returns the sources of the entry"},
+	{"GetMask.All", GetMaskAll, "get returns an object with all of the above"},
+	{"LinkAction.Add", AddAction, "LinkAction of a link that adds it"},
+	{"LinkAction.Del", DelAction, "LinkAction of a link that removes it"},
+	{"PkgReq.Chain", PkgReqChain, "key of a validation package request for what to include of the chain"},
+	{"PkgReq.ChainOpt.None", PkgReqChainOptNone, "include nothing of the chain"},
+	{"PkgReq.ChainOpt.Headers", PkgReqChainOptHeaders, "include the chain's headers"},
+	{"PkgReq.ChainOpt.Entries", PkgReqChainOptEntries, "include the chain's entries"},
+	{"PkgReq.ChainOpt.Full", PkgReqChainOptFull, "include the chain's headers and entries"},
+	{"Bridge.From", BridgeFrom, "Side of a bridge from this app to another"},
+	{"Bridge.To", BridgeTo, "Side of a bridge to this app from another"},
+}
+
+// HostGlobal describes a value about the running app that the ribosomes expose
+type HostGlobal struct {
+	// Path is the value's place in the JS App object, e.g. DNA.Hash, which in Zygo is the
+	// global App_DNA_Hash
+	Path string
+	Doc  string
+}
+
+// HostGlobals are the App values available to zome code
+var HostGlobals = []HostGlobal{
+	{"Name", "the name of the app"},
+	{"DNA.Hash", "the hash of the app's DNA"},
+	{"Agent.Hash", "the hash of the agent's first agent entry"},
+	{"Agent.TopHash", "the hash of the agent's latest agent entry"},
+	{"Agent.String", "the agent's identity"},
+	{"Key.Hash", "the hash of the agent's public key, which is the node's address"},
+}
+
+// zygoName returns the name of the Zygo global for a path in a JS object
+func zygoName(object string, path string) string {
+	return object + "_" + strings.Replace(path, ".", "_", -1)
+}
+
+// apiTypes are the types results are described with, which aren't in any Args spec
+const apiTypes = `type Hash = string;
+
+interface Bridge {
+  Side: number;
+  ToApp?: Hash;
+  Token?: string;
+}
+
+interface Link {
+  Hash: Hash;
+  Tag?: string;
+  EntryType?: string;
+  Source?: Hash;
+  Entry?: any;
+}
+
+interface Countersigned {
+  Hash: Hash;
+  Warrant: string;
+}
+
+interface SendHeld {
+  Held: boolean;
+}
+
+interface CountersignWarrant {
+  EntryType: string;
+  EntryHash: Hash;
+  Parties: string[];
+}
+`
+
+// tsReserved are the argument names that can't be TypeScript parameter names
+var tsReserved = map[string]bool{"function": true, "default": true, "delete": true, "new": true, "var": true}
+
+// tsArgType returns the TypeScript type of an argument, adding the interfaces of any
+// options it takes to ifaces
+func tsArgType(arg Arg, ifaces *tsInterfaces) string {
+	switch arg.Type {
+	case HashArg:
+		return "Hash"
+	case StringArg:
+		return "string"
+	case IntArg:
+		return "number"
+	case BoolArg:
+		return "boolean"
+	case ArgsArg:
+		return "string | object"
+	case MapArg:
+		if arg.MapType == nil {
+			return "object"
+		}
+		return ifaces.typeOf(arg.MapType)
+	}
+	return "any"
+}
+
+// tsInterfaces collects the TypeScript interfaces of the Go types of options in the order
+// they are first used
+type tsInterfaces struct {
+	names []string
+	decls map[string]string
+}
+
+func (t *tsInterfaces) typeOf(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return t.typeOf(typ.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return t.typeOf(typ.Elem()) + "[]"
+	case reflect.Struct:
+		name := typ.Name()
+		if _, done := t.decls[name]; !done {
+			t.decls[name] = ""
+			var b bytes.Buffer
+			fmt.Fprintf(&b, "interface %s {\n", name)
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				if f.PkgPath != "" {
+					continue
+				}
+				// options are decoded onto defaults so every field is optional
+				fmt.Fprintf(&b, "  %s?: %s;\n", f.Name, t.typeOf(f.Type))
+			}
+			b.WriteString("}\n")
+			t.names = append(t.names, name)
+			t.decls[name] = b.String()
+		}
+		return name
+	}
+	return "any"
+}
+
+// tsObject renders the paths as nested TypeScript object type members
+func tsObject(b *bytes.Buffer, indent string, paths []string, types map[string]string) {
+	var done []string
+	for _, p := range paths {
+		parts := strings.SplitN(p, ".", 2)
+		if len(parts) == 1 {
+			fmt.Fprintf(b, "%s%s: %s;\n", indent, p, types[p])
+			continue
+		}
+		seen := false
+		for _, d := range done {
+			seen = seen || d == parts[0]
+		}
+		if seen {
+			continue
+		}
+		done = append(done, parts[0])
+		var sub []string
+		subTypes := make(map[string]string)
+		for _, q := range paths {
+			if strings.HasPrefix(q, parts[0]+".") {
+				s := strings.TrimPrefix(q, parts[0]+".")
+				sub = append(sub, s)
+				subTypes[s] = types[q]
+			}
+		}
+		fmt.Fprintf(b, "%s%s: {\n", indent, parts[0])
+		tsObject(b, indent+"  ", sub, subTypes)
+		fmt.Fprintf(b, "%s};\n", indent)
+	}
+}
+
+func tsValueType(v interface{}) string {
+	if _, ok := v.(string); ok {
+		return "string"
+	}
+	return "number"
+}
+
+// APITypeScript returns TypeScript declarations of the API for JS zome code
+func APITypeScript() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Holochain %s API for zome code, generated by hcdev apidocs; do not edit\n\n", VersionStr)
+	b.WriteString(apiTypes)
+
+	ifaces := tsInterfaces{decls: make(map[string]string)}
+	var fns bytes.Buffer
+	for _, fn := range HostFns {
+		var params []string
+		for _, arg := range fn.Args() {
+			opt := ""
+			if arg.Optional {
+				opt = "?"
+			}
+			name := arg.Name
+			if tsReserved[name] {
+				name += "_"
+			}
+			params = append(params, fmt.Sprintf("%s%s: %s", name, opt, tsArgType(arg, &ifaces)))
+		}
+		fmt.Fprintf(&fns, "\n/** %s */\ndeclare function %s(%s): %s;\n", fn.Doc, fn.Name, strings.Join(params, ", "), fn.Returns)
+	}
+	for _, name := range ifaces.names {
+		b.WriteString("\n" + ifaces.decls[name])
+	}
+
+	var paths []string
+	types := make(map[string]string)
+	for _, c := range HostConstants {
+		paths = append(paths, c.Path)
+		types[c.Path] = tsValueType(c.Value)
+	}
+	b.WriteString("\ndeclare const HC: {\n")
+	tsObject(&b, "  ", paths, types)
+	b.WriteString("};\n")
+
+	paths = nil
+	types = make(map[string]string)
+	for _, g := range HostGlobals {
+		paths = append(paths, g.Path)
+		types[g.Path] = "string"
+	}
+	b.WriteString("\ndeclare const App: {\n")
+	tsObject(&b, "  ", paths, types)
+	b.WriteString("};\n")
+
+	b.Write(fns.Bytes())
+	b.WriteString("\n/** returns the exports of a module of the zome or of the DNA's library */\ndeclare function require(name: string): any;\n")
+	return b.String()
+}
+
+// APIMarkdown returns a Markdown reference of the API for zome code
+func APIMarkdown() string {
+	var b bytes.Buffer
+	ifaces := tsInterfaces{decls: make(map[string]string)}
+	fmt.Fprintf(&b, "# Holochain API\n\nThe API available to zome code in holochain %s, generated by `hcdev apidocs`.\n", VersionStr)
+	b.WriteString("Types are given in TypeScript; see `holochain.d.ts` for the full declarations.\n")
+
+	b.WriteString("\n## Functions\n")
+	for _, fn := range HostFns {
+		args := fn.Args()
+		var names []string
+		for _, arg := range args {
+			names = append(names, arg.Name)
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", fn.Name)
+		fmt.Fprintf(&b, "JS: `%s(%s)`  \nZygo: `(%s)`\n\n", fn.Name, strings.Join(names, ", "), strings.Join(append([]string{fn.Name}, names...), " "))
+		fmt.Fprintf(&b, "%s.\n\n", strings.ToUpper(fn.Doc[:1])+fn.Doc[1:])
+		if len(args) > 0 {
+			b.WriteString("| Argument | Type | Optional |\n|---|---|---|\n")
+			for _, arg := range args {
+				opt := ""
+				if arg.Optional {
+					opt = "yes"
+				}
+				fmt.Fprintf(&b, "| %s | `%s` | %s |\n", arg.Name, tsArgType(arg, &ifaces), opt)
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "Returns `%s`.\n", fn.Returns)
+		if fn.NonDeterministic {
+			b.WriteString("\nNon-deterministic: can't be called by validation callbacks in strict mode.\n")
+		}
+	}
+
+	b.WriteString("\n## Constants\n\n| JS | Zygo | Value | Description |\n|---|---|---|---|\n")
+	for _, c := range HostConstants {
+		fmt.Fprintf(&b, "| `HC.%s` | `%s` | `%#v` | %s |\n", c.Path, zygoName("HC", c.Path), c.Value, c.Doc)
+	}
+
+	b.WriteString("\n## App globals\n\n| JS | Zygo | Description |\n|---|---|---|\n")
+	for _, g := range HostGlobals {
+		fmt.Fprintf(&b, "| `App.%s` | `%s` | %s |\n", g.Path, zygoName("App", g.Path), g.Doc)
+	}
+
+	b.WriteString("\n## Types\n\n```typescript\n" + apiTypes)
+	for _, name := range ifaces.names {
+		b.WriteString("\n" + ifaces.decls[name])
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	zygo "github.com/glycerine/zygomys/repl"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestHostConstants(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("the JS ribosome should define every constant", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		for _, c := range HostConstants {
+			_, err = z.Run(`JSON.stringify(HC.` + c.Path + `)`)
+			So(err, ShouldBeNil)
+			expected, _ := json.Marshal(c.Value)
+			So(z.lastResult.String(), ShouldEqual, string(expected))
+		}
+	})
+
+	Convey("the JS ribosome should define no constants that aren't documented", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.Run(`function leaves(o,p){var l=[];for(var k in o){if(typeof o[k]==="object"){l=l.concat(leaves(o[k],p+k+"."))}else{l.push(p+k)}};return l};leaves(HC,"").join(",")`)
+		So(err, ShouldBeNil)
+		var paths []string
+		for _, c := range HostConstants {
+			paths = append(paths, c.Path)
+		}
+		So(z.lastResult.String(), ShouldEqual, strings.Join(paths, ","))
+	})
+
+	Convey("the Zygo ribosome should define every constant", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		for _, c := range HostConstants {
+			_, err = z.Run(zygoName("HC", c.Path))
+			So(err, ShouldBeNil)
+			var s string
+			switch r := z.lastResult.(type) {
+			case *zygo.SexpStr:
+				s = r.S
+			case *zygo.SexpInt:
+				s = fmt.Sprintf("%d", r.Val)
+			}
+			So(s, ShouldEqual, fmt.Sprintf("%v", c.Value))
+		}
+	})
+
+	Convey("both ribosomes should define every App global", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		js := v.(*JSRibosome)
+		v, err = NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType})
+		So(err, ShouldBeNil)
+		zy := v.(*ZygoRibosome)
+		for _, g := range HostGlobals {
+			_, err = js.Run(`typeof App.` + g.Path)
+			So(err, ShouldBeNil)
+			So(js.lastResult.String(), ShouldEqual, "string")
+			_, err = zy.Run(zygoName("App", g.Path))
+			So(err, ShouldBeNil)
+			_, ok := zy.lastResult.(*zygo.SexpStr)
+			So(ok, ShouldBeTrue)
+		}
+	})
+}
+
+func TestAPITypeScript(t *testing.T) {
+	Convey("it should declare every host function with its args", t, func() {
+		ts := APITypeScript()
+		for _, fn := range HostFns {
+			So(ts, ShouldContainSubstring, "declare function "+fn.Name+"(")
+		}
+		So(ts, ShouldContainSubstring, "declare function commit(entryType: string, entry: any): Hash;")
+		So(ts, ShouldContainSubstring, "declare function get(hash: Hash, options?: GetOptions): any;")
+		So(ts, ShouldContainSubstring, "declare function call(zome: string, function_: string, args: string | object): any;")
+	})
+
+	Convey("it should declare the interfaces of options", t, func() {
+		ts := APITypeScript()
+		So(ts, ShouldContainSubstring, "interface GetLinksOptions {\n  Load?: boolean;\n  StatusMask?: number;\n}\n")
+		So(ts, ShouldContainSubstring, "interface SendOptions {\n  Callback?: Callback;\n  Timeout?: number;\n}\n")
+		So(ts, ShouldContainSubstring, "interface Callback {\n  Function?: string;\n  ID?: string;\n}\n")
+		So(ts, ShouldContainSubstring, "  EntryTypes?: string[];\n")
+	})
+
+	Convey("it should declare the constants and App globals", t, func() {
+		ts := APITypeScript()
+		So(ts, ShouldContainSubstring, "declare const HC: {\n  Version: string;\n  Status: {\n    Live: number;\n")
+		So(ts, ShouldContainSubstring, "  PkgReq: {\n    Chain: string;\n    ChainOpt: {\n      None: number;\n")
+		So(ts, ShouldContainSubstring, "declare const App: {\n  Name: string;\n  DNA: {\n    Hash: string;\n  };\n")
+	})
+}
+
+func TestAPIMarkdown(t *testing.T) {
+	Convey("it should document every host function, constant and App global", t, func() {
+		md := APIMarkdown()
+		for _, fn := range HostFns {
+			So(md, ShouldContainSubstring, "\n### "+fn.Name+"\n")
+		}
+		for _, c := range HostConstants {
+			So(md, ShouldContainSubstring, "| `HC."+c.Path+"` | `"+zygoName("HC", c.Path)+"` |")
+		}
+		for _, g := range HostGlobals {
+			So(md, ShouldContainSubstring, "| `App."+g.Path+"` | `"+zygoName("App", g.Path)+"` |")
+		}
+		So(md, ShouldContainSubstring, "JS: `getLinks(base, tag, options)`  \nZygo: `(getLinks base tag options)`")
+		So(md, ShouldContainSubstring, "| options | `GetLinksOptions` | yes |")
+		So(md, ShouldContainSubstring, "interface QueryOptions {")
+	})
+}
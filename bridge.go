@@ -69,6 +69,7 @@ func (h *Holochain) AddBridgeAsCallee(fromDNA Hash, appData string) (token strin
 		}
 		h.Debugf("Running BridgeTo Genesis for %s", zomeName)
 		err = r.BridgeGenesis(BridgeTo, fromDNA, appData)
+		r.Close()
 		if err != nil {
 			return
 		}
@@ -140,8 +141,10 @@ func (h *Holochain) BridgeCall(zomeType string, function string, arguments inter
 	}
 
 	if err != nil {
-		err = errors.New("bridging error: " + err.Error())
-
+		// schema errors are passed on as they are so the caller can tell what was wrong
+		if _, ok := err.(*FunctionSchemaError); !ok {
+			err = errors.New("bridging error: " + err.Error())
+		}
 	}
 
 	return
@@ -183,6 +186,7 @@ func (h *Holochain) AddBridgeAsCaller(toDNA Hash, token string, url string, appD
 			}
 			h.Debugf("Running BridgeFrom Genesis for %s", z.Name)
 			err = r.BridgeGenesis(BridgeFrom, toDNA, appData)
+			r.Close()
 			if err != nil {
 				return
 			}
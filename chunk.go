@@ -0,0 +1,151 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// chunk implements sending messages that are too big for a single frame as a series
+// of chunks which are reassembled, and verified against a hash, on the other end
+
+package holochain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	. "github.com/metacurrency/holochain/hash"
+	mh "github.com/multiformats/go-multihash"
+	"io"
+)
+
+const (
+	// MaxMessageSize is the largest encoded message that will be sent or reassembled
+	MaxMessageSize = 16 * 1024 * 1024
+
+	// ChunkSize is the largest frame sent, encoded messages bigger than this are chunked
+	ChunkSize = 256 * 1024
+)
+
+// Chunk holds one piece of an encoded message that was too big to send in one frame
+type Chunk struct {
+	Index int  // position of this chunk in the message
+	Count int  // total number of chunks in the message
+	Hash  Hash // hash of the whole encoded message
+	Data  []byte
+}
+
+var ErrMessageTooLarge = errors.New("message too large")
+var ErrChunkOutOfOrder = errors.New("chunk out of order")
+var ErrChunkHashMismatch = errors.New("chunked message failed hash verification")
+
+// writeMessage encodes a message and writes it to w, in chunks if it's larger than
+// ChunkSize.  Legacy gob streams are never chunked as the other end won't know how
+// to put them back together.
+func writeMessage(w io.Writer, format WireFormat, m *Message) (err error) {
+	data, err := m.EncodeWire(format)
+	if err != nil {
+		return
+	}
+	if len(data) > MaxMessageSize {
+		err = ErrMessageTooLarge
+		return
+	}
+	if len(data) <= ChunkSize || format == GobWireFormat {
+		err = writeAll(w, data)
+		return
+	}
+
+	var hash Hash
+	hash.H, err = mh.Sum(data, mh.SHA2_256, -1)
+	if err != nil {
+		return
+	}
+	count := (len(data) + ChunkSize - 1) / ChunkSize
+	for i := 0; i < count; i++ {
+		end := (i + 1) * ChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		c := Message{Type: MESSAGE_CHUNK, Time: m.Time, From: m.From,
+			Body: Chunk{Index: i, Count: count, Hash: hash, Data: data[i*ChunkSize : end]},
+		}
+		var cdata []byte
+		cdata, err = c.EncodeWire(format)
+		if err != nil {
+			return
+		}
+		err = writeAll(w, cdata)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func writeAll(w io.Writer, data []byte) (err error) {
+	n, err := w.Write(data)
+	if err == nil && n != len(data) {
+		err = errors.New("unable to send all data")
+	}
+	return
+}
+
+// readMessage reads a message from r, reassembling and verifying it if it was chunked
+func readMessage(r io.Reader, format WireFormat, m *Message) (err error) {
+	// successive gob decoders would each buffer the stream on their own
+	br := bufio.NewReader(r)
+	err = m.DecodeWire(format, br)
+	if err != nil || m.Type != MESSAGE_CHUNK {
+		return
+	}
+
+	var first Chunk
+	var data []byte
+	for i := 0; ; i++ {
+		c, ok := m.Body.(Chunk)
+		if !ok {
+			err = ErrDHTUnexpectedTypeInBody
+			return
+		}
+		if i == 0 {
+			first = c
+			if c.Count < 1 || c.Count > MaxMessageSize/ChunkSize+1 {
+				err = ErrMessageTooLarge
+				return
+			}
+		}
+		if c.Index != i || c.Count != first.Count || !c.Hash.Equal(&first.Hash) {
+			err = ErrChunkOutOfOrder
+			return
+		}
+		data = append(data, c.Data...)
+		if len(data) > MaxMessageSize {
+			err = ErrMessageTooLarge
+			return
+		}
+		if i == first.Count-1 {
+			break
+		}
+
+		*m = Message{}
+		err = m.DecodeWire(format, br)
+		if err != nil {
+			return
+		}
+		if m.Type != MESSAGE_CHUNK {
+			err = ErrChunkOutOfOrder
+			return
+		}
+	}
+
+	var hash Hash
+	hash.H, err = mh.Sum(data, mh.SHA2_256, -1)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(&first.Hash) {
+		err = ErrChunkHashMismatch
+		return
+	}
+	*m = Message{}
+	err = m.DecodeWire(format, bytes.NewReader(data))
+	return
+}
@@ -0,0 +1,109 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestChunkedMessages(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	big := strings.Repeat("x", ChunkSize*3+17)
+
+	Convey("small messages should be written in a single frame", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "z", Body: "small"})
+		err := writeMessage(&buf, CBORWireFormat, m)
+		So(err, ShouldBeNil)
+		d, _ := m.EncodeWire(CBORWireFormat)
+		So(buf.Len(), ShouldEqual, len(d))
+
+		var m2 Message
+		err = readMessage(&buf, CBORWireFormat, &m2)
+		So(err, ShouldBeNil)
+		So(m2.Body.(AppMsg).Body, ShouldEqual, "small")
+	})
+
+	Convey("large messages should be chunked and reassembled", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "z", Body: big})
+		err := writeMessage(&buf, CBORWireFormat, m)
+		So(err, ShouldBeNil)
+
+		var c Message
+		err = c.DecodeWire(CBORWireFormat, bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(c.Type, ShouldEqual, MESSAGE_CHUNK)
+		So(c.Body.(Chunk).Count, ShouldEqual, 4)
+
+		var m2 Message
+		err = readMessage(&buf, CBORWireFormat, &m2)
+		So(err, ShouldBeNil)
+		So(m2.Type, ShouldEqual, APP_MESSAGE)
+		So(m2.From, ShouldEqual, node.HashAddr)
+		So(m2.Body.(AppMsg).Body, ShouldEqual, big)
+	})
+
+	Convey("large messages on legacy streams should not be chunked", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(PUT_REQUEST, big)
+		err := writeMessage(&buf, GobWireFormat, m)
+		So(err, ShouldBeNil)
+
+		var m2 Message
+		err = readMessage(&buf, GobWireFormat, &m2)
+		So(err, ShouldBeNil)
+		So(m2.Type, ShouldEqual, PUT_REQUEST)
+		So(m2.Body, ShouldEqual, big)
+	})
+
+	Convey("tampered chunks should fail hash verification", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "z", Body: big})
+		err := writeMessage(&buf, CBORWireFormat, m)
+		So(err, ShouldBeNil)
+
+		d := buf.Bytes()
+		i := bytes.LastIndex(d, []byte("xxxx"))
+		d[i] = 'y'
+		var m2 Message
+		err = readMessage(bytes.NewReader(d), CBORWireFormat, &m2)
+		So(err, ShouldEqual, ErrChunkHashMismatch)
+	})
+
+	Convey("missing chunks should be detected", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "z", Body: big})
+		err := writeMessage(&buf, CBORWireFormat, m)
+		So(err, ShouldBeNil)
+
+		// drop the second chunk
+		r := bytes.NewReader(buf.Bytes())
+		var first, second Message
+		So(first.DecodeWire(CBORWireFormat, r), ShouldBeNil)
+		So(second.DecodeWire(CBORWireFormat, r), ShouldBeNil)
+		var out bytes.Buffer
+		So(writeMessage(&out, CBORWireFormat, &first), ShouldBeNil)
+		rest := make([]byte, r.Len())
+		r.Read(rest)
+		out.Write(rest)
+
+		var m2 Message
+		err = readMessage(&out, CBORWireFormat, &m2)
+		So(err, ShouldEqual, ErrChunkOutOfOrder)
+	})
+
+	Convey("messages over the maximum size should be refused", t, func() {
+		var buf bytes.Buffer
+		m := node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "z", Body: strings.Repeat("x", MaxMessageSize)})
+		err := writeMessage(&buf, CBORWireFormat, m)
+		So(err, ShouldEqual, ErrMessageTooLarge)
+		So(buf.Len(), ShouldEqual, 0)
+	})
+}
@@ -7,16 +7,19 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"net"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -43,6 +46,46 @@ func MakeErrFromErr(c *cli.Context, err error) error {
 	return MakeErr(c, err.Error())
 }
 
+// PromptPassphrase reads a passphrase from the terminal without echoing it, asking twice if
+// confirm is set.  It returns nil if there's no terminal to ask on.
+func PromptPassphrase(prompt string, confirm bool) (passphrase []byte, err error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	passphrase, err = terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil || !confirm || len(passphrase) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Again: ")
+	again, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(passphrase, again) {
+		passphrase = nil
+		err = errors.New("passphrases don't match")
+	}
+	return
+}
+
+// ReadMnemonic reads a recovery phrase from a line of standard input, prompting for it if
+// standard input is a terminal
+func ReadMnemonic(prompt string) (mnemonic string, err error) {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	}
+	mnemonic, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF && mnemonic != "" {
+		err = nil
+	}
+	mnemonic = strings.TrimSpace(mnemonic)
+	return
+}
+
 func GetCurrentDirectory() (dir string, err error) {
 	dir, err = os.Getwd()
 	return
@@ -11,6 +11,7 @@ import (
 	holo "github.com/metacurrency/holochain"
 	"github.com/metacurrency/holochain/cmd"
 	"github.com/urfave/cli"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -24,10 +25,11 @@ func setupApp() (app *cli.App) {
 	app.Usage = "holochain administration tool"
 	app.Version = fmt.Sprintf("0.0.3 (holochain %s)", holo.VersionStr)
 
-	var dumpChain, dumpDHT bool
+	var dumpChain, dumpDHT, recoverAgent bool
 	var root string
 	var service *holo.Service
 	var bridgeToAppData, bridgeFromAppData string
+	var revocationReason string
 
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
@@ -53,20 +55,48 @@ func setupApp() (app *cli.App) {
 			Aliases:   []string{"i"},
 			ArgsUsage: "agent-id",
 			Usage:     "setup the holochain service",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "recover",
+					Usage:       "rebuild the agent's key from its recovery phrase, read from standard input",
+					Destination: &recoverAgent,
+				},
+			},
 			Action: func(c *cli.Context) error {
 				agent := c.Args().First()
 				if agent == "" {
 					return errors.New("missing required agent-id argument to init")
 				}
-				_, err := holo.Init(root, holo.AgentIdentity(agent), nil)
+				var mnemonic string
+				var err error
+				if recoverAgent {
+					mnemonic, err = cmd.ReadMnemonic("Recovery phrase")
+				} else {
+					mnemonic, err = holo.NewMnemonic()
+				}
+				if err != nil {
+					return err
+				}
+				seed, err := holo.MnemonicSeed(mnemonic)
+				if err != nil {
+					return err
+				}
+				_, err = holo.Init(root, holo.AgentIdentity(agent), seed)
 				if err == nil {
 					fmt.Println("Holochain service initialized")
 					if verbose {
 						fmt.Printf("    %s directory created\n", root)
 						fmt.Printf("    defaults stored to %s\n", holo.SysFileName)
-						fmt.Println("    key-pair generated")
+						if recoverAgent {
+							fmt.Println("    key-pair recovered")
+						} else {
+							fmt.Println("    key-pair generated")
+						}
 						fmt.Printf("    default agent stored to %s\n", holo.AgentFileName)
 					}
+					if !recoverAgent {
+						fmt.Printf("Recovery phrase for the agent's key, write it down and keep it safe:\n    %s\n", mnemonic)
+					}
 				}
 				return err
 			},
@@ -210,6 +240,102 @@ func setupApp() (app *cli.App) {
 				return err
 			},
 		},
+		{
+			Name:  "passphrase",
+			Usage: "sets the passphrase that encrypts the agent's private keys, which also encrypts keys saved without one",
+			Action: func(c *cli.Context) error {
+				if service == nil {
+					return cmd.ErrServiceUninitialized
+				}
+				passphrase, err := holo.PassphrasePrompt("New passphrase", true)
+				if err != nil {
+					return fmt.Errorf("passphrase: %v", err)
+				}
+				if len(passphrase) == 0 {
+					return errors.New("passphrase: no new passphrase given")
+				}
+				// each chain keeps a copy of the agent's keys
+				paths := []string{root}
+				files, err := ioutil.ReadDir(root)
+				if err != nil {
+					return fmt.Errorf("passphrase: %v", err)
+				}
+				for _, f := range files {
+					if f.IsDir() && holo.FileExists(root, f.Name(), holo.PrivKeyFileName) {
+						paths = append(paths, filepath.Join(root, f.Name()))
+					}
+				}
+				for _, p := range paths {
+					if err = holo.SetAgentPassphrase(p, passphrase); err != nil {
+						return fmt.Errorf("passphrase: error setting the passphrase of %s: %v", filepath.Join(p, holo.PrivKeyFileName), err)
+					}
+					if verbose {
+						fmt.Printf("encrypted %s\n", filepath.Join(p, holo.PrivKeyFileName))
+					}
+				}
+				fmt.Println("Passphrase set")
+				return nil
+			},
+		},
+		{
+			Name:      "rotate-key",
+			ArgsUsage: "holochain-name",
+			Usage:     "replaces the agent's key for a chain with a new one, committing and broadcasting the revocation of the old key",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "reason",
+					Usage:       "reason for the revocation, recorded in it",
+					Value:       "key rotated",
+					Destination: &revocationReason,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				h, err := cmd.GetHolochain(c.Args().First(), service, "rotate-key")
+				if err != nil {
+					return err
+				}
+				defer h.Close()
+				if !h.Started() {
+					return errors.New("rotate-key: chain not yet initialized")
+				}
+				if revocationReason == "" {
+					return errors.New("rotate-key: the reason can't be empty")
+				}
+				// find peers to broadcast the revocation to
+				if err = h.Activate(); err != nil {
+					return fmt.Errorf("rotate-key: %v", err)
+				}
+				if h.Config.BootstrapServer != "" {
+					holo.BootstrapRefreshTask(h)
+				}
+				// the old recovery phrase rebuilds the revoked key, so the new key gets its own
+				mnemonic, err := holo.NewMnemonic()
+				if err != nil {
+					return err
+				}
+				seed, err := holo.MnemonicSeed(mnemonic)
+				if err != nil {
+					return err
+				}
+				// shown before rotating, so that it isn't lost whatever happens after the
+				// chain has moved on to the new key
+				fmt.Printf("Recovery phrase for the new key, write it down and keep it safe:\n    %s\n", mnemonic)
+				oldNodeID := h.NodeIDStr()
+				a := holo.ActionModAgent{Revocation: revocationReason, Seed: seed}
+				agentHash, err := a.Do(h)
+				if err != nil {
+					return fmt.Errorf("rotate-key: %v", err)
+				}
+				fmt.Printf("Key rotated for %s\n", c.Args().First())
+				if verbose {
+					fmt.Printf("    revoked key: %s\n", oldNodeID)
+					fmt.Printf("    new key: %s\n", h.NodeIDStr())
+					fmt.Printf("    new agent entry: %v\n", agentHash)
+				}
+				fmt.Println("The old recovery phrase is void for this chain.")
+				return nil
+			},
+		},
 		{
 			Name:      "status",
 			Aliases:   []string{"s"},
@@ -222,13 +348,20 @@ func setupApp() (app *cli.App) {
 				if len(c.Args()) == 0 {
 					fmt.Println(service.ListChains())
 				} else if len(c.Args()) == 1 {
-					h, err := cmd.GetHolochain(c.Args().First(), service, "status")
+					// only load the chain, as preparing it would start a node whose
+					// peers would be saved over those of the chain if it's running
+					h, err := service.Load(c.Args().First())
 					if err != nil {
 						return err
 					}
+					defer h.Close()
 					dna := h.Nucleus().DNA()
 					fmt.Printf("Status of %s\n", dna.Name)
-					fmt.Printf("   ---More status info here, no yet implmented---\n")
+					health, err := h.SavedRoutingTableHealth()
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Routing table as last saved: %v", health)
 				} else {
 					return errors.New("status: expected 0 or 1 argument")
 				}
@@ -237,6 +370,8 @@ func setupApp() (app *cli.App) {
 		},
 	}
 
+	holo.PassphrasePrompt = cmd.PromptPassphrase
+
 	app.Before = func(c *cli.Context) error {
 		if debug {
 			os.Setenv("HCLOG_APP_ENABLE", "1")
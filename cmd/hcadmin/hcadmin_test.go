@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	holo "github.com/metacurrency/holochain"
 	"github.com/metacurrency/holochain/cmd"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/urfave/cli"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -33,7 +35,7 @@ func TestInit(t *testing.T) {
 	Convey("after init status should show no chains", t, func() {
 		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "testing-identity"})
 		So(err, ShouldBeNil)
-		So(out, ShouldEqual, "Holochain service initialized\n")
+		So(out, ShouldStartWith, "Holochain service initialized\nRecovery phrase for the agent's key")
 		app = setupApp()
 		out, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-verbose", "-path", d, "status"})
 		So(err, ShouldBeNil)
@@ -70,6 +72,21 @@ func TestJoinFromSourceDir(t *testing.T) {
 		So(out, ShouldContainSubstring, "installed holochains:\n    testApp Qm")
 	})
 	app = setupApp()
+	Convey("status of a chain should show its routing table", t, func() {
+		// as saved by a running node, which status must leave alone
+		peersPath := filepath.Join(d, "testApp", holo.ChainDataDir, holo.PeerStoreFileName)
+		saved := []byte(`{"Version":1}`)
+		err := ioutil.WriteFile(peersPath, saved, 0600)
+		So(err, ShouldBeNil)
+
+		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "status", "testApp"})
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "Routing table as last saved: 0 peers (0 stale)")
+		data, err := ioutil.ReadFile(peersPath)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, string(saved))
+	})
+	app = setupApp()
 	Convey("after join dump -chain should show it", t, func() {
 		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "dump", "-chain", "testApp"})
 		So(err, ShouldBeNil)
@@ -186,3 +203,144 @@ func TestBridge(t *testing.T) {
 func runAppWithStdoutCapture(app *cli.App, args []string) (out string, err error) {
 	return cmd.RunAppWithStdoutCapture(app, args, time.Second*5)
 }
+
+func TestPassphrase(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer os.RemoveAll(d)
+	app := setupApp()
+	_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should encrypt the agent's private key with the new passphrase", t, func() {
+		app = setupApp()
+		holo.PassphrasePrompt = func(prompt string, confirm bool) ([]byte, error) {
+			return []byte("secret"), nil
+		}
+		defer func() { holo.PassphrasePrompt = nil }()
+		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "passphrase"})
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "Passphrase set\n")
+		k, err := holo.ReadFile(d, holo.PrivKeyFileName)
+		So(err, ShouldBeNil)
+		So(holo.IsEncryptedKey(k), ShouldBeTrue)
+
+		os.Setenv(holo.PassphraseEnvVar, "secret")
+		defer os.Unsetenv(holo.PassphraseEnvVar)
+		_, err = holo.LoadAgent(d)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestInitRecover(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer os.RemoveAll(d)
+	app := setupApp()
+	out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+	if err != nil {
+		panic(err)
+	}
+	mnemonic := regexp.MustCompile(`\n    (.*)\n$`).FindStringSubmatch(out)[1]
+	k, _ := holo.ReadFile(d, holo.PrivKeyFileName)
+
+	Convey("it should rebuild the same key from the recovery phrase", t, func() {
+		r := holo.SetupTestDir()
+		defer os.RemoveAll(r)
+		stdin := os.Stdin
+		defer func() { os.Stdin = stdin }()
+		f, err := os.Create(filepath.Join(r, "phrase"))
+		So(err, ShouldBeNil)
+		f.WriteString(mnemonic + "\n")
+		f.Seek(0, 0)
+		defer f.Close()
+		os.Stdin = f
+
+		root := filepath.Join(r, "recovered")
+		app = setupApp()
+		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", root, "init", "--recover", "test-identity"})
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "Holochain service initialized\n")
+		rk, err := holo.ReadFile(root, holo.PrivKeyFileName)
+		So(err, ShouldBeNil)
+		So(string(rk), ShouldEqual, string(k))
+	})
+
+	Convey("it should refuse a bad recovery phrase", t, func() {
+		r := holo.SetupTestDir()
+		defer os.RemoveAll(r)
+		stdin := os.Stdin
+		defer func() { os.Stdin = stdin }()
+		f, err := os.Create(filepath.Join(r, "phrase"))
+		So(err, ShouldBeNil)
+		f.WriteString("not a recovery phrase\n")
+		f.Seek(0, 0)
+		defer f.Close()
+		os.Stdin = f
+
+		root := filepath.Join(r, "recovered")
+		app = setupApp()
+		_, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-path", root, "init", "--recover", "test-identity"})
+		So(err, ShouldEqual, holo.ErrBadMnemonic)
+		So(holo.FileExists(root, holo.PrivKeyFileName), ShouldBeFalse)
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer os.RemoveAll(d)
+	app := setupApp()
+	_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+	if err != nil {
+		panic(err)
+	}
+	hcdev := filepath.Join(os.Getenv("GOPATH"), "/bin/hcdev")
+	err = cmd.OsExecSilent(hcdev, "-path", d, "init", "-test", "testAppSrc")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOLOCHAINCONFIG_BOOTSTRAP", "_")
+	defer os.Unsetenv("HOLOCHAINCONFIG_BOOTSTRAP")
+	app = setupApp()
+	_, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "join", filepath.Join(d, "testAppSrc"), "testApp"})
+	if err != nil {
+		panic(err)
+	}
+	oldAgent, err := holo.LoadAgent(d)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should revoke the chain's key and save the new one", t, func() {
+		app = setupApp()
+		out, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "rotate-key", "testApp"})
+		So(err, ShouldBeNil)
+		So(out, ShouldStartWith, "Recovery phrase for the new key, write it down and keep it safe:\n    ")
+		So(out, ShouldContainSubstring, "\nKey rotated for testApp\n")
+		So(out, ShouldEndWith, "\nThe old recovery phrase is void for this chain.\n")
+		mnemonic := regexp.MustCompile(`keep it safe:\n    (.*)\n`).FindStringSubmatch(out)[1]
+
+		agent, err := holo.LoadAgent(filepath.Join(d, "testApp"))
+		So(err, ShouldBeNil)
+		So(agent.Identity(), ShouldEqual, oldAgent.Identity())
+		So(ic.KeyEqual(agent.PrivKey(), oldAgent.PrivKey()), ShouldBeFalse)
+
+		// the new recovery phrase rebuilds the new key
+		seed, err := holo.MnemonicSeed(mnemonic)
+		So(err, ShouldBeNil)
+		recovered := holo.LibP2PAgent{}
+		So(recovered.GenKeys(seed), ShouldBeNil)
+		So(ic.KeyEqual(agent.PrivKey(), recovered.PrivKey()), ShouldBeTrue)
+
+		// the service's key, used by other chains, is left alone
+		a, err := holo.LoadAgent(d)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), oldAgent.PrivKey()), ShouldBeTrue)
+	})
+
+	Convey("it should fail for chains that don't exist", t, func() {
+		app = setupApp()
+		_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "rotate-key", "noSuchApp"})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -51,6 +51,8 @@ func setupApp() (app *cli.App) {
 		},
 	}
 
+	holo.PassphrasePrompt = cmd.PromptPassphrase
+
 	app.Before = func(c *cli.Context) error {
 		// for hcd the -debug flag enables the app level debugging
 		if debug {
@@ -32,6 +32,9 @@ const (
 	bridgeFromPort     = "21111"
 	bridgeToPort       = "21112"
 	scenarioStartDelay = 1
+
+	apiTypingsFileName   = "holochain.d.ts"
+	apiReferenceFileName = "API.md"
 )
 
 var debug, appInitialized, verbose, keepalive bool
@@ -811,8 +814,37 @@ func setupApp() (app *cli.App) {
 				return nil
 			},
 		},
+
+		{
+			Name:      "apidocs",
+			ArgsUsage: "[output dir]",
+			Usage:     fmt.Sprintf("writes the TypeScript typings (%s) and Markdown reference (%s) of the zome API to a directory, or the current one", apiTypingsFileName, apiReferenceFileName),
+			Action: func(c *cli.Context) error {
+				dir := "."
+				if len(c.Args()) > 0 {
+					dir = c.Args().First()
+				}
+				// the files are generated, so overwrite any from an earlier version
+				err := os.MkdirAll(dir, os.ModePerm)
+				if err == nil {
+					err = ioutil.WriteFile(filepath.Join(dir, apiTypingsFileName), []byte(holo.APITypeScript()), 0644)
+				}
+				if err == nil {
+					err = ioutil.WriteFile(filepath.Join(dir, apiReferenceFileName), []byte(holo.APIMarkdown()), 0644)
+				}
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				if verbose {
+					fmt.Printf("wrote %s and %s to %s\n", apiTypingsFileName, apiReferenceFileName, dir)
+				}
+				return nil
+			},
+		},
 	}
 
+	holo.PassphrasePrompt = cmd.PromptPassphrase
+
 	app.Before = func(c *cli.Context) error {
 		holo.IsDevMode = true
 		lastRunContext = c
@@ -239,6 +239,27 @@ func TestWeb(t *testing.T) {
 	})
 }
 
+func TestAPIDocs(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer os.RemoveAll(d)
+	Convey("'apidocs' should write the typings and reference without an app", t, func() {
+		app := setupApp()
+		_, err := cmd.RunAppWithStdoutCapture(app, []string{"hcdev", "-execpath", filepath.Join(d, "exec"), "apidocs", filepath.Join(d, "docs")}, 2*time.Second)
+		So(err, ShouldBeNil)
+		ts, err := holo.ReadFile(d, "docs", apiTypingsFileName)
+		So(err, ShouldBeNil)
+		So(string(ts), ShouldEqual, holo.APITypeScript())
+		md, err := holo.ReadFile(d, "docs", apiReferenceFileName)
+		So(err, ShouldBeNil)
+		So(string(md), ShouldEqual, holo.APIMarkdown())
+	})
+	Convey("'apidocs' should replace files from an earlier run", t, func() {
+		app := setupApp()
+		_, err := cmd.RunAppWithStdoutCapture(app, []string{"hcdev", "-execpath", filepath.Join(d, "exec"), "apidocs", filepath.Join(d, "docs")}, 2*time.Second)
+		So(err, ShouldBeNil)
+	})
+}
+
 func TestIdenity(t *testing.T) {
 	os.Setenv("HC_TESTING", "true")
 	tmpTestDir, app := setupTestingApp("foo")
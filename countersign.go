@@ -0,0 +1,308 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// countersigning implements entries that several agents sign together, in two phases so
+// that no party commits an entry that not every party signed.  First the proposer sends the
+// proposed entry to each of the other parties with send, and each of them answers with its
+// signature if the onCountersignProposal callback of the entry type's zome agrees to and
+// the entry validates, without committing it.
+// Once every party signed, the proposer commits the entry and sends the resulting
+// CountersignWarrant with the proposal to the other parties, each of which commits the entry
+// and then gives the warrant to its zomes in the onCountersigned callback.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"reflect"
+	"time"
+)
+
+// countersignZomeType is the zome type of the app messages of the countersigning protocol,
+// which are handled by holochain instead of a zome's receive callback
+const countersignZomeType = "%countersign"
+
+var ErrNotCountersignParty = errors.New("not a party to the countersignature")
+var ErrCountersignRefused = errors.New("countersignature refused")
+var ErrCountersignHeld = errors.New("countersigning messages can't be held")
+
+// CountersignOptions are the options of the countersign host function
+type CountersignOptions struct {
+	Parties []string // node ids of the other agents who sign the entry
+	Timeout int      // milliseconds to wait for each of them to sign
+}
+
+// CountersignProposal is an entry proposed for countersigning
+type CountersignProposal struct {
+	EntryType string
+	Entry     string
+	Parties   []string // node ids of the parties, the proposer first
+}
+
+// countersignMsg is the body of the countersigning messages, which either asks the recipient
+// to sign a proposal or gives it the warrant, with the proposal, once all the parties signed
+type countersignMsg struct {
+	Proposal *CountersignProposal `json:",omitempty"`
+	Warrant  []byte               `json:",omitempty"`
+}
+
+// countersignSig is a party's answer to a proposal
+type countersignSig struct {
+	Key []byte
+	Sig []byte
+}
+
+// sendCountersign sends a countersigning message to a party and returns the body of its
+// response.  Unlike app messages, these are never held for parties that can't be reached.
+func (h *Holochain) sendCountersign(to peer.ID, m countersignMsg, timeout time.Duration) (body string, err error) {
+	var j []byte
+	j, err = json.Marshal(m)
+	if err != nil {
+		return
+	}
+	var msg AppMsg
+	msg, err = h.sealAppMsg(to, AppMsg{ZomeType: countersignZomeType, Body: string(j)})
+	if err != nil {
+		return
+	}
+	var r interface{}
+	r, err = h.Send(h.node.ctx, ActionProtocol, to, h.node.NewMessage(APP_MESSAGE, msg), timeout)
+	if err != nil {
+		return
+	}
+	var rsp AppMsg
+	rsp, err = h.openAppMsg(r.(AppMsg))
+	if err == nil {
+		body = rsp.Body
+	}
+	return
+}
+
+// receiveCountersign handles a countersigning message from another node.  from must be the
+// peer of the stream the message came in on, which the node checks against the message's
+// source, so that no one can propose or hand on a countersignature in another's name.
+func (h *Holochain) receiveCountersign(from peer.ID, body string) (response string, err error) {
+	var m countersignMsg
+	if err = json.Unmarshal([]byte(body), &m); err != nil {
+		return
+	}
+	if m.Proposal == nil {
+		err = errors.New("countersigning message without a proposal")
+		return
+	}
+	if m.Warrant == nil {
+		response, err = h.signProposal(from, m.Proposal)
+		return
+	}
+	err = h.commitCountersigned(from, m.Proposal, m.Warrant)
+	return
+}
+
+// commitCountersigned commits a proposed entry once the warrant shows that every party,
+// including us, signed it
+func (h *Holochain) commitCountersigned(from peer.ID, p *CountersignProposal, data []byte) (err error) {
+	w := &CountersignWarrant{}
+	if err = w.Decode(data); err != nil {
+		return
+	}
+	if err = w.Verify(h); err != nil {
+		return
+	}
+	if w.Signers[0] != peer.IDB58Encode(from) {
+		err = errors.New("countersignature not from its proposer")
+		return
+	}
+	var ours bool
+	for _, party := range w.Signers[1:] {
+		ours = ours || party == h.nodeIDStr
+	}
+	if !ours {
+		err = ErrNotCountersignParty
+		return
+	}
+	entry := &GobEntry{C: p.Entry}
+	var hash Hash
+	hash, err = entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if p.EntryType != w.EntryType || hash.String() != w.EntryHash || !reflect.DeepEqual(p.Parties, w.Signers) {
+		err = errors.New("countersignature doesn't match its proposal")
+		return
+	}
+	if _, err = NewCommitAction(p.EntryType, entry).Do(h); err != nil {
+		return
+	}
+	h.nucleus.DispatchHook(CountersignedHook, w.EntryHash, string(data))
+	return
+}
+
+// signProposal returns our signature of the proposed entry, if the app agrees to sign it
+// and it validates, without committing it
+func (h *Holochain) signProposal(from peer.ID, p *CountersignProposal) (response string, err error) {
+	proposer := peer.IDB58Encode(from)
+	if len(p.Parties) < 2 || p.Parties[0] != proposer {
+		err = errors.New("countersignature not proposed by its first party")
+		return
+	}
+	var ours bool
+	for _, party := range p.Parties[1:] {
+		ours = ours || party == h.nodeIDStr
+	}
+	if !ours {
+		err = ErrNotCountersignParty
+		return
+	}
+
+	// committing isn't consent, as validation only says the entry may exist, so the zome
+	// of the entry type must agree to sign it
+	var zome *Zome
+	zome, _, err = h.GetEntryDef(p.EntryType)
+	if err != nil {
+		return
+	}
+	if zome == nil {
+		err = ErrCountersignRefused
+		return
+	}
+	var rib Ribosome
+	var release func()
+	rib, _, release, err = h.GetRibosome(zome.Name)
+	if err != nil {
+		return
+	}
+	var agreed bool
+	agreed, err = rib.BoolHook(CountersignProposalHook, proposer, p.EntryType, p.Entry)
+	release()
+	if err != nil {
+		return
+	}
+	if !agreed {
+		err = ErrCountersignRefused
+		return
+	}
+
+	// check that we could commit the entry once everyone signed
+	entry := &GobEntry{C: p.Entry}
+	if _, err = h.ValidateAction(NewCommitAction(p.EntryType, entry), p.EntryType, nil, []peer.ID{h.nodeID}); err != nil {
+		return
+	}
+	var hash Hash
+	hash, err = entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	w := &CountersignWarrant{EntryType: p.EntryType, EntryHash: hash.String(), Signers: p.Parties}
+	if err = w.sign(h.agent.PrivKey()); err != nil {
+		return
+	}
+	var j []byte
+	j, err = json.Marshal(countersignSig{Key: w.Keys[0], Sig: w.Sigs[0]})
+	if err == nil {
+		response = string(j)
+	}
+	return
+}
+
+//------------------------------------------------------------
+// Countersign
+
+type ActionCountersign struct {
+	entryType string
+	entry     string
+	parties   []peer.ID
+	timeout   time.Duration
+}
+
+func NewCountersignAction(entryType string, entry string, parties []peer.ID) *ActionCountersign {
+	a := ActionCountersign{entryType: entryType, entry: entry, parties: parties}
+	return &a
+}
+
+func (a *ActionCountersign) Name() string {
+	return "countersign"
+}
+
+func (a *ActionCountersign) Args() []Arg {
+	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(CountersignOptions{})}}
+}
+
+// Do has the other parties sign the entry and once they all did commits it, has them commit
+// it too and returns the warrant of their signatures
+func (a *ActionCountersign) Do(h *Holochain) (response interface{}, err error) {
+	if len(a.parties) == 0 {
+		err = errors.New("countersign needs at least one other party")
+		return
+	}
+	w := &CountersignWarrant{EntryType: a.entryType, Signers: []string{h.nodeIDStr}}
+	for _, id := range a.parties {
+		party := peer.IDB58Encode(id)
+		for _, p := range w.Signers {
+			if p == party {
+				err = fmt.Errorf("%s is a party to the countersignature more than once", party)
+				return
+			}
+		}
+		w.Signers = append(w.Signers, party)
+	}
+
+	// check that we would commit the entry before asking anyone else to
+	entry := &GobEntry{C: a.entry}
+	if _, err = h.ValidateAction(NewCommitAction(a.entryType, entry), a.entryType, nil, []peer.ID{h.nodeID}); err != nil {
+		return
+	}
+	var hash Hash
+	hash, err = entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	w.EntryHash = hash.String()
+	if err = w.sign(h.agent.PrivKey()); err != nil {
+		return
+	}
+
+	proposal := &CountersignProposal{EntryType: a.entryType, Entry: a.entry, Parties: w.Signers}
+	for _, id := range a.parties {
+		var body string
+		body, err = h.sendCountersign(id, countersignMsg{Proposal: proposal}, a.timeout)
+		if err != nil {
+			err = fmt.Errorf("%s didn't countersign: %v", peer.IDB58Encode(id), err)
+			return
+		}
+		var sig countersignSig
+		if err = json.Unmarshal([]byte(body), &sig); err != nil {
+			return
+		}
+		w.Keys = append(w.Keys, sig.Key)
+		w.Sigs = append(w.Sigs, sig.Sig)
+	}
+	if err = w.Verify(h); err != nil {
+		return
+	}
+
+	if _, err = NewCommitAction(a.entryType, entry).Do(h); err != nil {
+		return
+	}
+	var data []byte
+	data, err = w.Encode()
+	if err != nil {
+		return
+	}
+	for _, id := range a.parties {
+		if _, e := h.sendCountersign(id, countersignMsg{Proposal: proposal, Warrant: data}, a.timeout); e != nil {
+			h.Debugf("unable to have %v commit the countersigned entry: %v", id, e)
+		}
+	}
+	response = w
+	return
+}
+
+func (a *ActionCountersign) Receive(dht *DHT, msg *Message, retries int) (response interface{}, err error) {
+	err = NonDHTAction
+	return
+}
@@ -0,0 +1,134 @@
+package holochain
+
+import (
+	"encoding/json"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestActionCountersign(t *testing.T) {
+	nodesCount := 3
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	ringConnectMutual(t, mt.ctx, nodes, nodesCount)
+
+	h1 := nodes[0]
+	h2 := nodes[1]
+
+	Convey("it should commit the entry on the chains of all the parties", t, func() {
+		r, err := NewCountersignAction("oddNumbers", "7", []peer.ID{h2.nodeID}).Do(h1)
+		So(err, ShouldBeNil)
+		w := r.(*CountersignWarrant)
+		So(w.Verify(h1), ShouldBeNil)
+		So(w.Signers, ShouldResemble, []string{h1.nodeIDStr, h2.nodeIDStr})
+
+		hash, _ := NewHash(w.EntryHash)
+		entry, entryType, err := h1.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+		So(entry.Content(), ShouldEqual, "7")
+		entry, _, err = h2.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entry.Content(), ShouldEqual, "7")
+	})
+
+	Convey("it should fail without asking anyone if the entry isn't valid", t, func() {
+		_, err := NewCountersignAction("oddNumbers", "4", []peer.ID{h2.nodeID}).Do(h1)
+		So(err, ShouldEqual, ValidationFailedErr)
+	})
+
+	Convey("it should reject bad parties", t, func() {
+		_, err := NewCountersignAction("oddNumbers", "9", nil).Do(h1)
+		So(err.Error(), ShouldEqual, "countersign needs at least one other party")
+		_, err = NewCountersignAction("oddNumbers", "9", []peer.ID{h2.nodeID, h2.nodeID}).Do(h1)
+		So(err.Error(), ShouldEndWith, "is a party to the countersignature more than once")
+		_, err = NewCountersignAction("oddNumbers", "9", []peer.ID{h1.nodeID}).Do(h1)
+		So(err.Error(), ShouldEndWith, "is a party to the countersignature more than once")
+	})
+}
+
+func TestReceiveCountersign(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	proposer, proposerKey := makePeer("proposer")
+	other, _ := makePeer("other")
+
+	propose := func(from peer.ID, parties ...string) (string, error) {
+		j, _ := json.Marshal(countersignMsg{Proposal: &CountersignProposal{EntryType: "oddNumbers", Entry: "11", Parties: parties}})
+		return h.receiveCountersign(from, string(j))
+	}
+
+	Convey("it should only sign proposals from their first party", t, func() {
+		_, err := propose(other, peer.IDB58Encode(proposer), h.nodeIDStr)
+		So(err.Error(), ShouldEqual, "countersignature not proposed by its first party")
+	})
+
+	Convey("it should only sign proposals it is a party to", t, func() {
+		_, err := propose(proposer, peer.IDB58Encode(proposer), peer.IDB58Encode(other))
+		So(err, ShouldEqual, ErrNotCountersignParty)
+	})
+
+	Convey("it should only sign proposals its app agrees to", t, func() {
+		top := h.chain.Top().EntryLink
+		j, _ := json.Marshal(countersignMsg{Proposal: &CountersignProposal{EntryType: "oddNumbers", Entry: "13", Parties: []string{peer.IDB58Encode(proposer), h.nodeIDStr}}})
+		_, err := h.receiveCountersign(proposer, string(j))
+		So(err, ShouldEqual, ErrCountersignRefused)
+		So(h.chain.Top().EntryLink.String(), ShouldEqual, top.String())
+
+		// zomes that don't define the callback never agree
+		j, _ = json.Marshal(countersignMsg{Proposal: &CountersignProposal{EntryType: "evenNumbers", Entry: "2", Parties: []string{peer.IDB58Encode(proposer), h.nodeIDStr}}})
+		_, err = h.receiveCountersign(proposer, string(j))
+		So(err, ShouldEqual, ErrCountersignRefused)
+	})
+
+	Convey("it should sign the proposed entry without committing it", t, func() {
+		top := h.chain.Top().EntryLink
+		rsp, err := propose(proposer, peer.IDB58Encode(proposer), h.nodeIDStr)
+		So(err, ShouldBeNil)
+		var sig countersignSig
+		So(json.Unmarshal([]byte(rsp), &sig), ShouldBeNil)
+		So(h.chain.Top().EntryLink.String(), ShouldEqual, top.String())
+
+		hash, _ := (&GobEntry{C: "11"}).Sum(h.hashSpec)
+		w := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: hash.String(), Signers: []string{peer.IDB58Encode(proposer), h.nodeIDStr}}
+		data, _ := countersignData(w.EntryType, w.EntryHash, w.Signers)
+		matches, err := h.agent.PubKey().Verify(data, sig.Sig)
+		So(err, ShouldBeNil)
+		So(matches, ShouldBeTrue)
+	})
+
+	parties := []string{peer.IDB58Encode(proposer), h.nodeIDStr}
+	proposal := &CountersignProposal{EntryType: "oddNumbers", Entry: "11", Parties: parties}
+	hash, _ := (&GobEntry{C: "11"}).Sum(h.hashSpec)
+	w := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: hash.String(), Signers: parties}
+	w.sign(proposerKey)
+	w.sign(h.agent.PrivKey())
+	warrant, _ := w.Encode()
+
+	Convey("it should only commit the entry of the proposal the warrant is for", t, func() {
+		top := h.chain.Top().EntryLink
+		other := &CountersignProposal{EntryType: "oddNumbers", Entry: "15", Parties: parties}
+		j, _ := json.Marshal(countersignMsg{Proposal: other, Warrant: warrant})
+		_, err := h.receiveCountersign(proposer, string(j))
+		So(err.Error(), ShouldEqual, "countersignature doesn't match its proposal")
+		So(h.chain.Top().EntryLink.String(), ShouldEqual, top.String())
+	})
+
+	Convey("it should commit the proposed entry once given the warrant", t, func() {
+		j, _ := json.Marshal(countersignMsg{Proposal: proposal, Warrant: warrant})
+		_, err := h.receiveCountersign(proposer, string(j))
+		So(err, ShouldBeNil)
+		So(h.chain.Top().EntryLink.String(), ShouldEqual, hash.String())
+	})
+
+	Convey("warrants signed with a revoked key should not verify", t, func() {
+		So(w.Verify(h), ShouldBeNil)
+		So(h.dht.revokeKey(proposer, time.Now()), ShouldBeNil)
+		So(w.Verify(h), ShouldEqual, ErrCountersignKeyRevoked)
+	})
+}
@@ -41,7 +41,8 @@ type DHTConfig struct {
 
 	// DataEncryption : What are the options for encrypting data at rest in the dht.db that don't break db functionality? Is there really a point to trying to do this?
 
-	// MaxEntrySize : Sets the maximum allowable size of entries for this holochain
+	// MaxEntrySize : (integer) Sets the maximum allowable size in bytes of entries for this holochain. ZERO means no limit other than the network's MaxMessageSize.
+	MaxEntrySize int `json:",omitempty" toml:",omitzero"`
 }
 
 type gossipWithReq struct {
@@ -94,6 +95,7 @@ const (
 	StatusRejected = 0x02
 	StatusDeleted  = 0x04
 	StatusModified = 0x08
+	StatusWarning  = 0x10
 	StatusAny      = 0xFF
 
 	// constants for the stored string status values in buntdb and for building code
@@ -102,6 +104,7 @@ const (
 	StatusRejectedVal = "2"
 	StatusDeletedVal  = "4"
 	StatusModifiedVal = "8"
+	StatusWarningVal  = "16"
 	StatusAnyVal      = "255"
 
 	// constants for system reseved tags (start with 2 underscores)
@@ -436,7 +439,7 @@ func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 				err = ErrHashModified
 			case StatusRejectedVal:
 				err = ErrHashRejected
-			case StatusLiveVal:
+			case StatusLiveVal, StatusWarningVal:
 			default:
 				panic("unknown status!")
 			}
@@ -579,7 +582,8 @@ func _link(tx *buntdb.Tx, base string, link string, tag string, src peer.ID, sta
 
 func (dht *DHT) link(m *Message, base string, link string, tag string, status int) (err error) {
 	err = dht.db.Update(func(tx *buntdb.Tx) error {
-		_, err := _get(tx, base, StatusLive)
+		// bases held from an agent whose key was later revoked are still live
+		_, err := _get(tx, base, StatusLive+StatusWarning)
 		if err != nil {
 			return err
 		}
@@ -629,7 +633,7 @@ func (dht *DHT) getLinks(base Hash, tag string, statusMask int) (results []Tagge
 	dht.dlog.Logf("getLinks on %v of %s with mask %d", base, tag, statusMask)
 	b := base.String()
 	err = dht.db.View(func(tx *buntdb.Tx) error {
-		_, err := _get(tx, b, StatusLive+StatusModified) //only get links on live and modified bases
+		_, err := _get(tx, b, StatusLive+StatusWarning+StatusModified) //only get links on live (including warned) and modified bases
 		if err != nil {
 			return err
 		}
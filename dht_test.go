@@ -701,6 +701,93 @@ func TestActionReceiver(t *testing.T) {
 
 	})
 
+	Convey("LISTADD_REQUEST should only take warrants against the listed peers that imply the list", t, func() {
+		pid, oldPrivKey := makePeer("testPeer")
+		newPid, newPrivKey := makePeer("peer1")
+		revocation, _ := NewSelfRevocation(oldPrivKey, newPrivKey, []byte("extra data"))
+		w, _ := NewSelfRevocationWarrant(revocation)
+		data, _ := w.Encode()
+		listAdd := func(listType string, p peer.ID, warrantType int, data []byte) error {
+			m := h.node.NewMessage(LISTADD_REQUEST,
+				ListAddReq{
+					ListType:    listType,
+					Peers:       []string{peer.IDB58Encode(p)},
+					WarrantType: warrantType,
+					Warrant:     data,
+				})
+			_, err := ActionReceiver(h, m)
+			return err
+		}
+		err := listAdd(BlockedList, newPid, SelfRevocationType, data)
+		So(err.Error(), ShouldEqual, fmt.Sprintf("%s: %v is not the revoked key", prefix, newPid))
+		err = listAdd(WarrantedList, pid, SelfRevocationType, data)
+		So(err.Error(), ShouldEqual, prefix+": warranted list requires an invalid entry warrant")
+		err = listAdd("somelist", pid, SelfRevocationType, data)
+		So(err.Error(), ShouldEqual, prefix+": unknown list type: somelist")
+
+		cw := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: h.nodeIDStr, Signers: []string{peer.IDB58Encode(pid), h.nodeIDStr}}
+		data, _ = cw.Encode()
+		err = listAdd(BlockedList, pid, CountersignType, data)
+		So(err.Error(), ShouldEqual, prefix+": blocked list requires a self revocation or invalid entry warrant")
+	})
+
+	Convey("LISTADD_REQUEST of warranted list should add the author of an invalid entry", t, func() {
+		pid, privKey := makePeer("testPeer")
+		entry := &GobEntry{C: "4"}
+		_, header, _ := newHeader(h.hashSpec, time.Now(), "oddNumbers", entry, privKey, NullHash(), NullHash(), nil)
+		w, _ := NewInvalidEntryWarrant(pid, privKey.GetPublic(), "oddNumbers", header, entry, &Package{})
+		data, _ := w.Encode()
+
+		other, _ := makePeer("peer1")
+		m := h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType:    WarrantedList,
+				Peers:       []string{peer.IDB58Encode(other)},
+				WarrantType: InvalidEntryType,
+				Warrant:     data,
+			})
+		_, err := ActionReceiver(h, m)
+		So(err.Error(), ShouldEndWith, "is not the author of the warranted entry")
+
+		m = h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType:    WarrantedList,
+				Peers:       []string{peer.IDB58Encode(pid)},
+				WarrantType: InvalidEntryType,
+				Warrant:     data,
+			})
+		r, err := ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, DHTChangeOK)
+		peerList, err := h.dht.getList(WarrantedList)
+		So(err, ShouldBeNil)
+		So(len(peerList.Records), ShouldEqual, 1)
+		So(peerList.Records[0].ID, ShouldEqual, pid)
+		So(peerList.Records[0].Warrant, ShouldEqual, string(data))
+		So(h.node.IsBlocked(pid), ShouldBeFalse)
+
+		Convey("but not block it if validation isn't strict", func() {
+			h.Config.AutoBlockWarranted = true
+			defer func() { h.Config.AutoBlockWarranted = false }()
+			_, err := ActionReceiver(h, m)
+			So(err, ShouldBeNil)
+			So(h.node.IsBlocked(pid), ShouldBeFalse)
+		})
+
+		Convey("and block it if configured to and validation is strict", func() {
+			h.Config.AutoBlockWarranted = true
+			h.nucleus.dna.StrictValidation = true
+			defer func() { h.Config.AutoBlockWarranted = false; h.nucleus.dna.StrictValidation = false }()
+			_, err := ActionReceiver(h, m)
+			So(err, ShouldBeNil)
+			So(h.node.IsBlocked(pid), ShouldBeTrue)
+			peerList, err := h.dht.getList(BlockedList)
+			So(err, ShouldBeNil)
+			So(len(peerList.Records), ShouldEqual, 1)
+			So(peerList.Records[0].ID, ShouldEqual, pid)
+		})
+	})
+
 	/*
 		getting a good warrant without also having already had the addToList happen is hard,
 		 so not quite sure how to test this
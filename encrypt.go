@@ -0,0 +1,144 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// encryption of data to an agent's key.  Agent keys are Ed25519 signing keys, so they are
+// converted to their X25519 equivalents and used with an ephemeral sender key in a nacl box.
+
+package holochain
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"golang.org/x/crypto/nacl/box"
+	"io"
+)
+
+const (
+	sealedKeySize   = 32
+	sealedNonceSize = 24
+)
+
+var ErrKeyNotEncryptable = errors.New("key type doesn't support encryption")
+var ErrDecryptionFailed = errors.New("decryption failed")
+var ErrKeyNotAgents = errors.New("key entry doesn't match the agent's id")
+
+// EncryptFor seals data so that only the holder of the private key matching pub can open it.
+// The result is the ephemeral public key, the nonce and the box.
+func EncryptFor(pub ic.PubKey, data []byte) (sealed []byte, err error) {
+	k, ok := pub.(*ic.Ed25519PublicKey)
+	if !ok {
+		err = ErrKeyNotEncryptable
+		return
+	}
+	var peerKey *[32]byte
+	peerKey, err = k.ToCurve25519()
+	if err != nil {
+		return
+	}
+	ephemeralPub, ephemeralPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	var nonce [sealedNonceSize]byte
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return
+	}
+	sealed = append(sealed, ephemeralPub[:]...)
+	sealed = append(sealed, nonce[:]...)
+	sealed = box.Seal(sealed, data, &nonce, peerKey, ephemeralPriv)
+	return
+}
+
+// Decrypt opens data sealed with EncryptFor to the public key of priv
+func Decrypt(priv ic.PrivKey, sealed []byte) (data []byte, err error) {
+	k, ok := priv.(*ic.Ed25519PrivateKey)
+	if !ok {
+		err = ErrKeyNotEncryptable
+		return
+	}
+	if len(sealed) < sealedKeySize+sealedNonceSize+box.Overhead {
+		err = ErrDecryptionFailed
+		return
+	}
+	var ephemeralPub [sealedKeySize]byte
+	var nonce [sealedNonceSize]byte
+	copy(ephemeralPub[:], sealed[:sealedKeySize])
+	copy(nonce[:], sealed[sealedKeySize:sealedKeySize+sealedNonceSize])
+	data, ok = box.Open(nil, sealed[sealedKeySize+sealedNonceSize:], &nonce, &ephemeralPub, k.ToCurve25519())
+	if !ok {
+		err = ErrDecryptionFailed
+	}
+	return
+}
+
+// agentPubKey returns the public key of an agent, as held in the peerstore for peers
+// we've connected to, or otherwise from the DHT
+func (h *Holochain) agentPubKey(id peer.ID) (key ic.PubKey, err error) {
+	if id == h.nodeID {
+		key = h.agent.PubKey()
+		return
+	}
+	if node := h.node; node != nil {
+		if k := node.peerstore.PubKey(id); k != nil && id.MatchesPublicKey(k) {
+			key = k
+			return
+		}
+	}
+	req := GetReq{H: HashFromPeerID(id), StatusMask: StatusLive, GetMask: GetMaskEntry}
+	var r interface{}
+	r, err = NewGetAction(req, &GetOptions{StatusMask: StatusLive, GetMask: GetMaskEntry}).Do(h)
+	if err != nil {
+		return
+	}
+	data, ok := r.(GetResp).Entry.C.([]byte)
+	if !ok {
+		err = fmt.Errorf("unexpected key entry for %v", id)
+		return
+	}
+	key, err = ic.UnmarshalPublicKey(data)
+	if err != nil {
+		return
+	}
+	// anyone can put an entry at an agent's hash, so only trust the key the id derives from
+	var keyID peer.ID
+	keyID, err = peer.IDFromPublicKey(key)
+	if err == nil && keyID != id {
+		key = nil
+		err = ErrKeyNotAgents
+	}
+	return
+}
+
+// sealAppMsg encrypts the body of an app message to the recipient
+func (h *Holochain) sealAppMsg(to peer.ID, msg AppMsg) (sealed AppMsg, err error) {
+	var key ic.PubKey
+	key, err = h.agentPubKey(to)
+	if err != nil {
+		return
+	}
+	sealed.ZomeType = msg.ZomeType
+	sealed.Sealed, err = EncryptFor(key, []byte(msg.Body))
+	return
+}
+
+// openAppMsg decrypts the body of an app message sealed to us, passing unsealed
+// messages through as is
+func (h *Holochain) openAppMsg(msg AppMsg) (opened AppMsg, err error) {
+	if len(msg.Sealed) == 0 {
+		opened = msg
+		return
+	}
+	var body []byte
+	body, err = Decrypt(h.agent.PrivKey(), msg.Sealed)
+	if err != nil {
+		return
+	}
+	opened = AppMsg{ZomeType: msg.ZomeType, Body: string(body)}
+	return
+}
@@ -0,0 +1,104 @@
+package holochain
+
+import (
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEncryptFor(t *testing.T) {
+	_, key := makePeer("recipient")
+	_, other := makePeer("other")
+	data := []byte("some secret data")
+
+	Convey("it should encrypt data that only the recipient can decrypt", t, func() {
+		sealed, err := EncryptFor(key.GetPublic(), data)
+		So(err, ShouldBeNil)
+		So(string(sealed), ShouldNotContainSubstring, string(data))
+
+		plain, err := Decrypt(key, sealed)
+		So(err, ShouldBeNil)
+		So(string(plain), ShouldEqual, string(data))
+
+		_, err = Decrypt(other, sealed)
+		So(err, ShouldEqual, ErrDecryptionFailed)
+	})
+
+	Convey("it should use a fresh key each time", t, func() {
+		s1, _ := EncryptFor(key.GetPublic(), data)
+		s2, _ := EncryptFor(key.GetPublic(), data)
+		So(string(s1), ShouldNotEqual, string(s2))
+	})
+
+	Convey("it should fail on tampered or truncated data", t, func() {
+		sealed, _ := EncryptFor(key.GetPublic(), data)
+		sealed[len(sealed)-1] ^= 1
+		_, err := Decrypt(key, sealed)
+		So(err, ShouldEqual, ErrDecryptionFailed)
+		_, err = Decrypt(key, sealed[:10])
+		So(err, ShouldEqual, ErrDecryptionFailed)
+	})
+}
+
+func TestSealedAppMessages(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should seal app message bodies to the recipient", t, func() {
+		sealed, err := h.sealAppMsg(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		So(err, ShouldBeNil)
+		So(sealed.Body, ShouldEqual, "")
+		So(sealed.ZomeType, ShouldEqual, "jsSampleZome")
+
+		opened, err := h.openAppMsg(sealed)
+		So(err, ShouldBeNil)
+		So(opened.Body, ShouldEqual, `{"ping":"foobar"}`)
+	})
+
+	Convey("it should pass unsealed messages through", t, func() {
+		opened, err := h.openAppMsg(AppMsg{ZomeType: "jsSampleZome", Body: "x"})
+		So(err, ShouldBeNil)
+		So(opened.Body, ShouldEqual, "x")
+	})
+
+	Convey("it should answer sealed messages with a sealed response", t, func() {
+		sealed, _ := h.sealAppMsg(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		msg := h.node.NewMessage(APP_MESSAGE, sealed)
+		r, err := h.Send(h.node.ctx, ActionProtocol, h.nodeID, msg, 0)
+		So(err, ShouldBeNil)
+		rsp := r.(AppMsg)
+		So(len(rsp.Sealed), ShouldBeGreaterThan, 0)
+		opened, err := h.openAppMsg(rsp)
+		So(err, ShouldBeNil)
+		So(opened.Body, ShouldEqual, `{"pong":"foobar"}`)
+	})
+
+	Convey("it should use the key of a peer it knows without going to the DHT", t, func() {
+		other, priv := makePeer("known")
+		_, err := h.agentPubKey(other)
+		So(err, ShouldNotBeNil)
+		h.node.peerstore.AddPubKey(other, priv.GetPublic())
+		key, err := h.agentPubKey(other)
+		So(err, ShouldBeNil)
+		So(key.Equals(priv.GetPublic()), ShouldBeTrue)
+	})
+
+	Convey("it should reject key entries that don't match the agent's id", t, func() {
+		other, _ := makePeer("other")
+		pubKey, _ := ic.MarshalPublicKey(h.agent.PubKey())
+		keyHash := HashFromPeerID(other)
+		err := h.dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: keyHash}), KeyEntryType, keyHash, other, pubKey, StatusLive)
+		So(err, ShouldBeNil)
+		_, err = h.agentPubKey(other)
+		So(err, ShouldEqual, ErrKeyNotAgents)
+	})
+
+	Convey("encrypt and decrypt actions should round trip to an agent's key", t, func() {
+		r, err := NewEncryptAction(h.nodeID, "some secret").Do(h)
+		So(err, ShouldBeNil)
+		r, err = NewDecryptAction(r.(string)).Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "some secret")
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// events that zome code emits for the app's UI clients, which the web server pushes to
+// its subscribers
+
+package holochain
+
+import (
+	"sync"
+)
+
+const (
+	// how many events may wait for a subscriber before it starts missing them
+	eventBufferSize = 64
+)
+
+// AppEvent is an event emitted by zome code
+type AppEvent struct {
+	Name    string
+	Zome    string
+	Payload string // the emitted value, as JSON if it was an object
+}
+
+// eventSubscribers holds the channels of the subscribers to a holochain's events
+type eventSubscribers struct {
+	lk   sync.Mutex
+	subs map[chan AppEvent]bool
+}
+
+// SubscribeEvents returns a channel on which the events emitted by zome code are delivered,
+// and a function to call to stop them.  A subscriber that falls behind misses events rather
+// than holding up the zome code emitting them.
+func (h *Holochain) SubscribeEvents() (events <-chan AppEvent, unsubscribe func()) {
+	c := make(chan AppEvent, eventBufferSize)
+	h.events.lk.Lock()
+	if h.events.subs == nil {
+		h.events.subs = make(map[chan AppEvent]bool)
+	}
+	h.events.subs[c] = true
+	h.events.lk.Unlock()
+	events = c
+	unsubscribe = func() {
+		h.events.lk.Lock()
+		defer h.events.lk.Unlock()
+		if h.events.subs[c] {
+			delete(h.events.subs, c)
+			close(c)
+		}
+	}
+	return
+}
+
+// EmitEvent delivers an event to all the current subscribers
+func (h *Holochain) EmitEvent(e AppEvent) {
+	h.events.lk.Lock()
+	defer h.events.lk.Unlock()
+	for c := range h.events.subs {
+		select {
+		case c <- e:
+		default:
+			h.Debugf("dropping event %s for a subscriber that is behind", e.Name)
+		}
+	}
+}
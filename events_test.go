@@ -0,0 +1,40 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should deliver emitted events to every subscriber", t, func() {
+		events1, unsubscribe1 := h.SubscribeEvents()
+		defer unsubscribe1()
+		events2, unsubscribe2 := h.SubscribeEvents()
+		defer unsubscribe2()
+		e := AppEvent{Name: "fish", Zome: "jsSampleZome", Payload: "blub"}
+		h.EmitEvent(e)
+		So(<-events1, ShouldResemble, e)
+		So(<-events2, ShouldResemble, e)
+	})
+
+	Convey("it should stop delivering events after unsubscribing", t, func() {
+		events, unsubscribe := h.SubscribeEvents()
+		unsubscribe()
+		h.EmitEvent(AppEvent{Name: "fish"})
+		_, ok := <-events
+		So(ok, ShouldBeFalse)
+		unsubscribe()
+	})
+
+	Convey("it should drop events for subscribers that are behind", t, func() {
+		events, unsubscribe := h.SubscribeEvents()
+		defer unsubscribe()
+		for i := 0; i < eventBufferSize+1; i++ {
+			h.EmitEvent(AppEvent{Name: "fish"})
+		}
+		So(len(events), ShouldEqual, eventBufferSize)
+	})
+}
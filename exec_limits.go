@@ -0,0 +1,185 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// execution limits for zome code, so that a runaway zome function or validation callback
+// can't hang the node
+
+package holochain
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+const (
+	// kinds of zome code execution that limits can be set for
+
+	CallExecution     = "call"
+	ValidateExecution = "validate"
+	ReceiveExecution  = "receive"
+	GenesisExecution  = "genesis"
+
+	// DefaultValidateTimeout bounds validation callbacks, which run on data from peers
+	DefaultValidateTimeout = 10000
+
+	// DefaultReceiveTimeout bounds the receive callback, which runs on messages from peers
+	DefaultReceiveTimeout = 10000
+
+	// how many steps pass between checks of the heap size, as reading it stops the world
+	memCheckSteps = 10000
+)
+
+// ExecLimit holds the limits for one kind of zome code execution.  For each value zero means
+// the default for that kind and a negative value means no limit.  A DNA with wasm zomes may
+// only set the Timeout.
+type ExecLimit struct {
+	// Timeout : (integer) milliseconds the code may run for
+	Timeout int
+	// MaxSteps : (integer) number of statements (JS) or function calls (Zygo) the code may execute
+	MaxSteps int
+	// MaxMemory : (integer) bytes the heap may grow by while the code runs.  As the heap is shared
+	// by the whole process this is only an approximation.
+	MaxMemory int
+}
+
+// ExecutionLimits holds the DNA's limits for each kind of zome code execution
+type ExecutionLimits struct {
+	Call     ExecLimit // exposed zome functions and async send callbacks
+	Validate ExecLimit // validation and packaging request callbacks
+	Receive  ExecLimit // the receive callback for app messages and the lifecycle callbacks
+	Genesis  ExecLimit // genesis and bridge genesis
+}
+
+// ExecLimitError is returned when zome code is stopped for exceeding one of its limits
+type ExecLimitError struct {
+	Zome  string
+	Kind  string
+	Limit string
+}
+
+func (e *ExecLimitError) Error() string {
+	return fmt.Sprintf("%s code in zome %s stopped: exceeded %s limit", e.Kind, e.Zome, e.Limit)
+}
+
+// checkZome makes sure that the limits can all be enforced for the zome.  Wasm code runs
+// outside of the go heap and isn't stepped, so only its Timeout can be.
+func (l *ExecutionLimits) checkZome(zome *Zome) (err error) {
+	if zome.RibosomeType != WasmRibosomeType {
+		return
+	}
+	for _, limit := range []ExecLimit{l.Call, l.Validate, l.Receive, l.Genesis} {
+		if limit.MaxSteps > 0 || limit.MaxMemory > 0 {
+			err = fmt.Errorf("zome %s: only the Timeout execution limit applies to %s zomes", zome.Name, WasmRibosomeType)
+			return
+		}
+	}
+	return
+}
+
+// get returns the limit for a kind of execution
+func (l *ExecutionLimits) get(kind string) (limit ExecLimit) {
+	switch kind {
+	case CallExecution:
+		limit = l.Call
+	case ValidateExecution:
+		limit = l.Validate
+		if limit.Timeout == 0 {
+			limit.Timeout = DefaultValidateTimeout
+		}
+	case ReceiveExecution:
+		limit = l.Receive
+		if limit.Timeout == 0 {
+			limit.Timeout = DefaultReceiveTimeout
+		}
+	case GenesisExecution:
+		limit = l.Genesis
+	}
+	return
+}
+
+// execGuard tracks a single run of zome code against its limits
+type execGuard struct {
+	zome     string
+	kind     string
+	limit    ExecLimit
+	deadline time.Time
+	steps    int
+	heapBase uint64
+	hit      *ExecLimitError
+	log      *Logger // the app logger that hits are reported to
+}
+
+// newExecGuard returns a guard for running code of the given kind in a zome, or nil if
+// there are no limits to enforce
+func newExecGuard(h *Holochain, zome *Zome, kind string) (g *execGuard) {
+	var limits ExecutionLimits
+	if h != nil && h.nucleus != nil && h.nucleus.dna != nil && h.nucleus.dna.ExecutionLimits != nil {
+		limits = *h.nucleus.dna.ExecutionLimits
+	}
+	limit := limits.get(kind)
+	if limit.Timeout <= 0 && limit.MaxSteps <= 0 && limit.MaxMemory <= 0 {
+		return
+	}
+	g = &execGuard{zome: zome.Name, kind: kind, limit: limit}
+	if h != nil {
+		g.log = &h.Config.Loggers.App
+	}
+	if limit.Timeout > 0 {
+		g.deadline = time.Now().Add(time.Duration(limit.Timeout) * time.Millisecond)
+	}
+	if limit.MaxMemory > 0 {
+		g.heapBase = heapAlloc()
+	}
+	return
+}
+
+// counting reports whether the guard needs to see every step, rather than just a timer
+func (g *execGuard) counting() bool {
+	return g.limit.MaxSteps > 0 || g.limit.MaxMemory > 0
+}
+
+// step is called by the ribosome as the code executes and panics with the limit error once
+// a limit is exceeded
+func (g *execGuard) step() {
+	g.steps++
+	if g.limit.MaxSteps > 0 && g.steps > g.limit.MaxSteps {
+		g.stop("step")
+	}
+	if g.limit.Timeout > 0 && time.Now().After(g.deadline) {
+		g.stop("time")
+	}
+	if g.limit.MaxMemory > 0 && g.steps%memCheckSteps == 0 {
+		if heap := heapAlloc(); heap > g.heapBase && heap-g.heapBase > uint64(g.limit.MaxMemory) {
+			g.stop("memory")
+		}
+	}
+}
+
+// stop records and logs which limit was hit and then aborts the running code
+func (g *execGuard) stop(limit string) {
+	panic(g.exceeded(limit))
+}
+
+// exceeded records and logs which limit was hit
+func (g *execGuard) exceeded(limit string) *ExecLimitError {
+	g.hit = &ExecLimitError{Zome: g.zome, Kind: g.kind, Limit: limit}
+	if g.log != nil {
+		g.log.Logf("%v (after %d steps)", g.hit, g.steps)
+	}
+	return g.hit
+}
+
+// timeout returns how long the code may run, or zero if there is no time limit
+func (g *execGuard) timeout() time.Duration {
+	if g.limit.Timeout <= 0 {
+		return 0
+	}
+	return time.Duration(g.limit.Timeout) * time.Millisecond
+}
+
+func heapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
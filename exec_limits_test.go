@@ -0,0 +1,63 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecutionLimitsGet(t *testing.T) {
+	Convey("it should use the defaults for peer triggered code", t, func() {
+		var l ExecutionLimits
+		So(l.get(ValidateExecution).Timeout, ShouldEqual, DefaultValidateTimeout)
+		So(l.get(ReceiveExecution).Timeout, ShouldEqual, DefaultReceiveTimeout)
+		So(l.get(CallExecution).Timeout, ShouldEqual, 0)
+	})
+
+	Convey("it should use the configured limits", t, func() {
+		l := ExecutionLimits{Validate: ExecLimit{Timeout: 50, MaxSteps: 10}, Call: ExecLimit{MaxMemory: 1024}}
+		So(l.get(ValidateExecution), ShouldResemble, ExecLimit{Timeout: 50, MaxSteps: 10})
+		So(l.get(CallExecution).MaxMemory, ShouldEqual, 1024)
+	})
+
+	Convey("it should only allow limits that can be enforced for the zome", t, func() {
+		l := ExecutionLimits{Call: ExecLimit{Timeout: 50}}
+		So(l.checkZome(&Zome{Name: "z", RibosomeType: WasmRibosomeType}), ShouldBeNil)
+		l.Validate.MaxSteps = 10
+		So(l.checkZome(&Zome{Name: "z", RibosomeType: JSRibosomeType}), ShouldBeNil)
+		err := l.checkZome(&Zome{Name: "z", RibosomeType: WasmRibosomeType})
+		So(err.Error(), ShouldEqual, "zome z: only the Timeout execution limit applies to wasm zomes")
+		l.Validate.MaxSteps = 0
+		l.Receive.MaxMemory = 1024
+		So(l.checkZome(&Zome{Name: "z", RibosomeType: WasmRibosomeType}), ShouldNotBeNil)
+
+		dna := DNA{ExecutionLimits: &l, Zomes: []Zome{{Name: "z", RibosomeType: WasmRibosomeType}}}
+		So(dna.check(), ShouldNotBeNil)
+	})
+
+	Convey("it should only guard when there are limits", t, func() {
+		z := &Zome{Name: "z"}
+		So(newExecGuard(nil, z, CallExecution), ShouldBeNil)
+		So(newExecGuard(nil, z, ValidateExecution), ShouldNotBeNil)
+	})
+}
+
+func TestExecutionLimitsDNAFile(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("the limits and strict validation should be read from and written to the DNA file", t, func() {
+		limits := ExecutionLimits{Validate: ExecLimit{Timeout: 50, MaxSteps: 10}}
+		h.nucleus.dna.ExecutionLimits = &limits
+		h.nucleus.dna.StrictValidation = true
+		root := filepath.Join(d, "limits")
+		err := MakeDirs(root)
+		So(err, ShouldBeNil)
+		err = s.saveDNAFile(root, h.nucleus.dna, "json", false)
+		So(err, ShouldBeNil)
+		dna, err := s.loadDNA(filepath.Join(root, ChainDNADir), DNAFileName, "json")
+		So(err, ShouldBeNil)
+		So(*dna.ExecutionLimits, ShouldResemble, limits)
+		So(dna.StrictValidation, ShouldBeTrue)
+	})
+}
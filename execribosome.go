@@ -0,0 +1,445 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// ExecRibosome implements the Ribosome interface by running the zome's code as a child
+// process that speaks JSON-RPC 2.0 over its stdin and stdout, one message per line.
+//
+// The zome's code file is run directly, so it should start with a #! line naming its
+// interpreter.  The host sends the process these requests:
+//   call [function, params]: run an exposed zome function, whose result is its string
+//   genesis, bridgeGenesis, receive, validateCommit, validatePutPkg, etc. [args...]: run
+//     the callback with the same arguments as the JS callbacks, whose result is their JSON
+//   onPeerConnected, onHeld, onCountersignProposal, etc. [args...]: run the lifecycle
+//     callback, to which a process that doesn't have it should respond with the method not
+//     found error (-32601)
+// While handling a request the process may send requests of its own to the host, named
+// for the API functions (commit, get, getLinks, send, query, property, ...) with an array
+// of their arguments, and must wait for the response.  The process keeps running between
+// the requests of one use of the ribosome, but is restarted when the ribosome is reset for
+// reuse so nothing it stores carries over from one use to the next.
+//
+// As the zome's code runs as a program on the host, exec zomes only run when the operator
+// enables them with EnableExecZomes in the config.
+
+package holochain
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ExecRibosomeType = "exec"
+
+	// the JSON-RPC error code for errors from the API and zome code
+	jsonRPCAppError = -32000
+
+	// the JSON-RPC error code for requests of methods the process doesn't have
+	jsonRPCMethodNotFound = -32601
+)
+
+var ErrExecZomesDisabled = errors.New("exec zomes run programs on the host and must be enabled with EnableExecZomes in the config")
+
+// jsonRPCError is the error member of a JSON-RPC response
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonRPCError) Error() string {
+	return e.Message
+}
+
+// jsonRPCMsg holds a JSON-RPC request or response
+type jsonRPCMsg struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+// ExecRibosome holds data needed to talk to the zome's process
+type ExecRibosome struct {
+	h          *Holochain
+	zome       *Zome
+	file       string
+	cmd        *exec.Cmd
+	in         io.WriteCloser
+	out        *bufio.Reader
+	nextID     int64
+	dead       error // set once the process can no longer be used
+	closed     bool
+	strict     bool // set while running validation callbacks in strict mode
+	validating bool // set while running validation callbacks
+}
+
+// Type returns the string value under which this ribosome is registered
+func (er *ExecRibosome) Type() string { return ExecRibosomeType }
+
+// NewExecRibosome factory function to start the zome's process
+func NewExecRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	f, err := ioutil.TempFile("", "hc-"+zome.Name+"-")
+	if err != nil {
+		return
+	}
+	er := &ExecRibosome{h: h, zome: zome, file: f.Name()}
+	_, err = f.WriteString(zome.Code)
+	f.Close()
+	if err == nil {
+		err = os.Chmod(er.file, 0700)
+	}
+	if err == nil {
+		err = er.start()
+	}
+	if err != nil {
+		os.Remove(er.file)
+		return
+	}
+	n = er
+	return
+}
+
+func (er *ExecRibosome) start() (err error) {
+	er.cmd = exec.Command(er.file)
+	er.cmd.Stderr = os.Stderr
+	er.in, err = er.cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	var out io.ReadCloser
+	out, err = er.cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	er.out = bufio.NewReader(out)
+	err = er.cmd.Start()
+	return
+}
+
+// stop kills the process
+func (er *ExecRibosome) stop() {
+	er.in.Close()
+	er.cmd.Process.Kill()
+	er.cmd.Wait()
+}
+
+// Close stops the process and removes its code file
+func (er *ExecRibosome) Close() error {
+	if er.closed {
+		return nil
+	}
+	er.closed = true
+	er.dead = errors.New("process closed")
+	er.stop()
+	return os.Remove(er.file)
+}
+
+// Reset restarts the process, dropping anything it stored
+func (er *ExecRibosome) Reset() (err error) {
+	if er.closed {
+		return er.dead
+	}
+	er.stop()
+	er.dead = nil
+	err = er.start()
+	if err != nil {
+		er.dead = err
+	}
+	return
+}
+
+func (er *ExecRibosome) send(msg *jsonRPCMsg) (err error) {
+	msg.JSONRPC = "2.0"
+	var b []byte
+	b, err = json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	_, err = er.in.Write(append(b, '\n'))
+	return
+}
+
+// request sends a request to the process under the limits for the given kind of execution
+// and waits for its response, handling any API calls the process makes in the meantime
+func (er *ExecRibosome) request(kind string, method string, params ...interface{}) (result json.RawMessage, err error) {
+	if er.dead != nil {
+		err = er.dead
+		return
+	}
+	g := newExecGuard(er.h, er.zome, kind)
+	if g != nil && g.timeout() > 0 {
+		var lk sync.Mutex
+		var done, killed bool
+		timer := time.AfterFunc(g.timeout(), func() {
+			lk.Lock()
+			defer lk.Unlock()
+			if !done {
+				killed = true
+				er.cmd.Process.Kill()
+			}
+		})
+		defer func() {
+			timer.Stop()
+			lk.Lock()
+			done = true
+			lk.Unlock()
+			if killed {
+				if err != nil {
+					// report the kill rather than the broken pipe it caused
+					err = g.exceeded("time")
+				}
+				// a response that made it in before the kill still stands
+				er.dead = g.exceeded("time")
+			}
+		}()
+	}
+
+	er.nextID++
+	id := json.RawMessage(fmt.Sprintf("%d", er.nextID))
+	req := jsonRPCMsg{ID: id, Method: method}
+	req.Params, err = json.Marshal(params)
+	if err == nil {
+		err = er.send(&req)
+	}
+	for err == nil {
+		var line []byte
+		line, err = er.out.ReadBytes('\n')
+		if err != nil {
+			er.dead = fmt.Errorf("process for zome %s died: %v", er.zome.Name, err)
+			err = er.dead
+			return
+		}
+		var msg jsonRPCMsg
+		if err = json.Unmarshal(line, &msg); err != nil {
+			err = fmt.Errorf("bad JSON-RPC message from zome %s: %v", er.zome.Name, err)
+			return
+		}
+		if msg.Method != "" {
+			err = er.send(er.hostCall(&msg))
+			continue
+		}
+		if string(msg.ID) != string(id) {
+			err = fmt.Errorf("unexpected JSON-RPC response id %s from zome %s", msg.ID, er.zome.Name)
+			return
+		}
+		if msg.Error != nil {
+			err = msg.Error
+			return
+		}
+		result = msg.Result
+		return
+	}
+	return
+}
+
+// hostCall runs an API function requested by the process and returns the response
+func (er *ExecRibosome) hostCall(req *jsonRPCMsg) (rsp *jsonRPCMsg) {
+	rsp = &jsonRPCMsg{ID: req.ID}
+	var raw []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &raw); err != nil {
+			rsp.Error = &jsonRPCError{Code: jsonRPCAppError, Message: fmt.Sprintf("params to %s should be an array: %v", req.Method, err)}
+			return
+		}
+	}
+	result, err := jsonAPICall(er.h, er.zome, er.validating, er.strict, req.Method, raw)
+	if err == nil {
+		rsp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		rsp.Result = nil
+		rsp.Error = &jsonRPCError{Code: jsonRPCAppError, Message: err.Error()}
+	}
+	return
+}
+
+func (er *ExecRibosome) boolFn(fnName string, args ...interface{}) (err error) {
+	var r json.RawMessage
+	r, err = er.request(GenesisExecution, fnName, args...)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		return
+	}
+	var b interface{}
+	json.Unmarshal(r, &b)
+	switch t := b.(type) {
+	case bool:
+		if !t {
+			err = fmt.Errorf("%s failed", fnName)
+		}
+	default:
+		err = fmt.Errorf("%s should return boolean, got: %s", fnName, r)
+	}
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (er *ExecRibosome) ChainGenesis() (err error) {
+	err = er.boolFn("genesis")
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (er *ExecRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	err = er.boolFn("bridgeGenesis", side, dnaHash.String(), data)
+	return
+}
+
+// Hook runs the lifecycle callback of the given name, treating a method not found error
+// as the zome not defining it
+func (er *ExecRibosome) Hook(hook string, args ...string) (err error) {
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a
+	}
+	_, err = er.request(ReceiveExecution, hook, params...)
+	if e, ok := err.(*jsonRPCError); ok && e.Code == jsonRPCMethodNotFound {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+	}
+	return
+}
+
+// BoolHook runs the callback of the given name, which must return a boolean, treating a
+// method not found error as the zome not defining it and so returning false
+func (er *ExecRibosome) BoolHook(hook string, args ...string) (result bool, err error) {
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a
+	}
+	var r json.RawMessage
+	r, err = er.request(ReceiveExecution, hook, params...)
+	if e, ok := err.(*jsonRPCError); ok && e.Code == jsonRPCMethodNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+		return
+	}
+	if json.Unmarshal(r, &result) != nil {
+		err = fmt.Errorf("%s should return boolean, got: %s", hook, r)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (er *ExecRibosome) Receive(from string, msg string) (response string, err error) {
+	var r json.RawMessage
+	r, err = er.request(ReceiveExecution, "receive", from, json.RawMessage(msg))
+	if err != nil {
+		err = fmt.Errorf("Error executing receive: %v", err)
+		return
+	}
+	response = string(r)
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (er *ExecRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	er.validating = true
+	defer func() { er.validating = false }()
+	if strictValidation(er.h) {
+		er.strict = true
+		defer func() { er.strict = false }()
+	}
+	var r json.RawMessage
+	r, err = er.request(ValidateExecution, fnName, def.Name)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(r, &m); err != nil {
+		err = fmt.Errorf("%s should return null or object, got: %s", fnName, r)
+		return
+	}
+	if m != nil {
+		req = m
+	}
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (er *ExecRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	args, err := jsonValidateArgs(action, def, pkg, sources)
+	if err != nil {
+		return
+	}
+	er.validating = true
+	defer func() { er.validating = false }()
+	if strictValidation(er.h) {
+		er.strict = true
+		defer func() { er.strict = false }()
+	}
+	fnName := "validate" + strings.Title(action.Name())
+	var r json.RawMessage
+	r, err = er.request(ValidateExecution, fnName, args...)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		return
+	}
+	var b interface{}
+	json.Unmarshal(r, &b)
+	switch t := b.(type) {
+	case bool:
+		if !t {
+			err = ValidationFailedErr
+		}
+	default:
+		err = fmt.Errorf("%s should return boolean, got: %s", fnName, r)
+	}
+	return
+}
+
+// Call asks the process to run an exposed function, passing the params string as is
+func (er *ExecRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	if fn.CallingType != STRING_CALLING && fn.CallingType != JSON_CALLING {
+		err = errors.New("params type not implemented")
+		return
+	}
+	er.h.Debugf("Exec Call: %s(%s)", fn.Name, params)
+	var r json.RawMessage
+	r, err = er.request(CallExecution, "call", fn.Name, params.(string))
+	if err != nil {
+		return
+	}
+	var s string
+	if err = json.Unmarshal(r, &s); err != nil {
+		err = fmt.Errorf("%s should return a string, got: %s", fn.Name, r)
+		return
+	}
+	result = s
+	return
+}
+
+// Run is not supported as the process's code can't be extended at run time
+func (er *ExecRibosome) Run(code string) (result interface{}, err error) {
+	err = errors.New("exec ribosome can't run code")
+	return
+}
+
+// RunAsyncSendResponse calls the callback given to send with the response
+func (er *ExecRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	var r json.RawMessage
+	r, err = er.request(CallExecution, callback, json.RawMessage(response.Body), callbackID)
+	if err == nil {
+		result = string(r)
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package holochain
+
+import (
+	"bufio"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+)
+
+// execTestZomeCode runs the test binary as the zome process
+var execTestZomeCode = "#!/bin/sh\nHC_TEST_EXEC_ZOME=1 exec " + os.Args[0] + " -test.run=TestExecHelperProcess\n"
+
+// TestExecHelperProcess isn't a real test, it's the zome process run by the exec ribosome tests
+func TestExecHelperProcess(t *testing.T) {
+	if os.Getenv("HC_TEST_EXEC_ZOME") != "1" {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	send := func(msg jsonRPCMsg) {
+		msg.JSONRPC = "2.0"
+		b, _ := json.Marshal(msg)
+		os.Stdout.Write(append(b, '\n'))
+	}
+	for {
+		line, err := in.ReadBytes('\n')
+		if err != nil {
+			os.Exit(0)
+		}
+		var req jsonRPCMsg
+		json.Unmarshal(line, &req)
+		var params []json.RawMessage
+		json.Unmarshal(req.Params, &params)
+		rsp := jsonRPCMsg{ID: req.ID}
+		switch req.Method {
+		case "genesis", "onHeld":
+			rsp.Result = json.RawMessage(`true`)
+		case "validateCommit":
+			rsp.Result = json.RawMessage(`false`)
+			if string(params[1]) == `"2"` {
+				rsp.Result = json.RawMessage(`true`)
+			}
+		case "call":
+			var fn, arg string
+			json.Unmarshal(params[0], &fn)
+			json.Unmarshal(params[1], &arg)
+			switch fn {
+			case "echo":
+				rsp.Result, _ = json.Marshal(arg)
+			case "version":
+				// ask the host and return what it said
+				send(jsonRPCMsg{ID: json.RawMessage(`"v"`), Method: "version", Params: json.RawMessage(`[]`)})
+				line, _ = in.ReadBytes('\n')
+				var hostRsp jsonRPCMsg
+				json.Unmarshal(line, &hostRsp)
+				var v string
+				json.Unmarshal(hostRsp.Result, &v)
+				rsp.Result, _ = json.Marshal(v)
+			case "loop":
+				select {}
+			}
+		default:
+			rsp.Error = &jsonRPCError{Code: -32601, Message: "method not found: " + req.Method}
+		}
+		send(rsp)
+	}
+}
+
+func TestNewExecRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.ExecutionLimits = &ExecutionLimits{}
+	defer func() { h.nucleus.dna.ExecutionLimits = nil }()
+
+	zome := &Zome{Name: "execZome", RibosomeType: ExecRibosomeType,
+		Code: execTestZomeCode,
+		Functions: []FunctionDef{
+			{Name: "echo", CallingType: STRING_CALLING},
+			{Name: "version", CallingType: STRING_CALLING},
+			{Name: "loop", CallingType: STRING_CALLING},
+		},
+	}
+
+	Convey("it should call exposed functions in the process", t, func() {
+		v, err := NewExecRibosome(h, zome)
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, ExecRibosomeType)
+		result, err := v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "fish")
+	})
+
+	Convey("it should run callbacks in the process", t, func() {
+		v, err := NewExecRibosome(h, zome)
+		So(err, ShouldBeNil)
+		err = v.ChainGenesis()
+		So(err, ShouldBeNil)
+
+		hdr := mkTestHeader("evenNumbers")
+		def := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &hdr
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err, ShouldBeNil)
+		a = NewCommitAction("evenNumbers", &GobEntry{C: "3"})
+		a.header = &hdr
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+
+		_, err = v.Receive("fakehash", `{}`)
+		So(err.Error(), ShouldEqual, "Error executing receive: method not found: receive")
+
+		So(v.Hook(HeldHook, "QmFoo", "evenNumbers"), ShouldBeNil)
+		So(v.Hook(ShutdownHook), ShouldBeNil)
+	})
+
+	Convey("it should answer API calls from the process", t, func() {
+		v, err := NewExecRibosome(h, zome)
+		So(err, ShouldBeNil)
+		result, err := v.Call(&zome.Functions[1], "")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, VersionStr)
+	})
+
+	Convey("it should restart the process on reset", t, func() {
+		v, err := NewExecRibosome(h, zome)
+		So(err, ShouldBeNil)
+		defer v.Close()
+		pid := v.(*ExecRibosome).cmd.Process.Pid
+		So(v.(*ExecRibosome).Reset(), ShouldBeNil)
+		So(v.(*ExecRibosome).cmd.Process.Pid, ShouldNotEqual, pid)
+		result, err := v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "fish")
+	})
+
+	Convey("it should kill a process that runs past its timeout", t, func() {
+		h.nucleus.dna.ExecutionLimits.Call.Timeout = 100
+		defer func() { h.nucleus.dna.ExecutionLimits.Call.Timeout = 0 }()
+		v, err := NewExecRibosome(h, zome)
+		So(err, ShouldBeNil)
+		defer v.Close()
+		_, err = v.Call(&zome.Functions[2], "")
+		So(err.Error(), ShouldEqual, "call code in zome execZome stopped: exceeded time limit")
+		_, err = v.Call(&zome.Functions[0], "fish")
+		So(err.Error(), ShouldEqual, "call code in zome execZome stopped: exceeded time limit")
+
+		// and be usable again once reset
+		So(v.(*ExecRibosome).Reset(), ShouldBeNil)
+		result, err := v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "fish")
+	})
+
+	Convey("it should only run when enabled in the config", t, func() {
+		_, err := CreateRibosome(h, zome)
+		So(err, ShouldEqual, ErrExecZomesDisabled)
+		h.Config.EnableExecZomes = true
+		defer func() { h.Config.EnableExecZomes = false }()
+		v, err := CreateRibosome(h, zome)
+		So(err, ShouldBeNil)
+		v.Close()
+	})
+}
@@ -9,6 +9,7 @@ package holochain
 import (
 	"errors"
 	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
 	"github.com/tidwall/buntdb"
@@ -40,7 +41,8 @@ type GossipReq struct {
 type PeerListType string
 
 const (
-	BlockedList = "blockedlist"
+	BlockedList   = "blockedlist"
+	WarrantedList = "warrantedlist" // authors of entries proven invalid by a warrant
 )
 
 type PeerRecord struct {
@@ -556,6 +558,34 @@ func (dht *DHT) getList(listType PeerListType) (result PeerList, err error) {
 	return
 }
 
+// warrantInvalidEntry gossips a warrant of an entry that failed validation to the nodes
+// closest to its author, adding the author to their warranted lists
+func (dht *DHT) warrantInvalidEntry(author peer.ID, resp *ValidateResponse) (err error) {
+	var key ic.PubKey
+	key, err = dht.h.agentPubKey(author)
+	if err != nil {
+		return
+	}
+	var w *InvalidEntryWarrant
+	w, err = NewInvalidEntryWarrant(author, key, resp.Type, &resp.Header, &resp.Entry, &resp.Package)
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = w.Encode()
+	if err != nil {
+		return
+	}
+	err = dht.Change(HashFromPeerID(author), LISTADD_REQUEST,
+		ListAddReq{
+			ListType:    WarrantedList,
+			Peers:       []string{peer.IDB58Encode(author)},
+			WarrantType: InvalidEntryType,
+			Warrant:     data,
+		})
+	return
+}
+
 // addToList adds the peers to a list
 func (dht *DHT) addToList(m *Message, list PeerList) (err error) {
 	dht.dlog.Logf("addToList %s=>%v", list.Type, list.Records)
@@ -9,7 +9,6 @@ package holochain
 import (
 	"bytes"
 	"context"
-	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -60,10 +59,31 @@ type Config struct {
 	BootstrapServer string
 	Loggers         Loggers
 
+	// RibosomePoolSize is the number of idle ribosomes kept for reuse per zome.
+	// Zero means DefaultRibosomePoolSize and a negative value turns pooling off.
+	RibosomePoolSize int
+
+	// InstanceProperties are properties of this instance of the app.  They override the
+	// DNA's properties of the same name when read by property(), but unlike those they are
+	// not part of the DNA and so don't change its hash.  As they can differ from node to
+	// node, validation callbacks only get the DNA's properties.
+	InstanceProperties map[string]string
+
+	// EnableExecZomes lets zomes of the exec ribosome type run, which run their code as a
+	// program on this host with the operator's privileges
+	EnableExecZomes bool
+
+	// AutoBlockWarranted blocks the authors of entries that an InvalidEntryWarrant proves
+	// invalid, rather than only adding them to the warranted list.  It only applies to DNAs
+	// with StrictValidation, as otherwise validation may depend on the validating node and
+	// an entry proven invalid on one node may be valid on another.
+	AutoBlockWarranted bool
+
 	gossipInterval           time.Duration
 	bootstrapRefreshInterval time.Duration
 	routingRefreshInterval   time.Duration
 	retryInterval            time.Duration
+	peerSaveInterval         time.Duration
 }
 
 // Progenitor holds data on the creator of the DNA
@@ -94,6 +114,9 @@ type Holochain struct {
 	gossipProtocol   *Protocol
 	actionProtocol   *Protocol
 	asyncSends       chan error
+	ribosomes        ribosomePools
+	events           eventSubscribers
+	mailReplies      pendingReplies
 }
 
 func (h *Holochain) Nucleus() (n *Nucleus) {
@@ -162,33 +185,37 @@ var _holochainInitialized bool
 func InitializeHolochain() {
 	// this should only run once
 	if !_holochainInitialized {
-		gob.Register(Header{})
-		gob.Register(AgentEntry{})
-		gob.Register(Hash{})
-		gob.Register(PutReq{})
-		gob.Register(GetReq{})
-		gob.Register(GetResp{})
-		gob.Register(ModReq{})
-		gob.Register(DelReq{})
-		gob.Register(LinkReq{})
-		gob.Register(LinkQuery{})
-		gob.Register(GossipReq{})
-		gob.Register(Gossip{})
-		gob.Register(ValidateQuery{})
-		gob.Register(ValidateResponse{})
-		gob.Register(Put{})
-		gob.Register(GobEntry{})
-		gob.Register(LinkQueryResp{})
-		gob.Register(TaggedHash{})
-		gob.Register(ErrorResponse{})
-		gob.Register(DelEntry{})
-		gob.Register(StatusChange{})
-		gob.Register(Package{})
-		gob.Register(AppMsg{})
-		gob.Register(ListAddReq{})
-		gob.Register(FindNodeReq{})
-		gob.Register(CloserPeersResp{})
-		gob.Register(PeerInfo{})
+		registerMessageBody(Header{})
+		registerMessageBody(AgentEntry{})
+		registerMessageBody(Hash{})
+		registerMessageBody(PutReq{})
+		registerMessageBody(GetReq{})
+		registerMessageBody(GetResp{})
+		registerMessageBody(ModReq{})
+		registerMessageBody(DelReq{})
+		registerMessageBody(LinkReq{})
+		registerMessageBody(LinkQuery{})
+		registerMessageBody(GossipReq{})
+		registerMessageBody(Gossip{})
+		registerMessageBody(ValidateQuery{})
+		registerMessageBody(ValidateResponse{})
+		registerMessageBody(Put{})
+		registerMessageBody(GobEntry{})
+		registerMessageBody(LinkQueryResp{})
+		registerMessageBody(TaggedHash{})
+		registerMessageBody(ErrorResponse{})
+		registerMessageBody(DelEntry{})
+		registerMessageBody(StatusChange{})
+		registerMessageBody(Package{})
+		registerMessageBody(AppMsg{})
+		registerMessageBody(ListAddReq{})
+		registerMessageBody(FindNodeReq{})
+		registerMessageBody(CloserPeersResp{})
+		registerMessageBody(PeerInfo{})
+		registerMessageBody(Chunk{})
+		registerMessageBody(MailboxPutReq{})
+		registerMessageBody(MailboxGetReq{})
+		registerMessageBody(MailboxGetResp{})
 
 		RegisterBultinRibosomes()
 
@@ -283,6 +310,18 @@ func (h *Holochain) createNode() (err error) {
 	}
 	listenaddr := fmt.Sprintf("/ip4/%s/tcp/%d", ip, h.Config.Port)
 	h.node, err = NewNode(listenaddr, h.dnaHash.String(), h.Agent().(*LibP2PAgent), h.Config.EnableNATUPnP, &h.Config.Loggers.Debug)
+	if err != nil {
+		return
+	}
+	// the notifiee reads these under the peer lock as the node may already have connections
+	h.node.plk.Lock()
+	h.node.peerConnected = func(id peer.ID) {
+		h.nucleus.RunHook(PeerConnectedHook, peer.IDB58Encode(id))
+	}
+	h.node.peerDisconnected = func(id peer.ID) {
+		h.nucleus.RunHook(PeerDisconnectedHook, peer.IDB58Encode(id))
+	}
+	h.node.plk.Unlock()
 	return
 }
 
@@ -324,6 +363,10 @@ func (h *Holochain) Prepare() (err error) {
 func (h *Holochain) Activate() (err error) {
 	h.Debugf("Activating  %v", h.dnaHash)
 
+	if err = h.restorePeers(); err != nil {
+		return
+	}
+
 	if h.Config.EnableMDNS {
 		err = h.node.EnableMDNSDiscovery(h, time.Second)
 		if err != nil {
@@ -425,6 +468,10 @@ func (h *Holochain) GenChain() (headerHash Hash, err error) {
 		return
 	}
 
+	if err = h.nucleus.dna.validateProperties(h.Config.InstanceProperties); err != nil {
+		return
+	}
+
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("Error during chain genesis: %v\n", err)
@@ -504,6 +551,7 @@ func (config *Config) Setup() (err error) {
 	config.bootstrapRefreshInterval = BootstrapTTL
 	config.routingRefreshInterval = DefaultRoutingRefreshInterval
 	config.retryInterval = DefaultRetryInterval
+	config.peerSaveInterval = DefaultPeerSaveInterval
 	err = config.SetupLogging()
 	return
 }
@@ -620,10 +668,11 @@ func (h *Holochain) GetPrivateEntryDefs() (privateDefs []EntryDef) {
 
 // Call executes an exposed function
 func (h *Holochain) Call(zomeType string, function string, arguments interface{}, exposureContext string) (result interface{}, err error) {
-	n, z, err := h.MakeRibosome(zomeType)
+	n, z, release, err := h.GetRibosome(zomeType)
 	if err != nil {
 		return
 	}
+	defer release()
 	fn, err := z.GetFunctionDef(function)
 	if err != nil {
 		return
@@ -632,7 +681,24 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 		err = errors.New("function not available")
 		return
 	}
+	if (fn.InputSchema != "" && fn.inputValidator == nil) || (fn.OutputSchema != "" && fn.outputValidator == nil) {
+		// the schema didn't build when the DNA was set, or the function was added since,
+		// so build on a copy rather than change the DNA under other calls
+		f := *fn
+		if err = f.BuildSchemaValidators(); err != nil {
+			return
+		}
+		fn = &f
+	}
+	if err = fn.checkSchema(zomeType, "input", fn.inputValidator, arguments); err != nil {
+		return
+	}
 	result, err = n.Call(fn, arguments)
+	if err == nil {
+		if err = fn.checkSchema(zomeType, "output", fn.outputValidator, result); err != nil {
+			result = nil
+		}
+	}
 	return
 }
 
@@ -651,11 +717,20 @@ func (h *Holochain) GetProperty(prop string) (property string, err error) {
 	if prop == ID_PROPERTY || prop == AGENT_ID_PROPERTY || prop == AGENT_NAME_PROPERTY {
 		ChangeAppProperty.Log()
 	} else {
-		property = h.nucleus.dna.Properties[prop]
+		var ok bool
+		if property, ok = h.Config.InstanceProperties[prop]; !ok {
+			property, err = h.getDNAProperty(prop)
+		}
 	}
 	return
 }
 
+// getDNAProperty returns the value of a property of the DNA, ignoring instance properties
+func (h *Holochain) getDNAProperty(prop string) (property string, err error) {
+	property = h.nucleus.dna.Properties[prop]
+	return
+}
+
 // GetZome returns a zome structure given its name
 func (h *Holochain) GetZome(zName string) (z *Zome, err error) {
 	for _, zome := range h.nucleus.dna.Zomes {
@@ -673,6 +748,11 @@ func (h *Holochain) GetZome(zName string) (z *Zome, err error) {
 
 // Close releases the resources associated with a holochain
 func (h *Holochain) Close() {
+	// run the shutdown callbacks while there is still a chain and node for them to use
+	if h.node != nil && h.Started() {
+		h.nucleus.RunHook(ShutdownHook)
+	}
+	h.FlushRibosomes()
 	if h.chain != nil {
 		h.chain.Close()
 		h.chain = nil
@@ -682,6 +762,10 @@ func (h *Holochain) Close() {
 		h.dht = nil
 	}
 	if h.node != nil {
+		err := h.SavePeers()
+		if err != nil {
+			h.Debugf("error saving peers: %v", err)
+		}
 		h.node.Close()
 		h.node = nil
 	}
@@ -744,14 +828,19 @@ func (h *Holochain) SendAsync(proto int, to peer.ID, msg *Message, callback *Cal
 
 	go func() {
 		response, err = h.Send(h.node.ctx, proto, to, msg, timeout)
-		if err == nil {
-			var r Ribosome
-			r, _, err := h.MakeRibosome(callback.zomeType)
+		if _, unreachable := err.(UnreachableError); unreachable && callback.msg != nil {
+			err = h.holdMessageForCallback(to, *callback.msg, callback)
+		} else if err == nil {
+			r, _, release, err := h.GetRibosome(callback.zomeType)
 			if err == nil {
+				defer release()
 				switch t := response.(type) {
 				case AppMsg:
 					//var result interface{}
-					_, err = r.RunAsyncSendResponse(t, callback.Function, callback.ID)
+					t, err = h.openAppMsg(t)
+					if err == nil {
+						_, err = r.RunAsyncSendResponse(t, callback.Function, callback.ID)
+					}
 
 				default:
 					err = fmt.Errorf("unimplemented async send response type: %t", t)
@@ -806,6 +895,8 @@ func (h *Holochain) StartBackgroundTasks() {
 		h.node.retrying = h.TaskTicker(h.Config.bootstrapRefreshInterval, BootstrapRefreshTask)
 	}
 	h.node.refreshing = h.TaskTicker(h.Config.routingRefreshInterval, RoutingRefreshTask)
+	h.node.persisting = h.TaskTicker(h.Config.peerSaveInterval, PeerSaveTask)
+	h.startScheduledTasks()
 }
 
 // BootstrapRefreshTask refreshes our node and gets nodes from the bootstrap server
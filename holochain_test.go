@@ -403,6 +403,39 @@ func TestGenChain(t *testing.T) {
 	})
 }
 
+func TestInstanceProperties(t *testing.T) {
+	d, _, h := SetupTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.PropertiesSchema = `{"type":"object","properties":{"language":{"enum":["en","fr"]}}}`
+	h.nucleus.dna.propertiesSchemaValidator = nil
+
+	Convey("GenChain should fail if instance properties don't match the properties schema", t, func() {
+		h.Config.InstanceProperties = map[string]string{"language": "klingon"}
+		_, err := h.GenChain()
+		So(err.Error(), ShouldStartWith, "properties don't match the properties schema: ")
+		So(h.Started(), ShouldBeFalse)
+	})
+
+	Convey("instance properties should override DNA properties without changing the DNA hash", t, func() {
+		h.Config.InstanceProperties = map[string]string{"language": "fr", "local": "x"}
+		_, err := h.GenChain()
+		So(err, ShouldBeNil)
+		hash, err := DNAHashofUngenedChain(h)
+		So(err, ShouldBeNil)
+		So(hash.String(), ShouldEqual, h.DNAHash().String())
+
+		p, err := h.GetProperty("language")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "fr")
+		p, err = h.GetProperty("local")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "x")
+		p, err = h.GetProperty("description")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, h.nucleus.dna.Properties["description"])
+	})
+}
+
 func TestWalk(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -489,6 +522,31 @@ func TestCall(t *testing.T) {
 		_, err := h.Call("zySampleZome", "testStrFn1", "arg1 arg2", PUBLIC_EXPOSURE)
 		So(err.Error(), ShouldEqual, "function not available")
 	})
+
+	Convey("it should validate calls against the function's schemas", t, func() {
+		var fn *FunctionDef
+		for i := range h.nucleus.dna.Zomes {
+			for j := range h.nucleus.dna.Zomes[i].Functions {
+				if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" && h.nucleus.dna.Zomes[i].Functions[j].Name == "testJsonFn1" {
+					fn = &h.nucleus.dna.Zomes[i].Functions[j]
+				}
+			}
+		}
+		fn.InputSchema = `{"type":"object","properties":{"input":{"type":"integer"}},"required":["input"]}`
+		fn.OutputSchema = `{"type":"object","properties":{"output":{"type":"integer","maximum":10}}}`
+		defer func() { fn.InputSchema, fn.OutputSchema = "", "" }()
+
+		result, err := h.Call("jsSampleZome", "testJsonFn1", `{"input":2}`, ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, `{"input":2,"output":4}`)
+
+		_, err = h.Call("jsSampleZome", "testJsonFn1", `{"input":"2"}`, ZOME_EXPOSURE)
+		So(err.(*FunctionSchemaError).Which, ShouldEqual, "input")
+
+		result, err = h.Call("jsSampleZome", "testJsonFn1", `{"input":8}`, ZOME_EXPOSURE)
+		So(err.(*FunctionSchemaError).Which, ShouldEqual, "output")
+		So(result, ShouldBeNil)
+	})
 }
 
 func TestCommit(t *testing.T) {
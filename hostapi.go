@@ -0,0 +1,568 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// the registry of host functions that make up the holochain API for zome code
+//
+// Every ribosome builds its bindings from HostFns: it converts the zome code's arguments to
+// Go values according to the Args spec of the function's action, calls Do, and converts the
+// result back to the zome code's values.  Do returns strings, bools, nil, plain maps and
+// slices, or one of the host result types below for results that ribosomes present in their
+// own way.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"time"
+)
+
+// HostFn describes a function of the API that zome code can call
+type HostFn struct {
+	Name string
+	// Doc says what the function does
+	Doc string
+	// Returns is the TypeScript type of what the function returns to JS zome code
+	Returns string
+	// Args returns the spec of the function's arguments, which is that of its action
+	Args func() []Arg
+	// NonDeterministic functions depend on the node calling them or on the state of the
+	// network, and so can't be called by validation callbacks in strict mode
+	NonDeterministic bool
+	// UpdatesApp functions change the values that ribosomes expose as App globals
+	UpdatesApp bool
+	// Do runs the function with the processed arguments
+	Do func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error)
+	// Validating, if set, runs in place of Do when the function is called by a validation
+	// callback, for functions that would otherwise answer differently on different nodes
+	Validating func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error)
+}
+
+// run runs the function with the processed arguments, as validation callbacks get it when
+// validating
+func (fn *HostFn) run(h *Holochain, zome *Zome, args []Arg, validating bool) (result interface{}, err error) {
+	if validating && fn.Validating != nil {
+		return fn.Validating(h, zome, args)
+	}
+	return fn.Do(h, zome, args)
+}
+
+// hostQueryResult is what query returns, along with the options saying what to return and
+// the defs of the returned entries
+type hostQueryResult struct {
+	results []QueryResult
+	options *QueryOptions
+	defs    map[string]*EntryDef
+}
+
+// hostGetResult is what get returns along with the mask of what to return
+type hostGetResult struct {
+	resp GetResp
+	mask int
+}
+
+// hostLinksResult is what getLinks returns along with the tag asked for, whether the
+// entries were loaded, and the defs of the loaded entries
+type hostLinksResult struct {
+	links []TaggedHash
+	tag   string
+	load  bool
+	defs  map[string]*EntryDef
+}
+
+// hostSignature is what sign returns.  The JS and Zygo ribosomes get the raw signature
+// bytes as a string, while over the JSON API it is base58 encoded as JSON strings can't
+// hold arbitrary bytes.
+type hostSignature []byte
+
+// HostFns is the registry of API functions available to zome code
+var HostFns = []HostFn{
+	{
+		Name:    "version",
+		Doc:     "returns the version of holochain",
+		Returns: "string",
+		Args:    func() []Arg { return []Arg{} },
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			result = VersionStr
+			return
+		},
+	},
+	{
+		Name:    "property",
+		Doc:     "returns the value of a property of the DNA, or of the instance property overriding it.  As instance properties differ from node to node validation callbacks only get the DNA's",
+		Returns: "string",
+		Args:    (&ActionProperty{}).Args,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			result, err = NewPropertyAction(args[0].value.(string)).Do(h)
+			return
+		},
+		Validating: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			result, err = h.getDNAProperty(args[0].value.(string))
+			return
+		},
+	},
+	{
+		Name:    "debug",
+		Doc:     "writes a value to the app's debug log",
+		Returns: "void",
+		Args:    (&ActionDebug{}).Args,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			NewDebugAction(args[0].value.(string)).Do(h)
+			return
+		},
+	},
+	{
+		Name:             "emit",
+		Doc:              "sends an event to the app's UI clients that subscribed to it, with objects as JSON",
+		Returns:          "void",
+		Args:             (&ActionEmit{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			NewEmitAction(zome.Name, args[0].value.(string), args[1].value.(string)).Do(h)
+			return
+		},
+	},
+	{
+		Name:    "makeHash",
+		Doc:     "returns the hash an entry of the given type would have",
+		Returns: "Hash",
+		Args:    (&ActionMakeHash{}).Args,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionMakeHash{entryType: args[0].value.(string), entry: &GobEntry{C: args[1].value.(string)}}
+			result, err = hashResult(a.Do(h))
+			return
+		},
+	},
+	{
+		Name:             "getBridges",
+		Doc:              "returns the bridges between this app and other apps",
+		Returns:          "Bridge[]",
+		Args:             (&ActionGetBridges{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			var r interface{}
+			r, err = (&ActionGetBridges{}).Do(h)
+			if err != nil {
+				return
+			}
+			bridges := make([]interface{}, 0)
+			for _, b := range r.([]Bridge) {
+				if b.Side == BridgeTo {
+					bridges = append(bridges, map[string]interface{}{"Side": b.Side, "Token": b.Token})
+				} else {
+					bridges = append(bridges, map[string]interface{}{"Side": b.Side, "ToApp": b.ToApp.String()})
+				}
+			}
+			result = bridges
+			return
+		},
+	},
+	{
+		Name:             "sign",
+		Doc:              "signs a document with the agent's private key and returns the signature",
+		Returns:          "string",
+		Args:             (&ActionSign{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionSign{doc: []byte(args[0].value.(string))}
+			var r interface{}
+			r, err = a.Do(h)
+			if err == nil {
+				result = hostSignature(r.([]byte))
+			}
+			return
+		},
+	},
+	{
+		Name:    "verifySignature",
+		Doc:     "checks a base58 encoded signature of data against a base58 encoded public key",
+		Returns: "boolean",
+		Args:    (&ActionVerifySignature{}).Args,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := NewVerifySignatureAction(args[0].value.(string), args[1].value.(string), args[2].value.(string))
+			result, err = a.Do(h)
+			return
+		},
+	},
+	{
+		Name:             "encrypt",
+		Doc:              "encrypts data so that only the given node can decrypt it",
+		Returns:          "string",
+		Args:             (&ActionEncrypt{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionEncrypt{data: args[1].value.(string)}
+			a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+			if err != nil {
+				return
+			}
+			result, err = a.Do(h)
+			return
+		},
+	},
+	{
+		Name:             "decrypt",
+		Doc:              "decrypts data that was encrypted for this node",
+		Returns:          "string",
+		Args:             (&ActionDecrypt{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			result, err = (&ActionDecrypt{data: args[0].value.(string)}).Do(h)
+			return
+		},
+	},
+	{
+		Name:             "send",
+		Doc:              "sends a message to the receive callback of this zome on another node and returns its response, or passes it to the Callback function.  If the node can't be reached the message is held for it and a SendHeld returned, with any Callback run once it is delivered",
+		Returns:          "any",
+		Args:             (&ActionSend{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionSend{}
+			a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+			if err != nil {
+				return
+			}
+			var j []byte
+			j, err = json.Marshal(args[1].value)
+			if err != nil {
+				return
+			}
+			a.msg.ZomeType = zome.Name
+			a.msg.Body = string(j)
+			if args[2].value != nil {
+				a.options = &SendOptions{}
+				if err = hostOptions(args[2], a.options); err != nil {
+					return
+				}
+				if a.options.Callback != nil {
+					if a.options.Callback.Function == "" {
+						err = errors.New("callback option requires Function")
+						return
+					}
+					if a.options.Callback.ID == "" {
+						err = errors.New("callback option requires ID")
+						return
+					}
+					a.options.Callback.zomeType = zome.Name
+				}
+			}
+			result, err = a.Do(h)
+			return
+		},
+	},
+	{
+		Name:             "call",
+		Doc:              "calls an exposed function of a zome in this app",
+		Returns:          "any",
+		Args:             (&ActionCall{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionCall{zome: args[0].value.(string), function: args[1].value.(string)}
+			var z *Zome
+			z, err = h.GetZome(a.zome)
+			if err != nil {
+				return
+			}
+			var fn *FunctionDef
+			fn, err = z.GetFunctionDef(a.function)
+			if err != nil {
+				return
+			}
+			params, isObject := hostArgs(args[2])
+			if fn.CallingType == JSON_CALLING && !isObject {
+				err = errors.New("function calling type requires object argument type")
+				return
+			}
+			a.args = params
+			result, err = a.Do(h)
+			return
+		},
+	},
+	{
+		Name:             "bridge",
+		Doc:              "calls an exposed function of a zome in a bridged app",
+		Returns:          "any",
+		Args:             (&ActionBridge{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionBridge{zome: args[1].value.(string), function: args[2].value.(string)}
+			a.token, a.url, err = h.GetBridgeToken(args[0].value.(Hash))
+			if err != nil {
+				return
+			}
+			a.args, _ = hostArgs(args[3])
+			result, err = a.Do(h)
+			return
+		},
+	},
+	{
+		Name:             "commit",
+		Doc:              "adds an entry to the local chain and the DHT and returns its hash",
+		Returns:          "Hash",
+		Args:             (&ActionCommit{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			entry := &GobEntry{C: args[1].value.(string)}
+			result, err = hashResult(NewCommitAction(args[0].value.(string), entry).Do(h))
+			return
+		},
+	},
+	{
+		Name:             "countersign",
+		Doc:              "has the other parties sign an entry, which each does only if its onCountersignProposal callback returns true, and once they all did has every party commit it and returns its hash and the warrant of their signatures",
+		Returns:          "Countersigned",
+		Args:             (&ActionCountersign{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			var options CountersignOptions
+			if err = hostOptions(args[2], &options); err != nil {
+				return
+			}
+			a := NewCountersignAction(args[0].value.(string), args[1].value.(string), nil)
+			for _, p := range options.Parties {
+				var id peer.ID
+				id, err = peer.IDB58Decode(p)
+				if err != nil {
+					return
+				}
+				a.parties = append(a.parties, id)
+			}
+			a.timeout = time.Duration(options.Timeout) * time.Millisecond
+			var r interface{}
+			r, err = a.Do(h)
+			if err != nil {
+				return
+			}
+			w := r.(*CountersignWarrant)
+			var data []byte
+			data, err = w.Encode()
+			if err == nil {
+				result = map[string]interface{}{"Hash": w.EntryHash, "Warrant": string(data)}
+			}
+			return
+		},
+	},
+	{
+		Name:    "verifyCountersign",
+		Doc:     "checks the signatures of a countersign warrant and returns what it warrants",
+		Returns: "CountersignWarrant",
+		Args:    func() []Arg { return []Arg{{Name: "warrant", Type: StringArg}} },
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			w := &CountersignWarrant{}
+			if err = w.Decode([]byte(args[0].value.(string))); err != nil {
+				return
+			}
+			if err = w.Verify(h); err != nil {
+				return
+			}
+			result = map[string]interface{}{"EntryType": w.EntryType, "EntryHash": w.EntryHash, "Parties": w.Signers}
+			return
+		},
+	},
+	{
+		Name:             "update",
+		Doc:              "commits an entry that replaces an earlier one and returns its hash",
+		Returns:          "Hash",
+		Args:             (&ActionMod{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			entry := &GobEntry{C: args[1].value.(string)}
+			result, err = hashResult(NewModAction(args[0].value.(string), entry, args[2].value.(Hash)).Do(h))
+			return
+		},
+	},
+	{
+		Name:             "updateAgent",
+		Doc:              "changes the agent's identity or revokes its key and returns the hash of the new agent entry",
+		Returns:          "Hash",
+		Args:             (&ActionModAgent{}).Args,
+		NonDeterministic: true,
+		UpdatesApp:       true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			var options ModAgentOptions
+			if err = hostOptions(args[0], &options); err != nil {
+				return
+			}
+			a := &ActionModAgent{Identity: AgentIdentity(options.Identity), Revocation: options.Revocation}
+			result, err = hashResult(a.Do(h))
+			return
+		},
+	},
+	{
+		Name:             "remove",
+		Doc:              "marks an entry as deleted and returns the hash of the deletion entry",
+		Returns:          "Hash",
+		Args:             (&ActionDel{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			entry := DelEntry{
+				Hash:    args[0].value.(Hash),
+				Message: args[1].value.(string),
+			}
+			var header *Header
+			header, err = h.chain.GetEntryHeader(entry.Hash)
+			if err != nil {
+				return
+			}
+			result, err = hashResult(NewDelAction(header.Type, entry).Do(h))
+			return
+		},
+	},
+	{
+		Name:             "query",
+		Doc:              "searches the local chain, returning what the Return option asks for",
+		Returns:          "any[]",
+		Args:             (&ActionQuery{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			a := &ActionQuery{options: &QueryOptions{}}
+			if len(args) > 0 {
+				if err = hostOptions(args[0], a.options); err != nil {
+					return
+				}
+			}
+			var r interface{}
+			r, err = a.Do(h)
+			if err != nil {
+				return
+			}
+			q := &hostQueryResult{results: r.([]QueryResult), options: a.options, defs: make(map[string]*EntryDef)}
+			if q.options.Return.Entries {
+				for _, qr := range q.results {
+					if err = hostEntryDef(h, q.defs, qr.Header.Type); err != nil {
+						return
+					}
+				}
+			}
+			result = q
+			return
+		},
+	},
+	{
+		Name:             "get",
+		Doc:              "gets an entry from the DHT, returning what the GetMask option asks for",
+		Returns:          "any",
+		Args:             (&ActionGet{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			options := GetOptions{StatusMask: StatusDefault}
+			if err = hostOptions(args[1], &options); err != nil {
+				return
+			}
+			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
+			var r interface{}
+			r, err = NewGetAction(req, &options).Do(h)
+			if err != nil {
+				return
+			}
+			mask := options.GetMask
+			if mask == GetMaskDefault {
+				mask = GetMaskEntry
+			}
+			result = &hostGetResult{resp: r.(GetResp), mask: mask}
+			return
+		},
+	},
+	{
+		Name:             "getLinks",
+		Doc:              "gets the links on a base with a tag, or with any tag if the tag is empty",
+		Returns:          "Link[]",
+		Args:             (&ActionGetLinks{}).Args,
+		NonDeterministic: true,
+		Do: func(h *Holochain, zome *Zome, args []Arg) (result interface{}, err error) {
+			base := args[0].value.(Hash)
+			tag := args[1].value.(string)
+			options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+			if err = hostOptions(args[2], &options); err != nil {
+				return
+			}
+			var r interface{}
+			r, err = NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
+			if err != nil {
+				return
+			}
+			l := &hostLinksResult{links: r.(*LinkQueryResp).Links, tag: tag, load: options.Load, defs: make(map[string]*EntryDef)}
+			if l.load {
+				for _, th := range l.links {
+					if err = hostEntryDef(h, l.defs, th.EntryType); err != nil {
+						return
+					}
+				}
+			}
+			result = l
+			return
+		},
+	},
+}
+
+// GetHostFn returns the registered API function with the given name
+func GetHostFn(name string) (fn *HostFn, err error) {
+	for i := range HostFns {
+		if HostFns[i].Name == name {
+			fn = &HostFns[i]
+			return
+		}
+	}
+	err = fmt.Errorf("unknown API function: %s", name)
+	return
+}
+
+// hostOptions decodes an options argument onto the defaults already in v.  Options not
+// passed by the zome code leave v as is.
+func hostOptions(arg Arg, v interface{}) (err error) {
+	if arg.value == nil {
+		return
+	}
+	j, err := json.Marshal(arg.value)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(j, v)
+	if err != nil {
+		err = fmt.Errorf("bad %s argument: %v", arg.Name, err)
+	}
+	return
+}
+
+// hostArgs returns the string value of an ArgsArg and whether it was passed as an object
+func hostArgs(arg Arg) (params string, isObject bool) {
+	switch t := arg.value.(type) {
+	case json.RawMessage:
+		params = string(t)
+		isObject = true
+	case string:
+		params = t
+	}
+	return
+}
+
+// hostEntryDef looks up the def for an entry type unless it's already in defs
+func hostEntryDef(h *Holochain, defs map[string]*EntryDef, entryType string) (err error) {
+	if _, ok := defs[entryType]; ok {
+		return
+	}
+	var def *EntryDef
+	_, def, err = h.GetEntryDef(entryType)
+	if err == nil {
+		defs[entryType] = def
+	}
+	return
+}
+
+// hashResult converts the hash an action returns to its string
+func hashResult(r interface{}, err error) (result interface{}, e error) {
+	e = err
+	if e != nil {
+		return
+	}
+	var hash Hash
+	if r != nil {
+		hash = r.(Hash)
+	}
+	result = hash.String()
+	return
+}
@@ -0,0 +1,72 @@
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestHostFns(t *testing.T) {
+	Convey("host functions should have unique names", t, func() {
+		names := make(map[string]bool)
+		for _, fn := range HostFns {
+			So(names[fn.Name], ShouldBeFalse)
+			names[fn.Name] = true
+		}
+	})
+
+	Convey("GetHostFn should return the registered function", t, func() {
+		fn, err := GetHostFn("commit")
+		So(err, ShouldBeNil)
+		So(fn.Name, ShouldEqual, "commit")
+		So(fn.NonDeterministic, ShouldBeTrue)
+		So(len(fn.Args()), ShouldEqual, 2)
+
+		_, err = GetHostFn("fish")
+		So(err.Error(), ShouldEqual, "unknown API function: fish")
+	})
+
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("every host function should be bound in the JS ribosome", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		for _, fn := range HostFns {
+			_, err = z.Run(fn.Name + `(1,2,3,4,5)`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, "HolochainError: wrong number of arguments")
+		}
+	})
+
+	Convey("every host function should be bound in the Zygo ribosome", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		for _, fn := range HostFns {
+			_, err = z.Run(`(` + fn.Name + ` 1 2 3 4 5)`)
+			So(err.Error(), ShouldEqual, fmt.Sprintf("Zygomys exec error: Error calling '%s': wrong number of arguments", fn.Name))
+		}
+	})
+
+	Convey("every host function should be callable through the JSON API", t, func() {
+		raw := []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`2`), json.RawMessage(`3`), json.RawMessage(`4`), json.RawMessage(`5`)}
+		for _, fn := range HostFns {
+			_, err := jsonAPICall(h, &Zome{Name: "test"}, false, false, fn.Name, raw)
+			So(err, ShouldEqual, ErrWrongNargs)
+		}
+	})
+
+	Convey("options should be decoded onto their defaults", t, func() {
+		options := GetLinksOptions{StatusMask: StatusLive}
+		err := hostOptions(Arg{Name: "options", value: map[string]interface{}{"Load": true}}, &options)
+		So(err, ShouldBeNil)
+		So(options.Load, ShouldBeTrue)
+		So(options.StatusMask, ShouldEqual, StatusLive)
+
+		err = hostOptions(Arg{Name: "options", value: map[string]interface{}{"Load": "yes"}}, &options)
+		So(err.Error(), ShouldContainSubstring, "bad options argument")
+	})
+}
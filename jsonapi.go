@@ -0,0 +1,356 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// the holochain API for ribosomes whose zome code doesn't live in a Go vm and so exchanges
+// JSON values with the host
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	b58 "github.com/jbenet/go-base58"
+	. "github.com/metacurrency/holochain/hash"
+	"time"
+)
+
+// jsonAPIFns returns the names of the API functions callable through jsonAPICall
+func jsonAPIFns() (fns []string) {
+	fns = []string{"app"}
+	for _, fn := range HostFns {
+		fns = append(fns, fn.Name)
+	}
+	return
+}
+
+// jsonAPIResult is what an API call made over JSON returns to the zome code
+type jsonAPIResult struct {
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// jsonProcessArgs processes the raw JSON values according to the args spec filling
+// args[].value with the converted value
+func jsonProcessArgs(h *Holochain, args []Arg, raw []json.RawMessage) (err error) {
+	err = checkArgCount(args, len(raw))
+	if err != nil {
+		return err
+	}
+
+	for i, arg := range raw {
+		switch args[i].Type {
+		case StringArg:
+			var str string
+			if json.Unmarshal(arg, &str) != nil {
+				return argErr("string", i+1, args[i])
+			}
+			args[i].value = str
+		case HashArg:
+			var str string
+			if json.Unmarshal(arg, &str) != nil {
+				return argErr("string", i+1, args[i])
+			}
+			var hash Hash
+			hash, err = NewHash(str)
+			if err != nil {
+				return
+			}
+			args[i].value = hash
+		case IntArg:
+			var integer int64
+			if json.Unmarshal(arg, &integer) != nil {
+				return argErr("int", i+1, args[i])
+			}
+			args[i].value = integer
+		case BoolArg:
+			var boolean bool
+			if json.Unmarshal(arg, &boolean) != nil {
+				return argErr("boolean", i+1, args[i])
+			}
+			args[i].value = boolean
+		case ArgsArg:
+			// strings are passed as is and objects as their JSON
+			var str string
+			var m map[string]interface{}
+			if json.Unmarshal(arg, &str) == nil {
+				args[i].value = str
+			} else if json.Unmarshal(arg, &m) == nil && m != nil {
+				args[i].value = arg
+			} else {
+				return argErr("string or object", i+1, args[i])
+			}
+		case ToStrArg:
+			// strings are passed as is and anything else as its JSON
+			var str string
+			if json.Unmarshal(arg, &str) != nil {
+				str = string(arg)
+			}
+			args[i].value = str
+		case EntryArg:
+			// this a special case in that all EntryArgs must be preceeded by
+			// string arg that specifies the entry type
+			entryType, ok := args[i-1].value.(string)
+			if !ok {
+				return argErr("string", i, args[i-1])
+			}
+			_, def, err := h.GetEntryDef(entryType)
+			if err != nil {
+				return err
+			}
+			var entry string
+			switch def.DataFormat {
+			case DataFormatRawJS:
+				fallthrough
+			case DataFormatRawZygo:
+				fallthrough
+			case DataFormatString:
+				if json.Unmarshal(arg, &entry) != nil {
+					return argErr("string", i+1, args[i])
+				}
+			case DataFormatLinks:
+				var m map[string]interface{}
+				if json.Unmarshal(arg, &m) != nil {
+					return argErr("object", i+1, args[i])
+				}
+				fallthrough
+			case DataFormatJSON:
+				entry = string(arg)
+			default:
+				err = errors.New("data format not implemented: " + def.DataFormat)
+				return err
+			}
+			args[i].value = entry
+		case MapArg:
+			var m map[string]interface{}
+			if json.Unmarshal(arg, &m) != nil {
+				return argErr("object", i+1, args[i])
+			}
+			args[i].value = m
+		}
+	}
+	return
+}
+
+// jsonOptions decodes the optional options argument at index i onto the defaults in v
+func jsonOptions(raw []json.RawMessage, i int, v interface{}) (err error) {
+	if len(raw) > i {
+		err = json.Unmarshal(raw[i], v)
+	}
+	return
+}
+
+// jsonEntryValue returns the entry content as the zome code should see it
+func jsonEntryValue(def *EntryDef, content interface{}) (value interface{}, err error) {
+	switch def.DataFormat {
+	case DataFormatRawJS:
+		fallthrough
+	case DataFormatRawZygo:
+		fallthrough
+	case DataFormatString:
+		value = content
+	case DataFormatLinks:
+		fallthrough
+	case DataFormatJSON:
+		// content that isn't valid JSON would make the whole message invalid, so it is
+		// passed as a string instead
+		s := content.(string)
+		var v interface{}
+		if json.Unmarshal([]byte(s), &v) == nil {
+			value = json.RawMessage(s)
+		} else {
+			value = s
+		}
+	case DataFormatSysKey:
+		value = fmt.Sprintf("%v", content)
+	case DataFormatSysAgent:
+		value = content
+	default:
+		err = errors.New("data format not implemented: " + def.DataFormat)
+	}
+	return
+}
+
+func prepareJSONEntryArgs(def *EntryDef, entry Entry, header *Header) (args []interface{}, err error) {
+	var e interface{}
+	e, err = jsonEntryValue(def, entry.Content())
+	if err != nil {
+		return
+	}
+	hdr := map[string]string{"EntryLink": "", "Type": "", "Time": ""}
+	if header != nil {
+		hdr["EntryLink"] = header.EntryLink.String()
+		hdr["Type"] = header.Type
+		hdr["Time"] = header.Time.UTC().Format(time.RFC3339)
+	}
+	args = []interface{}{e, hdr}
+	return
+}
+
+func prepareJSONValidateArgs(action Action, def *EntryDef) (args []interface{}, err error) {
+	switch t := action.(type) {
+	case *ActionPut:
+		args, err = prepareJSONEntryArgs(def, t.entry, t.header)
+	case *ActionCommit:
+		args, err = prepareJSONEntryArgs(def, t.entry, t.header)
+	case *ActionMod:
+		args, err = prepareJSONEntryArgs(def, t.entry, t.header)
+		if err == nil {
+			args = append(args, t.replaces.String())
+		}
+	case *ActionDel:
+		args = []interface{}{t.entry.Hash.String()}
+	case *ActionLink:
+		args = []interface{}{t.validationBase.String(), t.links}
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+	}
+	return
+}
+
+// jsonValidateArgs returns the arguments for the action's validation callback
+func jsonValidateArgs(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (args []interface{}, err error) {
+	args, err = prepareJSONValidateArgs(action, def)
+	if err != nil {
+		return
+	}
+	pkgObj := map[string]interface{}{}
+	if pkg != nil && pkg.Chain != nil {
+		pkgObj["Chain"] = pkg.Chain
+	}
+	args = append([]interface{}{def.Name}, args...)
+	args = append(args, pkgObj, sources)
+	return
+}
+
+// jsonAPICall runs the named API function on behalf of the zome with the raw JSON arguments,
+// as called by validation callbacks when validating
+func jsonAPICall(h *Holochain, zome *Zome, validating bool, strict bool, fn string, raw []json.RawMessage) (result interface{}, err error) {
+	if fn == "app" {
+		// what the JS and Zygo ribosomes provide as globals
+		result = map[string]interface{}{
+			"Name":  h.Name(),
+			"DNA":   map[string]interface{}{"Hash": h.dnaHash.String()},
+			"Agent": map[string]interface{}{"Hash": h.agentHash.String(), "TopHash": h.agentTopHash.String(), "String": string(h.Agent().Identity())},
+			"Key":   map[string]interface{}{"Hash": h.nodeIDStr},
+		}
+		return
+	}
+	hf, err := GetHostFn(fn)
+	if err != nil {
+		return
+	}
+	if strict && hf.NonDeterministic {
+		err = strictValidationErr(fn)
+		return
+	}
+	args := hf.Args()
+	if err = jsonProcessArgs(h, args, raw); err != nil {
+		return
+	}
+	var r interface{}
+	r, err = hf.run(h, zome, args, validating)
+	if err != nil {
+		return
+	}
+	result, err = jsonValue(r)
+	return
+}
+
+// jsonValue converts the result of a host function to what is returned as JSON
+func jsonValue(r interface{}) (result interface{}, err error) {
+	switch t := r.(type) {
+	case *hostQueryResult:
+		result, err = jsonQuery(t)
+	case *hostGetResult:
+		result = jsonGet(t)
+	case *hostLinksResult:
+		result, err = jsonGetLinks(t)
+	case hostSignature:
+		// base58 so that it can be passed to verifySignature
+		result = b58.Encode(t)
+	default:
+		result = r
+	}
+	return
+}
+
+func jsonQuery(q *hostQueryResult) (result interface{}, err error) {
+	results := make([]interface{}, 0)
+	for _, qr := range q.results {
+		item := make(map[string]interface{})
+		if q.options.Return.Hashes {
+			item["Hash"] = qr.Header.EntryLink.String()
+		}
+		if q.options.Return.Headers {
+			item["Header"] = map[string]interface{}{
+				"Type":       qr.Header.Type,
+				"Time":       qr.Header.Time,
+				"EntryLink":  qr.Header.EntryLink.String(),
+				"HeaderLink": qr.Header.HeaderLink.String(),
+				"TypeLink":   qr.Header.TypeLink.String(),
+			}
+		}
+		if q.options.Return.Entries {
+			item["Entry"], err = jsonEntryValue(q.defs[qr.Header.Type], qr.Entry.Content())
+			if err != nil {
+				return
+			}
+		}
+		if len(item) == 1 {
+			// a single kind of return value is returned bare
+			for _, v := range item {
+				results = append(results, v)
+			}
+		} else {
+			results = append(results, item)
+		}
+	}
+	result = results
+	return
+}
+
+func jsonGet(g *hostGetResult) (result interface{}) {
+	switch g.mask {
+	case GetMaskEntry:
+		result = g.resp.Entry.Content()
+	case GetMaskEntryType:
+		result = g.resp.EntryType
+	case GetMaskSources:
+		result = g.resp.Sources
+	default:
+		respObj := make(map[string]interface{})
+		if g.mask&GetMaskEntry != 0 {
+			respObj["Entry"] = g.resp.Entry.Content()
+		}
+		if g.mask&GetMaskEntryType != 0 {
+			respObj["EntryType"] = g.resp.EntryType
+		}
+		if g.mask&GetMaskSources != 0 {
+			respObj["Sources"] = g.resp.Sources
+		}
+		result = respObj
+	}
+	return
+}
+
+func jsonGetLinks(l *hostLinksResult) (result interface{}, err error) {
+	links := make([]map[string]interface{}, 0)
+	for _, th := range l.links {
+		link := map[string]interface{}{"Hash": th.H}
+		if l.tag == "" {
+			link["Tag"] = th.T
+		}
+		if l.load {
+			link["EntryType"] = th.EntryType
+			link["Source"] = th.Source
+			link["Entry"], err = jsonEntryValue(l.defs[th.EntryType], th.E)
+			if err != nil {
+				return
+			}
+		}
+		links = append(links, link)
+	}
+	result = links
+	return
+}
@@ -0,0 +1,98 @@
+package holochain
+
+import (
+	"encoding/json"
+	b58 "github.com/jbenet/go-base58"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestJSONProcessArgs(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should convert the args according to the spec", t, func() {
+		args := []Arg{{Name: "hash", Type: HashArg}, {Name: "str", Type: StringArg}, {Name: "any", Type: ToStrArg}, {Name: "int", Type: IntArg}}
+		raw := []json.RawMessage{
+			json.RawMessage(`"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"`),
+			json.RawMessage(`"fish"`),
+			json.RawMessage(`{"a":1}`),
+			json.RawMessage(`42`),
+		}
+		err := jsonProcessArgs(h, args, raw)
+		So(err, ShouldBeNil)
+		So(args[0].value.(Hash).String(), ShouldEqual, "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(args[1].value.(string), ShouldEqual, "fish")
+		So(args[2].value.(string), ShouldEqual, `{"a":1}`)
+		So(args[3].value.(int64), ShouldEqual, 42)
+	})
+
+	Convey("it should check the arg count and types", t, func() {
+		args := []Arg{{Name: "str", Type: StringArg}}
+		err := jsonProcessArgs(h, args, []json.RawMessage{})
+		So(err, ShouldEqual, ErrWrongNargs)
+		err = jsonProcessArgs(h, args, []json.RawMessage{json.RawMessage(`1`)})
+		So(err.Error(), ShouldEqual, "argument 1 (str) should be string")
+	})
+}
+
+func TestJSONAPICall(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	zome, _ := h.GetZome("jsSampleZome")
+
+	Convey("it should run API functions", t, func() {
+		result, err := jsonAPICall(h, zome, false, false, "property", []json.RawMessage{json.RawMessage(`"description"`)})
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a bogus test holochain")
+
+		result, err = jsonAPICall(h, zome, false, false, "sign", []json.RawMessage{json.RawMessage(`"3"`)})
+		So(err, ShouldBeNil)
+		sig, _ := h.agent.PrivKey().Sign([]byte("3"))
+		So(result, ShouldEqual, b58.Encode(sig))
+
+		_, err = jsonAPICall(h, zome, false, false, "bogus", nil)
+		So(err.Error(), ShouldEqual, "unknown API function: bogus")
+	})
+
+	Convey("it should only give validation callbacks the DNA's properties", t, func() {
+		h.Config.InstanceProperties = map[string]string{"description": "local"}
+		defer func() { h.Config.InstanceProperties = nil }()
+		arg := []json.RawMessage{json.RawMessage(`"description"`)}
+		result, err := jsonAPICall(h, zome, false, false, "property", arg)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "local")
+		result, err = jsonAPICall(h, zome, true, false, "property", arg)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a bogus test holochain")
+		result, err = jsonAPICall(h, zome, true, true, "property", arg)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a bogus test holochain")
+	})
+
+	Convey("it should refuse non-deterministic functions when strict", t, func() {
+		_, err := jsonAPICall(h, zome, true, true, "get", []json.RawMessage{json.RawMessage(`"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"`)})
+		So(err.Error(), ShouldEqual, "get is not allowed in strict validation")
+	})
+}
+
+func TestJSONEntryValue(t *testing.T) {
+	def := &EntryDef{Name: "foo", DataFormat: DataFormatJSON}
+
+	Convey("it should pass JSON entries as is", t, func() {
+		v, err := jsonEntryValue(def, `{"a":1}`)
+		So(err, ShouldBeNil)
+		j, err := json.Marshal(v)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldEqual, `{"a":1}`)
+	})
+
+	Convey("it should pass malformed JSON entries as a string", t, func() {
+		v, err := jsonEntryValue(def, `{"a":`)
+		So(err, ShouldBeNil)
+		j, err := json.Marshal(v)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldEqual, `"{\"a\":"`)
+	})
+}
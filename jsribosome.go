@@ -9,9 +9,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
 	"github.com/robertkrimen/otto"
+	"path"
 	"strings"
 	"time"
 )
@@ -25,7 +25,10 @@ type JSRibosome struct {
 	h          *Holochain
 	zome       *Zome
 	vm         *otto.Otto
+	template   *otto.Otto // copy of the vm as it was after loading the zome code
 	lastResult *otto.Value
+	strict     bool // set while running validation callbacks in strict mode
+	validating bool // set while running validation callbacks
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -47,7 +50,7 @@ func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err e
 
 func (jsr *JSRibosome) boolFn(fnName string, args string) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(fnName + "(" + args + ")")
+	v, err = jsr.runLimited(GenesisExecution, fnName+"("+args+")")
 
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
@@ -69,6 +72,44 @@ func (jsr *JSRibosome) boolFn(fnName string, args string) (err error) {
 	return
 }
 
+// Hook runs the lifecycle callback of the given name, if the zome defines it
+func (jsr *JSRibosome) Hook(hook string, args ...string) (err error) {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = `"` + jsSanitizeString(a) + `"`
+	}
+	code := fmt.Sprintf(`typeof %s==="function"&&%s(%s)`, hook, hook, strings.Join(quoted, ","))
+	jsr.h.Debug(code)
+	_, err = jsr.runLimited(ReceiveExecution, code)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+	}
+	return
+}
+
+// BoolHook runs the callback of the given name, which must return a boolean, and returns
+// false if the zome doesn't define it
+func (jsr *JSRibosome) BoolHook(hook string, args ...string) (result bool, err error) {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = `"` + jsSanitizeString(a) + `"`
+	}
+	code := fmt.Sprintf(`typeof %s==="function"&&%s(%s)`, hook, hook, strings.Join(quoted, ","))
+	jsr.h.Debug(code)
+	var v otto.Value
+	v, err = jsr.runLimited(ReceiveExecution, code)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+		return
+	}
+	if !v.IsBoolean() {
+		err = fmt.Errorf("%s should return boolean, got: %v", hook, v)
+		return
+	}
+	result, err = v.ToBoolean()
+	return
+}
+
 // Receive calls the app receive function for node-to-node messages
 func (jsr *JSRibosome) Receive(from string, msg string) (response string, err error) {
 	var code string
@@ -77,7 +118,7 @@ func (jsr *JSRibosome) Receive(from string, msg string) (response string, err er
 	code = fmt.Sprintf(`JSON.stringify(%s("%s",JSON.parse("%s")))`, fnName, from, jsSanitizeString(msg))
 	jsr.h.Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.runLimited(ReceiveExecution, code)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -92,8 +133,18 @@ func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`%s("%s")`, fnName, def.Name)
 	jsr.h.Debug(code)
+	jsr.validating = true
+	defer func() { jsr.validating = false }()
+	if strictValidation(jsr.h) {
+		var leave func()
+		leave, err = jsr.enterStrict()
+		if err != nil {
+			return
+		}
+		defer leave()
+	}
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.runLimited(ValidateExecution, code)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -202,6 +253,16 @@ func (jsr *JSRibosome) ValidateAction(action Action, def *EntryDef, pkg *Validat
 		return
 	}
 	jsr.h.Debug(code)
+	jsr.validating = true
+	defer func() { jsr.validating = false }()
+	if strictValidation(jsr.h) {
+		var leave func()
+		leave, err = jsr.enterStrict()
+		if err != nil {
+			return
+		}
+		defer leave()
+	}
 	err = jsr.runValidate(action.Name(), code)
 	return
 }
@@ -232,7 +293,7 @@ func (jsr *JSRibosome) prepareJSValidateEntryArgs(def *EntryDef, entry Entry, so
 
 func (jsr *JSRibosome) runValidate(fnName string, code string) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.runLimited(ValidateExecution, code)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -280,6 +341,7 @@ const (
 		`,Rejected:` + StatusRejectedVal +
 		`,Deleted:` + StatusDeletedVal +
 		`,Modified:` + StatusModifiedVal +
+		`,Warning:` + StatusWarningVal +
 		`,Any:` + StatusAnyVal +
 		"}" +
 		`,GetMask:{Default:` + GetMaskDefaultStr +
@@ -332,7 +394,7 @@ func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	}
 	jsr.h.Debugf("JS Call: %s", code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.runLimited(CallExecution, code)
 	if err == nil {
 		if v.IsObject() && v.Class() == "Error" {
 			jsr.h.Debugf("JS Error:\n%v", v)
@@ -412,7 +474,7 @@ func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error)
 				if err != nil {
 					return err
 				}
-				args[i].value = entry
+				args[i].value = json.RawMessage(entry)
 
 			} else {
 				return argErr("string or object", i+1, args[i])
@@ -496,745 +558,359 @@ func mkOttoErr(jsr *JSRibosome, msg string) otto.Value {
 	return jsr.vm.MakeCustomError("HolochainError", msg)
 }
 
-func numInterfaceToInt(num interface{}) (val int, ok bool) {
-	ok = true
-	switch t := num.(type) {
-	case int64:
-		val = int(t)
-	case float64:
-		val = int(t)
-	case int:
-		val = t
-	default:
-		ok = false
-	}
-	return
-}
-
-// NewJSRibosome factory function to build a javascript execution environment for a zome
-func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
-	jsr := JSRibosome{
-		h:    h,
-		zome: zome,
-		vm:   otto.New(),
-	}
-
-	err = jsr.vm.Set("property", func(call otto.FunctionCall) otto.Value {
-		a := &ActionProperty{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+// bindHostFn adds a function of the host API to the vm.  Non-deterministic functions throw
+// instead of running when called during strict validation.
+func (jsr *JSRibosome) bindHostFn(fn *HostFn) error {
+	return jsr.vm.Set(fn.Name, func(call otto.FunctionCall) otto.Value {
+		if jsr.strict && fn.NonDeterministic {
+			panic(mkOttoErr(jsr, strictValidationErr(fn.Name).Error()))
 		}
-
-		a.prop = args[0].value.(string)
-
-		var p interface{}
-		p, err = a.Do(h)
-		if err != nil {
-			return otto.UndefinedValue()
-		}
-		result, _ := jsr.vm.ToValue(p)
-		return result
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	err = jsr.vm.Set("debug", func(call otto.FunctionCall) otto.Value {
-		a := &ActionDebug{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		a.msg = args[0].value.(string)
-		a.Do(h)
-		return otto.UndefinedValue()
-	})
-
-	err = jsr.vm.Set("makeHash", func(call otto.FunctionCall) otto.Value {
-		a := &ActionMakeHash{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		a.entryType = args[0].value.(string)
-		a.entry = &GobEntry{C: args[1].value.(string)}
-		var r interface{}
-		r, err = a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var entryHash Hash
-		if r != nil {
-			entryHash = r.(Hash)
-		}
-		result, _ := jsr.vm.ToValue(entryHash.String())
-		return result
-	})
-
-	//===========================================================================
-	err = jsr.vm.Set("getBridges", func(call otto.FunctionCall) otto.Value {
-		a := &ActionGetBridges{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		r, err := a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var code string
-		for i, b := range r.([]Bridge) {
-			if i > 0 {
-				code += ","
-			}
-			if b.Side == BridgeTo {
-				code += fmt.Sprintf(`{Side:%d,Token:"%s"}`, b.Side, b.Token)
-			} else {
-				code += fmt.Sprintf(`{Side:%d,ToApp:"%s"}`, b.Side, b.ToApp.String())
-			}
-		}
-		code = "[" + code + "]"
-		object, _ := jsr.vm.Object(code)
-		result, _ := jsr.vm.ToValue(object)
-
-		return result
-	})
-
-	//===========================================================================
-	err = jsr.vm.Set("sign", func(call otto.FunctionCall) otto.Value {
-		a := &ActionSign{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		args := fn.Args()
+		err := jsProcessArgs(jsr, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(jsr, err.Error())
 		}
-
-		a.doc = []byte(args[0].value.(string))
 		var r interface{}
-		r, err = a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var signature []byte
-		if r != nil {
-			signature = r.([]byte)
-		}
-		result, _ := jsr.vm.ToValue(string(signature))
-		return result
-	})
-
-	err = jsr.vm.Set("verifySignature", func(call otto.FunctionCall) otto.Value {
-
-		a := &ActionVerifySignature{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		a.signature = args[0].value.(string)
-		a.data = args[1].value.(string)
-		a.pubKey = args[2].value.(string)
-		var r bool
-		r, err = a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+		r, err = fn.run(jsr.h, jsr.zome, args, jsr.validating)
+		if err == nil && fn.UpdatesApp {
+			err = jsr.updateApp()
 		}
 		var result otto.Value
-		result, err = jsr.vm.ToValue(r)
-
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		return result
-	})
-
-	//============================================================================
-
-	err = jsr.vm.Set("send", func(call otto.FunctionCall) otto.Value {
-		a := &ActionSend{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-
-		a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		msg := args[1].value.(map[string]interface{})
-		var j []byte
-		j, err = json.Marshal(msg)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-
-		a.msg.ZomeType = jsr.zome.Name
-		a.msg.Body = string(j)
-
-		if args[2].value != nil {
-			a.options = &SendOptions{}
-			opts := args[2].value.(map[string]interface{})
-			cbmap, ok := opts["Callback"]
-			if ok {
-				callback := Callback{zomeType: zome.Name}
-				v, ok := cbmap.(map[string]interface{})["Function"]
-				if !ok {
-					return mkOttoErr(&jsr, "callback option requires Function")
-				}
-				callback.Function = v.(string)
-				v, ok = cbmap.(map[string]interface{})["ID"]
-				if !ok {
-					return mkOttoErr(&jsr, "callback option requires ID")
-				}
-				callback.ID = v.(string)
-				a.options.Callback = &callback
-			}
-			timeout, ok := opts["Timeout"]
-			if ok {
-				a.options.Timeout = int(timeout.(int64))
-			}
-		}
-
-		var r interface{}
-		r, err = a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+		if err == nil {
+			result, err = jsr.toValue(r)
 		}
-		var result otto.Value
-		result, err = jsr.vm.ToValue(r)
-
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(jsr, err.Error())
 		}
 		return result
 	})
+}
 
-	err = jsr.vm.Set("call", func(call otto.FunctionCall) otto.Value {
-		a := &ActionCall{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		a.zome = args[0].value.(string)
-		var zome *Zome
-		zome, err = h.GetZome(a.zome)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		a.function = args[1].value.(string)
-		var fn *FunctionDef
-		fn, err = zome.GetFunctionDef(a.function)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		if fn.CallingType == JSON_CALLING {
-			if !call.ArgumentList[2].IsObject() {
-				return mkOttoErr(&jsr, "function calling type requires object argument type")
-			}
-		}
-		a.args = args[2].value.(string)
-
-		var r interface{}
-		r, err = a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var result otto.Value
-		result, err = jsr.vm.ToValue(r)
-
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+// jsRequire builds require from the Go functions that resolve and load modules.  The loaded
+// modules are kept in the vm so that they are part of the template copied by Reset.
+const jsRequire = `(function(resolve,load,main){
+var cache={};
+function requireFrom(from){return function(name){
+var key=resolve(from,name);
+if(cache.hasOwnProperty(key)){return cache[key].exports}
+var module={exports:{}};cache[key]=module;
+load(key)(module,module.exports,requireFrom(key));
+return module.exports}}
+return requireFrom(main)})`
+
+// module returns the code of a module required by the zome
+func (jsr *JSRibosome) module(lib bool, p string) (code string, ok bool) {
+	modules := jsr.zome.Modules
+	if lib {
+		modules = nil
+		if jsr.h != nil && jsr.h.nucleus != nil && jsr.h.nucleus.dna != nil {
+			modules = jsr.h.nucleus.dna.SharedModules
 		}
-		return result
-	})
+	}
+	code, ok = modules[p]
+	return
+}
 
-	err = jsr.vm.Set("bridge", func(call otto.FunctionCall) otto.Value {
-		a := &ActionBridge{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		hash := args[0].value.(Hash)
-		a.token, a.url, err = h.GetBridgeToken(hash)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+// bindRequire adds require to the vm.  The zome's code is the main module, at the root of
+// the zome's directory.
+func (jsr *JSRibosome) bindRequire() (err error) {
+	has := func(lib bool, p string) bool {
+		_, ok := jsr.module(lib, p)
+		return ok
+	}
+	resolve := func(call otto.FunctionCall) otto.Value {
+		from, _ := call.Argument(0).ToString()
+		name, _ := call.Argument(1).ToString()
+		fromLib, p := parseJSModuleKey(from)
+		p, lib, err := resolveModule(has, fromLib, path.Dir(p), name)
+		if _, ok := err.(jsModuleNotFoundError); ok {
+			// most likely required by a name computed at run time
+			err = fmt.Errorf("%v, only modules required with a string literal are included in the DNA", err)
 		}
-
-		a.zome = args[1].value.(string)
-		a.function = args[2].value.(string)
-		a.args = args[3].value.(string)
-
-		var r interface{}
-		r, err = a.Do(h)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			panic(mkOttoErr(jsr, err.Error()))
 		}
-		var result otto.Value
-		result, err = jsr.vm.ToValue(r)
-
+		v, _ := jsr.vm.ToValue(jsModuleKey(lib, p))
+		return v
+	}
+	load := func(call otto.FunctionCall) otto.Value {
+		key, _ := call.Argument(0).ToString()
+		code, _ := jsr.module(parseJSModuleKey(key))
+		v, err := jsr.vm.Run("(function(module,exports,require){" + code + "\n})")
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			panic(mkOttoErr(jsr, fmt.Sprintf("error loading module %s: %v", key, err)))
 		}
-		return result
-	})
+		return v
+	}
+	f, err := jsr.vm.Run(jsRequire)
+	if err != nil {
+		return
+	}
+	r, err := f.Call(otto.NullValue(), resolve, load, jsModuleKey(false, ""))
+	if err != nil {
+		return
+	}
+	err = jsr.vm.Set("require", r)
+	return
+}
 
-	err = jsr.vm.Set("commit", func(call otto.FunctionCall) otto.Value {
-		var a Action = &ActionCommit{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
+// updateApp sets the values in the App global that host functions can change
+func (jsr *JSRibosome) updateApp() (err error) {
+	h := jsr.h
+	_, err = jsr.vm.Run(fmt.Sprintf(`App.Key.Hash="%s";App.Agent.TopHash="%s";App.Agent.String="%s"`,
+		h.nodeIDStr, h.agentTopHash.String(), jsSanitizeString(string(h.Agent().Identity()))))
+	return
+}
 
-		entryType := args[0].value.(string)
-		entryStr := args[1].value.(string)
-		var r interface{}
-		entry := GobEntry{C: entryStr}
-		r, err = NewCommitAction(entryType, &entry).Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var entryHash Hash
-		if r != nil {
-			entryHash = r.(Hash)
+// toValue converts the result of a host function to a javascript value
+func (jsr *JSRibosome) toValue(r interface{}) (result otto.Value, err error) {
+	var code string
+	switch t := r.(type) {
+	case nil:
+		result = otto.UndefinedValue()
+		return
+	case string, bool:
+		return jsr.vm.ToValue(t)
+	case *hostGetResult:
+		return jsr.getValue(t)
+	case *hostQueryResult:
+		code, err = jsQueryCode(t)
+	case *hostLinksResult:
+		code, err = jsLinksCode(t)
+	case hostSignature:
+		return jsr.vm.ToValue(string(t))
+	default:
+		var j []byte
+		j, err = json.Marshal(r)
+		if err == nil {
+			result, err = jsr.vm.Call("JSON.parse", nil, string(j))
 		}
-
-		result, _ := jsr.vm.ToValue(entryHash.String())
-		return result
-	})
+		return
+	}
 	if err != nil {
-		return nil, err
+		return
 	}
+	jsr.h.Debugf("host result code:%s\n", code)
+	var object *otto.Object
+	object, err = jsr.vm.Object(code)
+	if err == nil {
+		result = object.Value()
+	}
+	return
+}
 
-	err = jsr.vm.Set("query", func(call otto.FunctionCall) otto.Value {
-		a := &ActionQuery{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-
-		if len(call.ArgumentList) == 1 {
-			options := QueryOptions{}
+// jsEntryCode returns the javascript code for an entry's value
+func jsEntryCode(def *EntryDef, content interface{}) (code string, err error) {
+	switch def.DataFormat {
+	case DataFormatRawJS:
+		code = content.(string)
+	case DataFormatRawZygo:
+		fallthrough
+	case DataFormatString:
+		code = `"` + jsSanitizeString(content.(string)) + `"`
+	case DataFormatSysKey:
+		code = fmt.Sprintf("%v", content)
+	case DataFormatSysAgent:
+		if agent, ok := content.(AgentEntry); ok {
 			var j []byte
-			j, err = json.Marshal(args[0].value)
-			if err != nil {
-				return mkOttoErr(&jsr, err.Error())
-			}
-			jsr.h.Debugf("Query options: %s", string(j))
-			err = json.Unmarshal(j, &options)
+			j, err = json.Marshal(agent)
 			if err != nil {
-				return mkOttoErr(&jsr, err.Error())
+				return
 			}
-			a.options = &options
-		}
-		r, err := a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			content = string(j)
 		}
-		qr := r.([]QueryResult)
+		fallthrough
+	case DataFormatLinks:
+		fallthrough
+	case DataFormatJSON:
+		code = `JSON.parse("` + jsSanitizeString(content.(string)) + `")`
+	default:
+		err = errors.New("data format not implemented: " + def.DataFormat)
+	}
+	return
+}
 
-		defs := make(map[string]*EntryDef)
-		var code string
-		for i, result := range qr {
-			if i > 0 {
-				code += ","
-			}
-			var entryCode, hashCode, headerCode string
-			var returnCount int
-			if a.options.Return.Hashes {
-				returnCount += 1
-				hashCode = `"` + result.Header.EntryLink.String() + `"`
+func jsQueryCode(q *hostQueryResult) (code string, err error) {
+	for i, result := range q.results {
+		if i > 0 {
+			code += ","
+		}
+		var entryCode, hashCode, headerCode string
+		var returnCount int
+		if q.options.Return.Hashes {
+			returnCount += 1
+			hashCode = `"` + result.Header.EntryLink.String() + `"`
+		}
+		if q.options.Return.Headers {
+			returnCount += 1
+			headerCode = fmt.Sprintf(
+				`{Type:"%s",Time:"%v",EntryLink:"%s",HeaderLink:"%s",TypeLink:"%s",}`,
+				jsSanitizeString(result.Header.Type),
+				result.Header.Time,
+				result.Header.EntryLink.String(),
+				result.Header.HeaderLink.String(),
+				result.Header.TypeLink.String(),
+			)
+		}
+		if q.options.Return.Entries {
+			returnCount += 1
+			entryCode, err = jsEntryCode(q.defs[result.Header.Type], result.Entry.Content())
+			if err != nil {
+				return
 			}
-			if a.options.Return.Headers {
-				returnCount += 1
-				headerCode = fmt.Sprintf(
-					`{Type:"%s",Time:"%v",EntryLink:"%s",HeaderLink:"%s",TypeLink:"%s",}`,
-					jsSanitizeString(result.Header.Type),
-					result.Header.Time,
-					result.Header.EntryLink.String(),
-					result.Header.HeaderLink.String(),
-					result.Header.TypeLink.String(),
-				)
+		}
+		if returnCount == 1 {
+			code += entryCode + hashCode + headerCode
+		} else {
+			var c string
+			if entryCode != "" {
+				c += "Entry:" + entryCode
 			}
-			if a.options.Return.Entries {
-				returnCount += 1
-
-				var def *EntryDef
-				var ok bool
-				def, ok = defs[result.Header.Type]
-				if !ok {
-					_, def, err = h.GetEntryDef(result.Header.Type)
-					if err != nil {
-						return mkOttoErr(&jsr, err.Error())
-					}
-					defs[result.Header.Type] = def
-				}
-				r := result.Entry.Content()
-				switch def.DataFormat {
-				case DataFormatRawJS:
-					entryCode = r.(string)
-				case DataFormatString:
-					entryCode = fmt.Sprintf(`"%s"`, jsSanitizeString(r.(string)))
-				case DataFormatLinks:
-					fallthrough
-				case DataFormatJSON:
-					entryCode = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(r.(string)))
-				case DataFormatSysAgent:
-					j, err := json.Marshal(r.(AgentEntry))
-					if err != nil {
-						return mkOttoErr(&jsr, err.Error())
-					}
-					entryCode = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(string(j)))
-				default:
-					return mkOttoErr(&jsr, "data format not implemented: "+def.DataFormat)
+			if hashCode != "" {
+				if c != "" {
+					c += ","
 				}
+				c += "Hash:" + hashCode
 			}
-			if returnCount == 1 {
-				code += entryCode + hashCode + headerCode
-			} else {
-				var c string
-				if entryCode != "" {
-					c += "Entry:" + entryCode
-				}
-				if hashCode != "" {
-					if c != "" {
-						c += ","
-					}
-					c += "Hash:" + hashCode
-				}
-				if headerCode != "" {
-					if c != "" {
-						c += ","
-					}
-					c += "Header:" + headerCode
+			if headerCode != "" {
+				if c != "" {
+					c += ","
 				}
-				code += "{" + c + "}"
+				c += "Header:" + headerCode
 			}
-
+			code += "{" + c + "}"
 		}
-		code = "[" + code + "]"
-		jsr.h.Debugf("Query Code:%s\n", code)
-		object, _ := jsr.vm.Object(code)
-		results, _ := jsr.vm.ToValue(object)
-		return results
-	})
+	}
+	code = "[" + code + "]"
+	return
+}
 
-	err = jsr.vm.Set("get", func(call otto.FunctionCall) (result otto.Value) {
-		var a Action = &ActionGet{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+func jsLinksCode(l *hostLinksResult) (code string, err error) {
+	for i, th := range l.links {
+		var c string
+		c = `Hash:"` + th.H + `"`
+		if l.tag == "" {
+			c += `,Tag:"` + jsSanitizeString(th.T) + `"`
 		}
-
-		options := GetOptions{StatusMask: StatusDefault}
-		if len(call.ArgumentList) == 2 {
-			opts := args[1].value.(map[string]interface{})
-			mask, ok := opts["StatusMask"]
-			if ok {
-				// otto returns int64 or float64 depending on whether
-				// the mask was returned by constant or addition so
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int StatusMask attribute, got %T", mask))
-				}
-				options.StatusMask = int(maskval)
-			}
-			mask, ok = opts["GetMask"]
-			if ok {
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int GetMask attribute, got %T", mask))
-				}
-				options.GetMask = int(maskval)
-			}
-			local, ok := opts["Local"]
-			if ok {
-				options.Local = local.(bool)
-			}
-		}
-		req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
-		var r interface{}
-		r, err = NewGetAction(req, &options).Do(h)
-		mask := options.GetMask
-		if mask == GetMaskDefault {
-			mask = GetMaskEntry
-		}
-		if err == nil {
-			getResp := r.(GetResp)
-			var singleValueReturn bool
-			if mask&GetMaskEntry != 0 {
-				if GetMaskEntry == mask {
-					singleValueReturn = true
-					result, err = jsr.vm.ToValue(getResp.Entry.Content())
-				}
-			}
-			if mask&GetMaskEntryType != 0 {
-				if GetMaskEntryType == mask {
-					singleValueReturn = true
-					result, err = jsr.vm.ToValue(getResp.EntryType)
-				}
-			}
-			if mask&GetMaskSources != 0 {
-				if GetMaskSources == mask {
-					singleValueReturn = true
-					result, err = jsr.vm.ToValue(getResp.Sources)
-				}
-			}
-			if err == nil && !singleValueReturn {
-				respObj := make(map[string]interface{})
-				if mask&GetMaskEntry != 0 {
-					respObj["Entry"] = getResp.Entry.Content()
-				}
-				if mask&GetMaskEntryType != 0 {
-					respObj["EntryType"] = getResp.EntryType
-				}
-				if mask&GetMaskSources != 0 {
-					respObj["Sources"] = getResp.Sources
-				}
-				result, err = jsr.vm.ToValue(respObj)
+		if l.load {
+			c += `,EntryType:"` + jsSanitizeString(th.EntryType) + `"`
+			c += `,Source:"` + jsSanitizeString(th.Source) + `"`
+			var entry string
+			entry, err = jsEntryCode(l.defs[th.EntryType], th.E)
+			if err != nil {
+				return
 			}
-			return
+			c += `,Entry:` + entry
 		}
-
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+		if i > 0 {
+			code += ","
 		}
-		panic("Shouldn't get here!")
-	})
-	if err != nil {
-		return nil, err
+		code += `{` + c + `}`
 	}
+	code = `[` + code + `]`
+	return
+}
 
-	err = jsr.vm.Set("update", func(call otto.FunctionCall) (result otto.Value) {
-		var a Action = &ActionMod{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+func (jsr *JSRibosome) getValue(g *hostGetResult) (result otto.Value, err error) {
+	switch g.mask {
+	case GetMaskEntry:
+		result, err = jsr.vm.ToValue(g.resp.Entry.Content())
+	case GetMaskEntryType:
+		result, err = jsr.vm.ToValue(g.resp.EntryType)
+	case GetMaskSources:
+		result, err = jsr.vm.ToValue(g.resp.Sources)
+	default:
+		respObj := make(map[string]interface{})
+		if g.mask&GetMaskEntry != 0 {
+			respObj["Entry"] = g.resp.Entry.Content()
 		}
-		entryType := args[0].value.(string)
-		entryStr := args[1].value.(string)
-		replaces := args[2].value.(Hash)
-
-		entry := GobEntry{C: entryStr}
-		resp, err := NewModAction(entryType, &entry, replaces).Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+		if g.mask&GetMaskEntryType != 0 {
+			respObj["EntryType"] = g.resp.EntryType
 		}
-		var entryHash Hash
-		if resp != nil {
-			entryHash = resp.(Hash)
+		if g.mask&GetMaskSources != 0 {
+			respObj["Sources"] = g.resp.Sources
 		}
-		result, _ = jsr.vm.ToValue(entryHash.String())
+		result, err = jsr.vm.ToValue(respObj)
+	}
+	return
+}
 
-		return
+const (
+	// jsStrictGlobals replaces the clock and random number globals with ones that throw.
+	// Dates can still be made from explicit values.  The real Date stays reachable as the
+	// constructor of dates and of its prototype, so that is pointed at the replacement too.
+	jsStrictGlobals = `(function(){
+var D=Date;
+var notAllowed=function(fn){return function(){throw new Error(fn+" is not allowed in strict validation")}};
+var SD=function(a,b,c,d,e,f,g){
+switch(arguments.length){
+case 0:notAllowed("Date without arguments")();
+case 1:return new D(a);
+case 2:return new D(a,b);
+case 3:return new D(a,b,c);
+case 4:return new D(a,b,c,d);
+case 5:return new D(a,b,c,d,e);
+case 6:return new D(a,b,c,d,e,f);
+default:return new D(a,b,c,d,e,f,g);
+}};
+SD.prototype=D.prototype;SD.UTC=D.UTC;SD.parse=D.parse;SD.now=notAllowed("Date.now");
+D.prototype.constructor=SD;D.now=SD.now;
+Date=SD;
+Math.random=notAllowed("Math.random");
+})()`
+)
 
-	})
+// enterStrict puts the vm into strict validation mode and returns the function that leaves it
+func (jsr *JSRibosome) enterStrict() (leave func(), err error) {
+	date, err := jsr.vm.Get("Date")
 	if err != nil {
-		return nil, err
+		return
 	}
-
-	err = jsr.vm.Set("updateAgent", func(call otto.FunctionCall) (result otto.Value) {
-		a := &ActionModAgent{}
-		//		var a Action = &ActionModAgent{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		opts := args[0].value.(map[string]interface{})
-		id, idok := opts["Identity"]
-		if idok {
-			a.Identity = AgentIdentity(id.(string))
-		}
-		rev, revok := opts["Revocation"]
-		if revok {
-			a.Revocation = rev.(string)
-		}
-
-		resp, err := a.Do(h)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		var agentEntryHash Hash
-		if resp != nil {
-			agentEntryHash = resp.(Hash)
-		}
-		if revok {
-			// TODO there should be a better way to set a variable inside that vm.
-			// also worried about the re-entrancy here...
-			_, err = jsr.vm.Run(`App.Key.Hash="` + h.nodeIDStr + `"`)
-			if err != nil {
-				return mkOttoErr(&jsr, err.Error())
-			}
-		}
-
-		// there's always a new agent entry
-		_, err = jsr.vm.Run(`App.Agent.TopHash="` + h.agentTopHash.String() + `"`)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-
-		// but not always a new identity to update
-		if idok {
-			_, err = jsr.vm.Run(`App.Agent.String="` + jsSanitizeString(id.(string)) + `"`)
-			if err != nil {
-				return mkOttoErr(&jsr, err.Error())
-			}
-		}
-
-		result, _ = jsr.vm.ToValue(agentEntryHash.String())
-
+	math, err := jsr.vm.Get("Math")
+	if err != nil {
 		return
-	})
+	}
+	random, err := math.Object().Get("random")
 	if err != nil {
-		return nil, err
+		return
 	}
-
-	err = jsr.vm.Set("remove", func(call otto.FunctionCall) (result otto.Value) {
-		var a Action = &ActionDel{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
-		}
-		entry := DelEntry{
-			Hash:    args[0].value.(Hash),
-			Message: args[1].value.(string),
-		}
-		header, err := h.chain.GetEntryHeader(entry.Hash)
-		if err == nil {
-			var resp interface{}
-			resp, err = NewDelAction(header.Type, entry).Do(h)
-			if err == nil {
-				var entryHash Hash
-				if resp != nil {
-					entryHash = resp.(Hash)
-				}
-				result, _ = jsr.vm.ToValue(entryHash.String())
-				return
-			}
-		}
-		result = mkOttoErr(&jsr, err.Error())
+	now, err := date.Object().Get("now")
+	if err != nil {
 		return
-
-	})
+	}
+	_, err = jsr.vm.Run(jsStrictGlobals)
 	if err != nil {
-		return nil, err
+		return
 	}
+	jsr.strict = true
+	leave = func() {
+		jsr.strict = false
+		jsr.vm.Set("Date", date)
+		date.Object().Set("now", now)
+		proto, _ := date.Object().Get("prototype")
+		proto.Object().Set("constructor", date)
+		math.Object().Set("random", random)
+	}
+	return
+}
 
-	err = jsr.vm.Set("getLinks", func(call otto.FunctionCall) (result otto.Value) {
-		var a Action = &ActionGetLinks{}
-		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
-		if err != nil {
-			return jsr.vm.MakeCustomError("HolochainError", err.Error())
-		}
-		base := args[0].value.(Hash)
-		tag := args[1].value.(string)
-
-		l := len(call.ArgumentList)
-		options := GetLinksOptions{Load: false, StatusMask: StatusLive}
-		if l == 3 {
-			opts := args[2].value.(map[string]interface{})
-			load, ok := opts["Load"]
-			if ok {
-				loadval, ok := load.(bool)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting boolean Load attribute in object, got %T", load))
-				}
-				options.Load = loadval
-			}
-			mask, ok := opts["StatusMask"]
-			if ok {
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int StatusMask attribute in object, got %T", mask))
-				}
-				options.StatusMask = int(maskval)
-			}
-		}
-		var response interface{}
-
-		response, err = NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
-
-		if err == nil {
-			// we build up our response by creating the javascript object
-			// that we want and using otto to create it with vm.
-			// TODO: is there a faster way to do this?
-			lqr := response.(*LinkQueryResp)
-			var js string
-			for i, th := range lqr.Links {
-				var l string
-				l = `Hash:"` + th.H + `"`
-				if tag == "" {
-					l += `,Tag:"` + jsSanitizeString(th.T) + `"`
-				}
-				if options.Load {
-					l += `,EntryType:"` + jsSanitizeString(th.EntryType) + `"`
-					l += `,Source:"` + jsSanitizeString(th.Source) + `"`
-					_, def, err := h.GetEntryDef(th.EntryType)
-					if err != nil {
-						break
-					}
-					var entry string
-					switch def.DataFormat {
-					case DataFormatRawJS:
-						entry = th.E
-					case DataFormatRawZygo:
-						fallthrough
-					case DataFormatString:
-						entry = `"` + jsSanitizeString(th.E) + `"`
-					case DataFormatSysKey:
-						entry = fmt.Sprintf("%v", th.E)
-					case DataFormatSysAgent:
-						fallthrough
-					case DataFormatLinks:
-						fallthrough
-					case DataFormatJSON:
-						entry = `JSON.parse("` + jsSanitizeString(th.E) + `")`
-					default:
-						err = errors.New("data format not implemented: " + def.DataFormat)
-						return
-					}
-
-					l += `,Entry:` + entry
-				}
-				if i > 0 {
-					js += ","
-				}
-				js += `{` + l + `}`
-			}
-			if err == nil {
-				js = `[` + js + `]`
-				var obj *otto.Object
-				jsr.h.Debugf("getLinks code:\n%s", js)
-				obj, err = jsr.vm.Object(js)
-				if err == nil {
-					result = obj.Value()
-				}
-			}
-		}
+// NewJSRibosome factory function to build a javascript execution environment for a zome
+func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	jsr := JSRibosome{
+		h:    h,
+		zome: zome,
+		vm:   otto.New(),
+	}
 
+	for i := range HostFns {
+		err = jsr.bindHostFn(&HostFns[i])
 		if err != nil {
-			result = mkOttoErr(&jsr, err.Error())
+			return nil, err
 		}
-
-		return
-	})
+	}
+	err = jsr.bindRequire()
 	if err != nil {
-		return nil, err
+		return
 	}
 
 	l := JSLibrary
@@ -1245,10 +921,23 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	if err != nil {
 		return
 	}
+	jsr.template = jsr.vm.Copy()
 	n = &jsr
 	return
 }
 
+// Reset puts the vm back into the state it was in right after loading the zome code
+func (jsr *JSRibosome) Reset() (err error) {
+	jsr.vm = jsr.template.Copy()
+	jsr.lastResult = nil
+	return
+}
+
+// Close does nothing as the vm holds nothing but memory
+func (jsr *JSRibosome) Close() error {
+	return nil
+}
+
 // Run executes javascript code
 func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
 	v, err := jsr.vm.Run(code)
@@ -1265,7 +954,51 @@ func (jsr *JSRibosome) RunAsyncSendResponse(response AppMsg, callback string, ca
 
 	code := fmt.Sprintf(`%s(JSON.parse("%s"),"%s")`, callback, jsSanitizeString(response.Body), jsSanitizeString(callbackID))
 	jsr.h.Debugf("Calling %s\n", code)
-	result, err = jsr.Run(code)
+	v, err := jsr.runLimited(CallExecution, code)
+	if err != nil {
+		err = fmt.Errorf("Error executing JavaScript: " + err.Error())
+		return
+	}
+	jsr.lastResult = &v
+	result = &v
+	return
+}
 
+// runLimited runs code in the vm under the DNA's execution limits for the given kind of
+// execution.  A step counting guard is called on every statement by keeping the vm's
+// Interrupt channel full, otherwise a timer interrupts the vm when time runs out.
+func (jsr *JSRibosome) runLimited(kind string, code string) (v otto.Value, err error) {
+	g := newExecGuard(jsr.h, jsr.zome, kind)
+	if g == nil {
+		return jsr.vm.Run(code)
+	}
+	interrupt := make(chan func(), 1)
+	if g.counting() {
+		var hook func()
+		hook = func() {
+			g.step()
+			interrupt <- hook
+		}
+		interrupt <- hook
+	} else {
+		timer := time.AfterFunc(g.timeout(), func() {
+			select {
+			case interrupt <- func() { g.stop("time") }:
+			default:
+			}
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		jsr.vm.Interrupt = nil
+		if r := recover(); r != nil {
+			if r != g.hit {
+				panic(r)
+			}
+			err = g.hit
+		}
+	}()
+	jsr.vm.Interrupt = interrupt
+	v, err = jsr.vm.Run(code)
 	return
 }
@@ -132,6 +132,12 @@ func TestNewJSRibosome(t *testing.T) {
 		So(err, ShouldBeNil)
 		z := v.(*JSRibosome)
 
+		Convey("version", func() {
+			_, err = z.Run(`version()`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, VersionStr)
+		})
+
 		Convey("property", func() {
 			_, err = z.Run(`property("description")`)
 			So(err, ShouldBeNil)
@@ -143,6 +149,17 @@ func TestNewJSRibosome(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			// validation only sees the DNA's properties, not those of the instance
+			h.Config.InstanceProperties = map[string]string{"description": "local"}
+			defer func() { h.Config.InstanceProperties = nil }()
+			_, err = z.Run(`property("description")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, "local")
+			z.validating = true
+			defer func() { z.validating = false }()
+			_, err = z.Run(`property("description")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, "a bogus test holochain")
 		})
 
 		// add entries onto the chain to get hash values for testing
@@ -240,6 +257,36 @@ func TestNewJSRibosome(t *testing.T) {
 			So(z.lastResult.String(), ShouldEqual, "false")
 		})
 
+		Convey("verifyCountersign", func() {
+			encode := func(w Warrant) string {
+				data, _ := w.Encode()
+				return string(data)
+			}
+			other, key := makePeer("other")
+			w := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: h.nodeIDStr, Signers: []string{h.nodeIDStr, peer.IDB58Encode(other)}}
+			w.sign(h.agent.PrivKey())
+			_, err := z.Run(fmt.Sprintf(`verifyCountersign(%q)`, encode(w)))
+			So(err.Error(), ShouldContainSubstring, "countersignature is missing signatures")
+
+			w.sign(key)
+			_, err = z.Run(fmt.Sprintf(`verifyCountersign(%q).Parties[1]`, encode(w)))
+			So(err, ShouldBeNil)
+			z := v.(*JSRibosome)
+			So(z.lastResult.String(), ShouldEqual, peer.IDB58Encode(other))
+		})
+
+		Convey("encrypt and decrypt", func() {
+			_, err := z.Run(fmt.Sprintf(`encrypt("%s","some secret")`, h.nodeIDStr))
+			So(err, ShouldBeNil)
+			z := v.(*JSRibosome)
+			sealed := z.lastResult.String()
+			So(sealed, ShouldNotContainSubstring, "some secret")
+
+			_, err = z.Run(fmt.Sprintf(`decrypt("%s")`, sealed))
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, "some secret")
+		})
+
 		Convey("call", func() {
 			// a string calling function
 			_, err := z.Run(`call("zySampleZome","addEven","432")`)
@@ -431,6 +478,51 @@ func TestJSReceive(t *testing.T) {
 	})
 }
 
+func TestJSHook(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	Convey("it should call a lifecycle callback the zome defines", t, func() {
+		v, _ := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `var held;function onHeld(hash,type) {held=hash+":"+type}`})
+		err := v.Hook(HeldHook, "QmFoo", "evenNumbers")
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.Run("held")
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "QmFoo:evenNumbers")
+	})
+
+	Convey("it should skip lifecycle callbacks the zome doesn't define", t, func() {
+		v, _ := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `1`})
+		So(v.Hook(ShutdownHook), ShouldBeNil)
+	})
+
+	Convey("it should return errors from lifecycle callbacks", t, func() {
+		v, _ := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function onShutdown() {throw "fish"}`})
+		err := v.Hook(ShutdownHook)
+		So(err.Error(), ShouldStartWith, "Error executing onShutdown: ")
+		So(err.Error(), ShouldContainSubstring, "fish")
+	})
+
+	Convey("it should return the answer of boolean callbacks, false if not defined", t, func() {
+		v, _ := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function onCountersignProposal(from,type,entry) {return entry=="yes"}`})
+		ok, err := v.BoolHook(CountersignProposalHook, "QmFoo", "oddNumbers", "yes")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = v.BoolHook(CountersignProposalHook, "QmFoo", "oddNumbers", "no")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		v, _ = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function onCountersignProposal() {return "yes"}`})
+		_, err = v.BoolHook(CountersignProposalHook)
+		So(err.Error(), ShouldEqual, "onCountersignProposal should return boolean, got: yes")
+
+		v, _ = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `1`})
+		ok, err = v.BoolHook(CountersignProposalHook)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
 func TestJSbuildValidate(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -590,6 +682,20 @@ func TestJSSanitize(t *testing.T) {
 	})
 }
 
+func TestJSEmit(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	Convey("emit should send an event to the subscribers", t, func() {
+		events, unsubscribe := h.SubscribeEvents()
+		defer unsubscribe()
+		v, err := NewJSRibosome(h, &Zome{Name: "jsZome", RibosomeType: JSRibosomeType, Code: `emit("fish",{fins:2});emit("cow","moo")`})
+		So(err, ShouldBeNil)
+		So(v, ShouldNotBeNil)
+		So(<-events, ShouldResemble, AppEvent{Name: "fish", Zome: "jsZome", Payload: `{"fins":2}`})
+		So(<-events, ShouldResemble, AppEvent{Name: "cow", Zome: "jsZome", Payload: "moo"})
+	})
+}
+
 func TestJSExposeCall(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -1150,3 +1256,150 @@ func TestJSProcessArgs(t *testing.T) {
 
 	})
 }
+
+func TestJSExecutionLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.ExecutionLimits = &ExecutionLimits{}
+	defer func() { h.nucleus.dna.ExecutionLimits = nil }()
+
+	zome := &Zome{Name: "looper", RibosomeType: JSRibosomeType,
+		Code:      `function receive(from,msg) {while(true){}} function loop() {var i=0; while(true){i++}}`,
+		Functions: []FunctionDef{{Name: "loop", CallingType: STRING_CALLING}},
+	}
+	fn := &zome.Functions[0]
+
+	Convey("it should stop code that runs past the timeout", t, func() {
+		h.nucleus.dna.ExecutionLimits.Receive.Timeout = 100
+		z, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		_, err = z.Receive("fakehash", `{}`)
+		So(err.Error(), ShouldEqual, "Error executing receive: receive code in zome looper stopped: exceeded time limit")
+	})
+
+	Convey("it should stop code that runs past the step limit", t, func() {
+		h.nucleus.dna.ExecutionLimits.Call.MaxSteps = 1000
+		z, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		ShouldLog(h.nucleus.alog, "call code in zome looper stopped: exceeded step limit (after ", func() {
+			_, err = z.Call(fn, "")
+		})
+		So(err.Error(), ShouldEqual, "call code in zome looper stopped: exceeded step limit")
+
+		// the ribosome is usable again after being reset
+		err = z.(*JSRibosome).Reset()
+		So(err, ShouldBeNil)
+		_, err = z.Run("1+1")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestJSStrictValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.StrictValidation = true
+	defer func() { h.nucleus.dna.StrictValidation = false }()
+
+	hdr := mkTestHeader("evenNumbers")
+	def := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+	a.header = &hdr
+
+	Convey("it should reject non-deterministic globals", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return Math.random()<2}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "Math.random is not allowed in strict validation")
+
+		v, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return Date.now()>0}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "Date.now is not allowed in strict validation")
+	})
+
+	Convey("it should allow dates made from explicit values", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return new Date(header.Time).getTime()>0}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should not let the clock be reached through a date's constructor", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return new Date(0).constructor()!=""}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "Date without arguments is not allowed in strict validation")
+
+		v, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `var RealDate=Date;function validateCommit(name,entry,header,pkg,sources) {return RealDate.now()>0}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "Date.now is not allowed in strict validation")
+	})
+
+	Convey("it should reject network touching API calls", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {get(header.EntryLink);return true}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "get is not allowed in strict validation")
+	})
+
+	Convey("it should restore the globals after validating", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return true}`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err, ShouldBeNil)
+		_, err = v.Run("Math.random();Date.now();new Date(0).constructor()")
+		So(err, ShouldBeNil)
+		_, err = v.Run("if(new Date(0).constructor!==Date){throw 'constructor not restored'}")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestJSRequire(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	defer func() { h.nucleus.dna.SharedModules = nil }()
+	h.nucleus.dna.SharedModules = map[string]string{
+		"validate/index.js":   `var n=require("./numbers");exports.isEven=function(x){return n.even(x)}`,
+		"validate/numbers.js": `exports.even=function(x){return x%2==0} // no newline at end`,
+	}
+
+	zome := &Zome{Name: "modular", RibosomeType: JSRibosomeType,
+		Code: `var helpers=require("./helpers");var v=require("validate");`,
+		Modules: map[string]string{
+			"helpers.js": `var count=0;exports.next=function(){return ++count};exports.a=require("./util/a.js")`,
+			"util/a.js":  `var b=require("./b");module.exports={name:"a",b:b.name()}`,
+			"util/b.js":  `var h=require("../helpers");exports.name=function(){return "b:"+typeof h.next}`,
+		},
+	}
+
+	Convey("it should require modules of the zome and the library", t, func() {
+		v, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.Run(`helpers.a.name+","+helpers.a.b+","+v.isEven(4)+","+v.isEven(3)`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "a,b:function,true,false")
+	})
+
+	Convey("modules should only be run once", t, func() {
+		v, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.Run(`helpers.next();require("./helpers").next()`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "2")
+	})
+
+	Convey("it should throw when a module can't be found", t, func() {
+		v, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.Run(`try{require("./fish")}catch(e){e.message}`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "cannot find module ./fish, only modules required with a string literal are included in the DNA")
+		_, err = z.Run(`try{require("../helpers")}catch(e){e.message}`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "module ../helpers is outside of its directory")
+	})
+}
@@ -11,19 +11,24 @@ package holochain
 import (
 	"container/list"
 	"sync"
+	"time"
 
 	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // Bucket holds a list of peers.
 type Bucket struct {
-	lk   sync.RWMutex
-	list *list.List
+	lk         sync.RWMutex
+	list       *list.List
+	seen       map[peer.ID]time.Time // when each peer was last seen
+	lastLookup time.Time             // when a lookup last targeted this bucket
 }
 
 func newBucket() *Bucket {
 	b := new(Bucket)
 	b.list = list.New()
+	b.seen = make(map[peer.ID]time.Time)
+	b.lastLookup = time.Now()
 	return b
 }
 
@@ -55,6 +60,7 @@ func (b *Bucket) Remove(id peer.ID) {
 	for e := b.list.Front(); e != nil; e = e.Next() {
 		if e.Value.(peer.ID) == id {
 			b.list.Remove(e)
+			delete(b.seen, id)
 		}
 	}
 }
@@ -65,6 +71,7 @@ func (b *Bucket) MoveToFront(id peer.ID) {
 	for e := b.list.Front(); e != nil; e = e.Next() {
 		if e.Value.(peer.ID) == id {
 			b.list.MoveToFront(e)
+			b.seen[id] = time.Now()
 		}
 	}
 }
@@ -72,6 +79,7 @@ func (b *Bucket) MoveToFront(id peer.ID) {
 func (b *Bucket) PushFront(p peer.ID) {
 	b.lk.Lock()
 	b.list.PushFront(p)
+	b.seen[p] = time.Now()
 	b.lk.Unlock()
 }
 
@@ -80,9 +88,42 @@ func (b *Bucket) PopBack() peer.ID {
 	defer b.lk.Unlock()
 	last := b.list.Back()
 	b.list.Remove(last)
+	id := last.Value.(peer.ID)
+	delete(b.seen, id)
+	return id
+}
+
+// Back returns the least recently seen peer without removing it
+func (b *Bucket) Back() peer.ID {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	last := b.list.Back()
+	if last == nil {
+		return ""
+	}
 	return last.Value.(peer.ID)
 }
 
+// LastSeen returns when the peer was last added or moved to the front of the bucket
+func (b *Bucket) LastSeen(id peer.ID) time.Time {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	return b.seen[id]
+}
+
+// LastLookup returns when a lookup last targeted the bucket's part of the keyspace
+func (b *Bucket) LastLookup() time.Time {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	return b.lastLookup
+}
+
+func (b *Bucket) markLookup(t time.Time) {
+	b.lk.Lock()
+	b.lastLookup = t
+	b.lk.Unlock()
+}
+
 func (b *Bucket) Len() int {
 	b.lk.RLock()
 	defer b.lk.RUnlock()
@@ -99,6 +140,7 @@ func (b *Bucket) Split(cpl int, target peer.ID) *Bucket {
 	out := list.New()
 	newbuck := newBucket()
 	newbuck.list = out
+	newbuck.lastLookup = b.lastLookup
 	e := b.list.Front()
 	for e != nil {
 		peerID := e.Value.(peer.ID)
@@ -106,6 +148,8 @@ func (b *Bucket) Split(cpl int, target peer.ID) *Bucket {
 		if peerCPL > cpl {
 			cur := e
 			out.PushBack(e.Value)
+			newbuck.seen[peerID] = b.seen[peerID]
+			delete(b.seen, peerID)
 			e = e.Next()
 			b.list.Remove(cur)
 			continue
@@ -31,6 +31,7 @@ func toPeerInfos(ps []peer.ID) []*pstore.PeerInfo {
 // to the given key
 func (node *Node) GetClosestPeers(ctx context.Context, key Hash) (<-chan peer.ID, error) {
 	node.log.Logf("Finding peers close to %v", key)
+	node.routingTable.MarkLookup(key)
 	tablepeers := node.routingTable.NearestPeers(key, AlphaValue)
 	if len(tablepeers) == 0 {
 		return nil, ErrEmptyRoutingTable
@@ -120,6 +120,7 @@ func (node *Node) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, er
 	}
 
 	hashID := HashFromPeerID(id)
+	node.routingTable.MarkLookup(hashID)
 	peers := node.routingTable.NearestPeers(hashID, AlphaValue)
 	if len(peers) == 0 {
 		return pstore.PeerInfo{}, ErrEmptyRoutingTable
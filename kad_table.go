@@ -14,6 +14,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	. "github.com/metacurrency/holochain/hash"
+	"math/rand"
 	"sort"
 	"sync"
 	"time"
@@ -41,6 +42,28 @@ type RoutingTable struct {
 	// notification functions
 	PeerRemoved func(peer.ID)
 	PeerAdded   func(peer.ID)
+
+	// Ping checks if a peer is still alive before it gets evicted from a full
+	// bucket.  If nil the least recently seen peer is evicted without asking.
+	Ping func(peer.ID) bool
+
+	// peers currently being pinged for possible eviction
+	pinging map[peer.ID]bool
+}
+
+// BucketHealth describes the state of a single bucket for diagnostics
+type BucketHealth struct {
+	Size       int
+	Stale      int // number of peers not seen within the stale interval
+	LastLookup time.Time
+}
+
+// RoutingTableHealth describes the state of the routing table for diagnostics
+type RoutingTableHealth struct {
+	Size         int
+	Stale        int
+	StaleBuckets int // number of non-empty buckets without a recent lookup
+	Buckets      []BucketHealth
 }
 
 // NewRoutingTable creates a new routing table with a given bucketsize, local ID, and latency tolerance.
@@ -53,6 +76,7 @@ func NewRoutingTable(bucketsize int, localID peer.ID, latency time.Duration, m p
 		metrics:     m,
 		PeerRemoved: func(peer.ID) {},
 		PeerAdded:   func(peer.ID) {},
+		pinging:     make(map[peer.ID]bool),
 	}
 
 	return rt
@@ -88,6 +112,13 @@ func (rt *RoutingTable) Update(p peer.ID) {
 		return
 	}
 
+	// If the bucket is full and can't split, the new peer only gets in if the
+	// least recently seen peer turns out to be gone
+	if rt.Ping != nil && bucketID != len(rt.Buckets)-1 && bucket.Len() >= rt.bucketsize {
+		rt.checkEviction(bucket.Back(), p)
+		return
+	}
+
 	// New peer, add to bucket
 	bucket.PushFront(p)
 	rt.PeerAdded(p)
@@ -124,6 +155,28 @@ func (rt *RoutingTable) Remove(p peer.ID) {
 	rt.PeerRemoved(p)
 }
 
+// checkEviction pings the least recently seen peer of a full bucket in the
+// background and replaces it with the new peer if it doesn't answer.
+// Must be called with the table lock held.
+func (rt *RoutingTable) checkEviction(lrs peer.ID, p peer.ID) {
+	if lrs == "" || rt.pinging[lrs] {
+		return
+	}
+	rt.pinging[lrs] = true
+	go func() {
+		alive := rt.Ping(lrs)
+		rt.tabLock.Lock()
+		delete(rt.pinging, lrs)
+		rt.tabLock.Unlock()
+		if alive {
+			rt.Update(lrs)
+		} else {
+			rt.Remove(lrs)
+			rt.Update(p)
+		}
+	}()
+}
+
 func (rt *RoutingTable) nextBucket() peer.ID {
 	bucket := rt.Buckets[len(rt.Buckets)-1]
 	newBucket := bucket.Split(len(rt.Buckets)-1, rt.local)
@@ -270,6 +323,98 @@ func (rt *RoutingTable) ListPeers() []peer.ID {
 	return peers
 }
 
+// bucketIndex returns the index of the bucket covering the given id.
+// Must be called with the table lock held.
+func (rt *RoutingTable) bucketIndex(id peer.ID) int {
+	i := commonPrefixLen(id, rt.local)
+	if i >= len(rt.Buckets) {
+		i = len(rt.Buckets) - 1
+	}
+	return i
+}
+
+// MarkLookup records that a lookup was made for the given hash so that the
+// bucket covering it doesn't need refreshing
+func (rt *RoutingTable) MarkLookup(hash Hash) {
+	id := PeerIDFromHash(hash)
+	rt.tabLock.RLock()
+	rt.Buckets[rt.bucketIndex(id)].markLookup(time.Now())
+	rt.tabLock.RUnlock()
+}
+
+// StaleBuckets returns the indexes of the non-empty buckets that haven't had a
+// lookup within the given interval
+func (rt *RoutingTable) StaleBuckets(interval time.Duration) (stale []int) {
+	cutoff := time.Now().Add(-interval)
+	rt.tabLock.RLock()
+	for i, b := range rt.Buckets {
+		if b.Len() > 0 && b.LastLookup().Before(cutoff) {
+			stale = append(stale, i)
+		}
+	}
+	rt.tabLock.RUnlock()
+	return
+}
+
+// RandomID returns a random id that falls into the given bucket, i.e. one that
+// shares exactly i leading bits with the local id
+func (rt *RoutingTable) RandomID(i int) peer.ID {
+	b := []byte(rt.local)
+	id := make([]byte, len(b))
+	copy(id, b)
+	n := i / 8
+	if n >= len(id) {
+		return rt.local
+	}
+	bit := byte(0x80) >> uint(i%8)
+	mask := bit - 1
+	id[n] = (id[n] ^ bit) &^ mask
+	id[n] |= byte(rand.Intn(256)) & mask
+	for j := n + 1; j < len(id); j++ {
+		id[j] = byte(rand.Intn(256))
+	}
+	return peer.ID(id)
+}
+
+// Health returns the size of each bucket, when it was last looked up, and how
+// many of its peers haven't been seen within the given interval
+func (rt *RoutingTable) Health(interval time.Duration) (health RoutingTableHealth) {
+	cutoff := time.Now().Add(-interval)
+	rt.tabLock.RLock()
+	defer rt.tabLock.RUnlock()
+	for _, b := range rt.Buckets {
+		var bh BucketHealth
+		b.lk.RLock()
+		bh.Size = b.list.Len()
+		bh.LastLookup = b.lastLookup
+		for e := b.list.Front(); e != nil; e = e.Next() {
+			if b.seen[e.Value.(peer.ID)].Before(cutoff) {
+				bh.Stale++
+			}
+		}
+		b.lk.RUnlock()
+		if bh.Size > 0 && bh.LastLookup.Before(cutoff) {
+			health.StaleBuckets++
+		}
+		health.Size += bh.Size
+		health.Stale += bh.Stale
+		health.Buckets = append(health.Buckets, bh)
+	}
+	return
+}
+
+// String returns a summary of the routing table health
+func (health RoutingTableHealth) String() string {
+	s := fmt.Sprintf("%d peers (%d stale) in %d buckets (%d stale)\n", health.Size, health.Stale, len(health.Buckets), health.StaleBuckets)
+	for i, b := range health.Buckets {
+		if b.Size == 0 {
+			continue
+		}
+		s += fmt.Sprintf("\tbucket %d: %d peers (%d stale), last lookup %v\n", i, b.Size, b.Stale, b.LastLookup.Format(time.RFC3339))
+	}
+	return s
+}
+
 // Print prints a descriptive statement about the provided RoutingTable
 func (rt *RoutingTable) Print() {
 	fmt.Printf("Routing Table, bs = %d, Max latency = %d\n", rt.bucketsize, rt.maxLatency)
@@ -157,6 +157,128 @@ func TestTableFindMultiple(t *testing.T) {
 	}
 }
 
+func TestBucketSeen(t *testing.T) {
+	b := newBucket()
+	p1 := tu.RandPeerIDFatal(t)
+	p2 := tu.RandPeerIDFatal(t)
+
+	before := time.Now()
+	b.PushFront(p1)
+	b.PushFront(p2)
+	if b.LastSeen(p1).Before(before) {
+		t.Fatal("pushing a peer should mark it seen")
+	}
+	if b.Back() != p1 {
+		t.Fatal("least recently seen peer should be at the back")
+	}
+
+	b.MoveToFront(p1)
+	if b.Back() != p2 {
+		t.Fatal("moving a peer to the front should mark it seen")
+	}
+
+	b.Remove(p1)
+	if !b.LastSeen(p1).IsZero() {
+		t.Fatal("removing a peer should forget when it was seen")
+	}
+	b.PopBack()
+	if b.Back() != "" {
+		t.Fatal("empty bucket should have no least recently seen peer")
+	}
+}
+
+// fillForEviction sets up a table with a full non-splittable bucket 0 and
+// returns its only peer
+func fillForEviction(t *testing.T, rt *RoutingTable) peer.ID {
+	rt.Update(rt.RandomID(5))
+	p := rt.RandomID(0)
+	rt.Update(p)
+	if len(rt.Buckets) != 2 || !rt.Buckets[0].Has(p) {
+		t.Fatal("expected bucket 0 to hold the cpl 0 peer")
+	}
+	return p
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestTablePingBeforeEvict(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	m := pstore.NewMetrics()
+
+	// alive least recently seen peer stays, newcomer is dropped
+	rt := NewRoutingTable(1, local, time.Hour, m)
+	old := fillForEviction(t, rt)
+	pinged := make(chan peer.ID, 1)
+	rt.Ping = func(p peer.ID) bool {
+		pinged <- p
+		return true
+	}
+	newcomer := rt.RandomID(0)
+	rt.Update(newcomer)
+	if p := <-pinged; p != old {
+		t.Fatalf("expected to ping %v, pinged %v", old, p)
+	}
+	if rt.Buckets[0].Has(newcomer) || !rt.Buckets[0].Has(old) {
+		t.Fatal("live peer should not be evicted")
+	}
+
+	// dead least recently seen peer is replaced by the newcomer
+	rt = NewRoutingTable(1, local, time.Hour, m)
+	old = fillForEviction(t, rt)
+	rt.Ping = func(p peer.ID) bool { return false }
+	newcomer = rt.RandomID(0)
+	rt.Update(newcomer)
+	if !waitFor(func() bool { return rt.Buckets[0].Has(newcomer) }) {
+		t.Fatal("newcomer should replace dead peer")
+	}
+	if rt.Buckets[0].Has(old) {
+		t.Fatal("dead peer should be evicted")
+	}
+}
+
+func TestTableRefresh(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	m := pstore.NewMetrics()
+	rt := NewRoutingTable(1, local, time.Hour, m)
+
+	for i := 0; i < 40; i++ {
+		if cpl := commonPrefixLen(rt.RandomID(i), local); cpl != i {
+			t.Fatalf("random id for bucket %d has cpl %d", i, cpl)
+		}
+	}
+
+	p := fillForEviction(t, rt)
+	if len(rt.StaleBuckets(time.Hour)) != 0 {
+		t.Fatal("new buckets should not be stale")
+	}
+
+	rt.Buckets[0].markLookup(time.Now().Add(-2 * time.Hour))
+	stale := rt.StaleBuckets(time.Hour)
+	if len(stale) != 1 || stale[0] != 0 {
+		t.Fatalf("expected bucket 0 to be stale, got %v", stale)
+	}
+	health := rt.Health(time.Hour)
+	if health.Size != 2 || health.StaleBuckets != 1 || len(health.Buckets) != 2 || health.Buckets[0].Size != 1 {
+		t.Fatalf("unexpected health: %v", health)
+	}
+
+	rt.MarkLookup(HashFromPeerID(p))
+	if len(rt.StaleBuckets(time.Hour)) != 0 {
+		t.Fatal("lookup should refresh the bucket")
+	}
+	if rt.Health(-time.Hour).Stale != 2 {
+		t.Fatal("peers not seen within the interval should be stale")
+	}
+}
+
 // Looks for race conditions in table operations. For a more 'certain'
 // test, increase the loop counter from 1000 to a much higher number
 // and set GOMAXPROCS above 1
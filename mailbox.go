@@ -0,0 +1,470 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// mailbox implements store-and-forward delivery of app messages to agents who can't be
+// reached.  Undeliverable messages are encrypted to the recipient and held by the DHT
+// nodes closest to the recipient's hash, who hand them over when the recipient asks.
+
+package holochain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"github.com/tidwall/buntdb"
+	"sync"
+	"time"
+)
+
+const (
+	// MailboxTTL is how long held messages are kept before being dropped
+	MailboxTTL = time.Hour * 24 * 7
+
+	// MailboxMaxMessages is the most messages a node will hold for any one agent
+	MailboxMaxMessages = 256
+
+	// MailboxMaxFromSender is the most messages a node will hold from any one sender for
+	// any one agent, so a single sender can't fill an agent's mailbox
+	MailboxMaxFromSender = 32
+
+	// maximum number of fetch rounds per holder, so a busy mailbox can't keep us forever
+	mailboxMaxRounds = 16
+
+	// mailReplyZomeType is the zome type of the messages that carry the response to a
+	// held message back to the callback of its sender
+	mailReplyZomeType = "%mailreply"
+)
+
+var ErrMailboxFull = errors.New("mailbox full")
+var ErrMailboxSenderFull = errors.New("too many messages held from sender")
+var ErrMailboxSenderMismatch = errors.New("held message must come from its sender")
+var ErrMailboxNotOwner = errors.New("mailbox can only be read by its owner")
+var ErrMailSignatureInvalid = errors.New("held message signature invalid")
+
+// MailboxMsg holds an app message encrypted to its recipient
+type MailboxMsg struct {
+	ID   string // hash of Data, assigned by the holding node
+	From string // sender's node id
+	Time time.Time
+	Data []byte // the AppMsg encrypted to the recipient
+	Sig  []byte // sender's signature of Data and Time
+}
+
+// signed returns what the sender signs, so the time a message was held can't be changed
+// by the nodes holding it
+func (m *MailboxMsg) signed() []byte {
+	return append(append([]byte{}, m.Data...), []byte(m.Time.UTC().Format(time.RFC3339Nano))...)
+}
+
+// SendHeld is the result of a send to a recipient who couldn't be reached, whose message
+// was held for delivery when they next fetch their mail
+type SendHeld struct {
+	Held bool
+}
+
+// heldAppMsg is the content of a held message, with the id the recipient answers to when
+// the sender is waiting on a callback
+type heldAppMsg struct {
+	AppMsg
+	Reply string `json:",omitempty"`
+}
+
+// mailReply carries the response of a held message back to its sender
+type mailReply struct {
+	Reply string
+	Body  string
+}
+
+// pendingReply is a callback waiting on the response to a held message
+type pendingReply struct {
+	to       peer.ID
+	callback *Callback
+	held     time.Time
+}
+
+type pendingReplies struct {
+	lk      sync.Mutex
+	pending map[string]pendingReply
+}
+
+// MailboxPutReq asks a node to hold a message for an agent
+type MailboxPutReq struct {
+	To  Hash
+	Msg MailboxMsg
+}
+
+// MailboxGetReq asks a node for the messages it holds for the requesting agent, after
+// dropping the ones already delivered
+type MailboxGetReq struct {
+	To        Hash
+	Delivered []string
+}
+
+// MailboxGetResp holds the messages held for an agent
+type MailboxGetResp struct {
+	Msgs []MailboxMsg
+}
+
+func mailKey(to Hash, id string) string {
+	return "mail:" + to.String() + ":" + id
+}
+
+// holdMail stores a message for an agent
+func (dht *DHT) holdMail(to Hash, msg MailboxMsg) (err error) {
+	var hash Hash
+	err = hash.Sum(dht.h.hashSpec, msg.Data)
+	if err != nil {
+		return
+	}
+	msg.ID = hash.String()
+	var data []byte
+	data, err = json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	err = dht.db.Update(func(tx *buntdb.Tx) error {
+		var count, fromSender int
+		err := tx.AscendKeys(mailKey(to, "*"), func(key, value string) bool {
+			count++
+			var m MailboxMsg
+			if json.Unmarshal([]byte(value), &m) == nil && m.From == msg.From {
+				fromSender++
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if count >= MailboxMaxMessages {
+			return ErrMailboxFull
+		}
+		if fromSender >= MailboxMaxFromSender {
+			return ErrMailboxSenderFull
+		}
+		_, _, err = tx.Set(mailKey(to, msg.ID), string(data), &buntdb.SetOptions{Expires: true, TTL: MailboxTTL})
+		return err
+	})
+	return
+}
+
+// getMail drops the delivered messages for an agent and returns the rest
+func (dht *DHT) getMail(to Hash, delivered []string) (msgs []MailboxMsg, err error) {
+	err = dht.db.Update(func(tx *buntdb.Tx) error {
+		for _, id := range delivered {
+			_, err := tx.Delete(mailKey(to, id))
+			if err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		var values []string
+		err := tx.AscendKeys(mailKey(to, "*"), func(key, value string) bool {
+			values = append(values, value)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			var m MailboxMsg
+			err = json.Unmarshal([]byte(v), &m)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	return
+}
+
+// HoldMessage encrypts an app message to its recipient and asks the nodes closest to the
+// recipient's hash to hold it until the recipient fetches it
+func (h *Holochain) HoldMessage(to peer.ID, msg AppMsg) (err error) {
+	return h.holdMessage(to, heldAppMsg{AppMsg: msg})
+}
+
+// holdMessageForCallback holds an app message whose sender is waiting on a callback, which
+// runs when the recipient fetches the message and its response makes it back to us
+func (h *Holochain) holdMessageForCallback(to peer.ID, msg AppMsg, callback *Callback) (err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	h.mailReplies.lk.Lock()
+	if h.mailReplies.pending == nil {
+		h.mailReplies.pending = make(map[string]pendingReply)
+	}
+	for k, p := range h.mailReplies.pending {
+		if now.Sub(p.held) > MailboxTTL {
+			delete(h.mailReplies.pending, k)
+		}
+	}
+	h.mailReplies.pending[id] = pendingReply{to: to, callback: callback, held: now}
+	h.mailReplies.lk.Unlock()
+
+	err = h.holdMessage(to, heldAppMsg{AppMsg: msg, Reply: id})
+	if err != nil && err != ErrEmptyRoutingTable {
+		h.mailReplies.lk.Lock()
+		delete(h.mailReplies.pending, id)
+		h.mailReplies.lk.Unlock()
+	}
+	return
+}
+
+func (h *Holochain) holdMessage(to peer.ID, msg heldAppMsg) (err error) {
+	var key ic.PubKey
+	key, err = h.agentPubKey(to)
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	m := MailboxMsg{From: h.nodeIDStr, Time: time.Now().Round(0)}
+	m.Data, err = EncryptFor(key, data)
+	if err != nil {
+		return
+	}
+	m.Sig, err = h.Sign(m.signed())
+	if err != nil {
+		return
+	}
+	toHash := HashFromPeerID(to)
+	h.dht.dlog.Logf("holding message for %v", to)
+	err = h.dht.Change(toHash, MAILBOX_PUT_REQUEST, MailboxPutReq{To: toHash, Msg: m})
+	return
+}
+
+// FetchMail collects the messages held for this agent by itself and the nodes closest to
+// its hash, and delivers each one to the receive function of its zome
+func (h *Holochain) FetchMail() (delivered int, err error) {
+	to := HashFromPeerID(h.nodeID)
+	holders := []peer.ID{h.nodeID}
+	pchan, e := h.node.GetClosestPeers(h.node.ctx, to)
+	if e == nil {
+		for p := range pchan {
+			if p != h.nodeID {
+				holders = append(holders, p)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range holders {
+		req := MailboxGetReq{To: to}
+		for i := 0; i < mailboxMaxRounds; i++ {
+			var r interface{}
+			r, err = h.Send(h.node.ctx, ActionProtocol, p, h.node.NewMessage(MAILBOX_GET_REQUEST, req), 0)
+			if err != nil {
+				h.dht.dlog.Logf("error fetching mail from %v: %v", p, err)
+				err = nil
+				break
+			}
+			resp, ok := r.(MailboxGetResp)
+			if !ok {
+				h.dht.dlog.Logf("unexpected mailbox response from %v: %T", p, r)
+				break
+			}
+			if len(resp.Msgs) == 0 {
+				break
+			}
+			req.Delivered = nil
+			for _, m := range resp.Msgs {
+				req.Delivered = append(req.Delivered, m.ID)
+				if seen[m.ID] {
+					continue
+				}
+				seen[m.ID] = true
+				if e := h.deliverMail(m); e != nil {
+					h.dht.dlog.Logf("dropping held message %s from %s: %v", m.ID, m.From, e)
+					continue
+				}
+				delivered++
+			}
+		}
+	}
+	return
+}
+
+// deliverMail checks and decrypts a held message and passes it to the zome's receive function
+func (h *Holochain) deliverMail(m MailboxMsg) (err error) {
+	var from peer.ID
+	from, err = peer.IDB58Decode(m.From)
+	if err != nil {
+		return
+	}
+	var key ic.PubKey
+	key, err = h.agentPubKey(from)
+	if err != nil {
+		return
+	}
+	var ok bool
+	ok, err = key.Verify(m.signed(), m.Sig)
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = ErrMailSignatureInvalid
+		return
+	}
+	var data []byte
+	data, err = Decrypt(h.agent.PrivKey(), m.Data)
+	if err != nil {
+		return
+	}
+	var msg heldAppMsg
+	err = json.Unmarshal(data, &msg)
+	if err != nil {
+		return
+	}
+	if msg.ZomeType == countersignZomeType {
+		// they must come from the proposer itself, not be replayed from the mailbox
+		err = ErrCountersignHeld
+		return
+	}
+	var r interface{}
+	r, err = (&ActionSend{}).Receive(h.dht, &Message{Type: APP_MESSAGE, Time: m.Time, From: from, Body: msg.AppMsg}, 0)
+	if err != nil || msg.Reply == "" {
+		return
+	}
+	if e := h.replyToHeld(from, msg.Reply, r.(AppMsg).Body); e != nil {
+		h.dht.dlog.Logf("error answering held message %s from %v: %v", m.ID, from, e)
+	}
+	return
+}
+
+// replyToHeld sends the response to a held message back to its sender, holding it in turn
+// if the sender can't be reached
+func (h *Holochain) replyToHeld(to peer.ID, id string, body string) (err error) {
+	var j []byte
+	j, err = json.Marshal(mailReply{Reply: id, Body: body})
+	if err != nil {
+		return
+	}
+	reply := AppMsg{ZomeType: mailReplyZomeType, Body: string(j)}
+	sealed := reply
+	if to != h.nodeID {
+		sealed, err = h.sealAppMsg(to, reply)
+		if err != nil {
+			return
+		}
+	}
+	_, err = h.Send(h.node.ctx, ActionProtocol, to, h.node.NewMessage(APP_MESSAGE, sealed), 0)
+	if _, unreachable := err.(UnreachableError); unreachable {
+		err = h.HoldMessage(to, reply)
+	}
+	return
+}
+
+// receiveMailReply passes the response to a held message to the callback its sender
+// registered when the message was held
+func (h *Holochain) receiveMailReply(from peer.ID, body string) (err error) {
+	var reply mailReply
+	err = json.Unmarshal([]byte(body), &reply)
+	if err != nil {
+		return
+	}
+	h.mailReplies.lk.Lock()
+	p, ok := h.mailReplies.pending[reply.Reply]
+	if ok && p.to == from {
+		delete(h.mailReplies.pending, reply.Reply)
+	}
+	h.mailReplies.lk.Unlock()
+	if !ok || p.to != from {
+		h.dht.dlog.Logf("dropping reply %s from %v with no held message waiting on it", reply.Reply, from)
+		return
+	}
+	var r Ribosome
+	var release func()
+	r, _, release, err = h.GetRibosome(p.callback.zomeType)
+	if err != nil {
+		return
+	}
+	defer release()
+	_, err = r.RunAsyncSendResponse(AppMsg{ZomeType: p.callback.zomeType, Body: reply.Body}, p.callback.Function, p.callback.ID)
+	return
+}
+
+// FetchMailTask fetches held messages, logging any error
+func FetchMailTask(h *Holochain) {
+	n, err := h.FetchMail()
+	if err != nil {
+		h.dht.dlog.Logf("error fetching mail: %v", err)
+	} else if n > 0 {
+		h.dht.dlog.Logf("delivered %d held messages", n)
+	}
+}
+
+//------------------------------------------------------------
+// MailboxPut
+
+type ActionMailboxPut struct {
+}
+
+func (a *ActionMailboxPut) Name() string {
+	return "mailboxPut"
+}
+
+func (a *ActionMailboxPut) Args() []Arg {
+	return nil
+}
+
+func (a *ActionMailboxPut) Do(h *Holochain) (response interface{}, err error) {
+	err = NonCallableAction
+	return
+}
+
+func (a *ActionMailboxPut) Receive(dht *DHT, msg *Message, retries int) (response interface{}, err error) {
+	t := msg.Body.(MailboxPutReq)
+	if t.Msg.From != peer.IDB58Encode(msg.From) {
+		err = ErrMailboxSenderMismatch
+		return
+	}
+	err = dht.holdMail(t.To, t.Msg)
+	if err == nil {
+		response = DHTChangeOK
+	}
+	return
+}
+
+//------------------------------------------------------------
+// MailboxGet
+
+type ActionMailboxGet struct {
+}
+
+func (a *ActionMailboxGet) Name() string {
+	return "mailboxGet"
+}
+
+func (a *ActionMailboxGet) Args() []Arg {
+	return nil
+}
+
+func (a *ActionMailboxGet) Do(h *Holochain) (response interface{}, err error) {
+	err = NonCallableAction
+	return
+}
+
+func (a *ActionMailboxGet) Receive(dht *DHT, msg *Message, retries int) (response interface{}, err error) {
+	t := msg.Body.(MailboxGetReq)
+	if PeerIDFromHash(t.To) != msg.From {
+		err = ErrMailboxNotOwner
+		return
+	}
+	var resp MailboxGetResp
+	resp.Msgs, err = dht.getMail(t.To, t.Delivered)
+	if err == nil {
+		response = resp
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package holochain
+
+import (
+	"context"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMailboxStore(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	other, _ := makePeer("other")
+	to := HashFromPeerID(other)
+
+	Convey("it should hold messages for an agent", t, func() {
+		err := h.dht.holdMail(to, MailboxMsg{From: h.nodeIDStr, Data: []byte("data1")})
+		So(err, ShouldBeNil)
+		err = h.dht.holdMail(to, MailboxMsg{From: h.nodeIDStr, Data: []byte("data2")})
+		So(err, ShouldBeNil)
+		msgs, err := h.dht.getMail(to, nil)
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 2)
+		So(msgs[0].ID, ShouldNotEqual, "")
+
+		msgs, err = h.dht.getMail(to, []string{msgs[0].ID})
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 1)
+		So(string(msgs[0].Data), ShouldNotEqual, "")
+	})
+
+	Convey("it should only hand over messages to their recipient", t, func() {
+		msg := h.node.NewMessage(MAILBOX_GET_REQUEST, MailboxGetReq{To: to})
+		_, err := h.Send(h.node.ctx, ActionProtocol, h.nodeID, msg, 0)
+		So(err, ShouldEqual, ErrMailboxNotOwner)
+	})
+
+	Convey("it should only hold messages for the node that sent them", t, func() {
+		msg := h.node.NewMessage(MAILBOX_PUT_REQUEST, MailboxPutReq{To: to, Msg: MailboxMsg{From: other.Pretty(), Data: []byte("forged")}})
+		_, err := h.Send(h.node.ctx, ActionProtocol, h.nodeID, msg, 0)
+		So(err, ShouldEqual, ErrMailboxSenderMismatch)
+	})
+
+	Convey("it should limit the messages held from any one sender", t, func() {
+		var err error
+		for i := 2; err == nil; i++ {
+			err = h.dht.holdMail(to, MailboxMsg{From: h.nodeIDStr, Data: []byte(fmt.Sprintf("data%d", i))})
+		}
+		So(err, ShouldEqual, ErrMailboxSenderFull)
+		msgs, _ := h.dht.getMail(to, nil)
+		So(len(msgs), ShouldEqual, MailboxMaxFromSender)
+	})
+}
+
+func TestMailboxDelivery(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should report peers it can't open a stream to as unreachable", t, func() {
+		offline, _ := makePeer("offline")
+		msg := h.node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		ctx, cancel := context.WithTimeout(h.node.ctx, time.Second)
+		defer cancel()
+		_, err := h.node.Send(ctx, ActionProtocol, offline, msg)
+		So(err, ShouldHaveSameTypeAs, UnreachableError{})
+	})
+
+	Convey("it should encrypt held messages and deliver them on fetch", t, func() {
+		// with an empty routing table we are the only holder
+		err := h.HoldMessage(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		So(err, ShouldEqual, ErrEmptyRoutingTable)
+		msgs, err := h.dht.getMail(HashFromPeerID(h.nodeID), nil)
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 1)
+		So(string(msgs[0].Data), ShouldNotContainSubstring, "foobar")
+
+		n, err := h.FetchMail()
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		msgs, err = h.dht.getMail(HashFromPeerID(h.nodeID), nil)
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 0)
+	})
+
+	Convey("it should drop held messages with bad signatures", t, func() {
+		m := MailboxMsg{From: h.nodeIDStr, Data: []byte("data"), Sig: []byte("bad")}
+		err := h.dht.holdMail(HashFromPeerID(h.nodeID), m)
+		So(err, ShouldBeNil)
+		n, err := h.FetchMail()
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+		msgs, _ := h.dht.getMail(HashFromPeerID(h.nodeID), nil)
+		So(len(msgs), ShouldEqual, 0)
+	})
+	Convey("it should drop held messages whose time was changed", t, func() {
+		err := h.HoldMessage(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		So(err, ShouldEqual, ErrEmptyRoutingTable)
+		to := HashFromPeerID(h.nodeID)
+		msgs, err := h.dht.getMail(to, nil)
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 1)
+		m := msgs[0]
+		So(h.deliverMail(m), ShouldBeNil)
+		m.Time = m.Time.Add(-time.Hour)
+		So(h.deliverMail(m), ShouldEqual, ErrMailSignatureInvalid)
+		_, err = h.dht.getMail(to, []string{m.ID})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should not deliver held countersigning messages", t, func() {
+		err := h.HoldMessage(h.nodeID, AppMsg{ZomeType: countersignZomeType, Body: `{}`})
+		So(err, ShouldEqual, ErrEmptyRoutingTable)
+		n, err := h.FetchMail()
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+	})
+
+	Convey("it should run the sender's callback with the response to a held message", t, func() {
+		callback := &Callback{Function: "asyncPing", ID: "123", zomeType: "jsSampleZome"}
+		err := h.holdMessageForCallback(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`}, callback)
+		So(err, ShouldEqual, ErrEmptyRoutingTable)
+		ShouldLog(h.nucleus.alog, `async result of message with 123 was: {"pong":"foobar"}`, func() {
+			n, err := h.FetchMail()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+		})
+		So(len(h.mailReplies.pending), ShouldEqual, 0)
+	})
+}
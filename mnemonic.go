@@ -0,0 +1,48 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// recovery phrases for the agent's key
+//
+// A recovery phrase is a BIP39 mnemonic of 24 words from the english word list.  The key
+// pair is generated from the first 32 bytes of the phrase's BIP39 seed, so the same phrase
+// always rebuilds the same Ed25519 key.
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	bip39 "github.com/tyler-smith/go-bip39"
+	"io"
+	"strings"
+)
+
+const (
+	mnemonicEntropyBits = 256
+	mnemonicSeedSize    = 32
+)
+
+var ErrBadMnemonic = errors.New("invalid recovery phrase")
+
+// NewMnemonic returns a new random recovery phrase
+func NewMnemonic() (mnemonic string, err error) {
+	var entropy []byte
+	entropy, err = bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return
+	}
+	mnemonic, err = bip39.NewMnemonic(entropy)
+	return
+}
+
+// MnemonicSeed returns the seed that a recovery phrase stands for, for passing to NewAgent
+// or Init.  Case and extra white space in the phrase are ignored.
+func MnemonicSeed(mnemonic string) (seed io.Reader, err error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	if _, err = bip39.EntropyFromMnemonic(mnemonic); err != nil {
+		err = ErrBadMnemonic
+		return
+	}
+	seed = bytes.NewReader(bip39.NewSeed(mnemonic, "")[:mnemonicSeedSize])
+	return
+}
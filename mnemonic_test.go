@@ -0,0 +1,59 @@
+package holochain
+
+import (
+	"bytes"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestNewMnemonic(t *testing.T) {
+	Convey("it should make a random 24 word phrase", t, func() {
+		m1, err := NewMnemonic()
+		So(err, ShouldBeNil)
+		So(len(strings.Fields(m1)), ShouldEqual, 24)
+		m2, err := NewMnemonic()
+		So(err, ShouldBeNil)
+		So(m1, ShouldNotEqual, m2)
+		_, err = MnemonicSeed(m1)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestMnemonicSeed(t *testing.T) {
+	m := strings.Repeat("abandon ", 23) + "art"
+
+	Convey("it should rebuild the same key from the same phrase", t, func() {
+		seed, err := MnemonicSeed(m)
+		So(err, ShouldBeNil)
+		a1, err := NewAgent(LibP2P, "zippy@someemail.com", seed)
+		So(err, ShouldBeNil)
+		seed, err = MnemonicSeed("  " + strings.ToUpper(m) + "\n")
+		So(err, ShouldBeNil)
+		a2, err := NewAgent(LibP2P, "zippy@someemail.com", seed)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a1.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+		k1, _ := a1.PrivKey().Bytes()
+		k2, _ := a2.PrivKey().Bytes()
+		So(bytes.Equal(k1, k2), ShouldBeTrue)
+	})
+
+	Convey("it should build different keys from different phrases", t, func() {
+		seed, _ := MnemonicSeed(m)
+		a1, _ := NewAgent(LibP2P, "zippy@someemail.com", seed)
+		m2, _ := NewMnemonic()
+		seed, _ = MnemonicSeed(m2)
+		a2, _ := NewAgent(LibP2P, "zippy@someemail.com", seed)
+		So(ic.KeyEqual(a1.PrivKey(), a2.PrivKey()), ShouldBeFalse)
+	})
+
+	Convey("it should reject phrases with a bad checksum or unknown words", t, func() {
+		_, err := MnemonicSeed(strings.Repeat("abandon ", 24))
+		So(err, ShouldEqual, ErrBadMnemonic)
+		_, err = MnemonicSeed(strings.Repeat("abandon ", 23) + "zippy")
+		So(err, ShouldEqual, ErrBadMnemonic)
+		_, err = MnemonicSeed("abandon art")
+		So(err, ShouldEqual, ErrBadMnemonic)
+	})
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// CommonJS style modules for JS zomes
+//
+// A require of a name starting with ./ or ../ refers to a file relative to the requiring
+// file, and any other name refers to a file in the DNA's library directory, which is shared
+// by all the zomes.  Like node, the name may leave off .js or name a directory holding an
+// index.js.  The modules are found by following the requires of the zome's code when the
+// DNA is loaded, and are carried in the DNA so they are part of its hash.
+
+package holochain
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultLibraryDir is the directory of the DNA holding the JS modules shared by its zomes
+	DefaultLibraryDir = "lib"
+
+	jsZomeModulePrefix    = "zome:"
+	jsLibraryModulePrefix = "lib:"
+)
+
+var jsRequireRegexp = regexp.MustCompile(`^require\s*\(\s*(?:"([^"\\]+)"|'([^'\\]+)')\s*\)`)
+
+// jsRequires returns the names that the code requires with a string literal.  Comments,
+// strings and regular expressions are skipped so that what they hold isn't taken for a
+// require.  Names computed at run time can't be found, so aren't included in the DNA.
+func jsRequires(code string) (names []string) {
+	var last byte // the last character that wasn't in a comment or white space
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '/' && i+1 < len(code) && code[i+1] == '/':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < len(code) && code[i+1] == '*':
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 3
+			continue
+		case c == '"' || c == '\'' || c == '`' || (c == '/' && jsRegexpCanStart(last)):
+			i = jsSkipQuoted(code, i)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case jsIdentChar(c):
+			start := i
+			for i+1 < len(code) && jsIdentChar(code[i+1]) {
+				i++
+			}
+			switch code[start : i+1] {
+			case "require":
+				if last != '.' {
+					if m := jsRequireRegexp.FindStringSubmatch(code[start:]); m != nil {
+						names = append(names, m[1]+m[2])
+					}
+				}
+			case "return", "typeof", "case", "do", "else", "in", "instanceof", "new", "delete", "void", "throw":
+				// a regular expression may follow these like it may an operator
+				last = 0
+				continue
+			}
+			c = code[i]
+		}
+		last = c
+	}
+	return
+}
+
+// jsSkipQuoted returns the index of the end of the string, template or regular expression
+// that starts at i
+func jsSkipQuoted(code string, i int) int {
+	q := code[i]
+	for i++; i < len(code) && code[i] != q; i++ {
+		if code[i] == '\\' {
+			i++
+		}
+	}
+	return i
+}
+
+// jsRegexpCanStart reports whether a / after the given character starts a regular expression
+// rather than being a division
+func jsRegexpCanStart(last byte) bool {
+	return last == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) >= 0
+}
+
+func jsIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// jsModuleNotFoundError is returned when there is no module by the required name
+type jsModuleNotFoundError string
+
+func (e jsModuleNotFoundError) Error() string {
+	return "cannot find module " + string(e)
+}
+
+// resolveModule returns the path of the module that name refers to when required by a
+// module in dir, and whether it is in the library.  has reports whether there is a module
+// with a path in the zome's directory or in the library.
+func resolveModule(has func(lib bool, p string) bool, fromLib bool, dir string, name string) (p string, lib bool, err error) {
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		lib = fromLib
+		p = path.Join(dir, name)
+	} else {
+		lib = true
+		p = path.Clean(name)
+	}
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") || path.IsAbs(p) {
+		err = fmt.Errorf("module %s is outside of its directory", name)
+		return
+	}
+	for _, c := range []string{p, p + ".js", path.Join(p, "index.js")} {
+		if has(lib, c) {
+			p = c
+			return
+		}
+	}
+	err = jsModuleNotFoundError(name)
+	return
+}
+
+// jsModuleKey returns the key by which the JS ribosome knows a module
+func jsModuleKey(lib bool, p string) string {
+	if lib {
+		return jsLibraryModulePrefix + p
+	}
+	return jsZomeModulePrefix + p
+}
+
+// parseJSModuleKey returns the location of a module from its key
+func parseJSModuleKey(key string) (lib bool, p string) {
+	if strings.HasPrefix(key, jsLibraryModulePrefix) {
+		return true, strings.TrimPrefix(key, jsLibraryModulePrefix)
+	}
+	return false, strings.TrimPrefix(key, jsZomeModulePrefix)
+}
+
+// loadJSModules reads the modules that the zome's code requires, and those that they
+// require, from the zome's directory and the library directory
+func loadJSModules(dna *DNA, zome *Zome, zomePath string, libPath string) (err error) {
+	has := func(lib bool, p string) bool {
+		if lib {
+			return FileExists(libPath, filepath.FromSlash(p))
+		}
+		return FileExists(zomePath, filepath.FromSlash(p))
+	}
+	var load func(fromLib bool, dir string, code string) error
+	load = func(fromLib bool, dir string, code string) (err error) {
+		for _, name := range jsRequires(code) {
+			var p string
+			var lib bool
+			p, lib, err = resolveModule(has, fromLib, dir, name)
+			if err != nil {
+				err = fmt.Errorf("in zome %s: %v", zome.Name, err)
+				return
+			}
+			var root string
+			var modules map[string]string
+			if lib {
+				if dna.SharedModules == nil {
+					dna.SharedModules = make(map[string]string)
+				}
+				root, modules = libPath, dna.SharedModules
+			} else {
+				if zome.Modules == nil {
+					zome.Modules = make(map[string]string)
+				}
+				root, modules = zomePath, zome.Modules
+			}
+			if _, done := modules[p]; done {
+				continue
+			}
+			var b []byte
+			b, err = ReadFile(root, filepath.FromSlash(p))
+			if err != nil {
+				return
+			}
+			modules[p] = string(b)
+			err = load(lib, path.Dir(p), string(b))
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	err = load(false, ".", zome.Code)
+	return
+}
+
+// saveJSModules writes the modules of the DNA to the zome directories and the library
+// directory under dnaPath
+func saveJSModules(dna *DNA, dnaPath string) (err error) {
+	write := func(root string, modules map[string]string) (err error) {
+		for p, code := range modules {
+			f := filepath.Join(root, filepath.FromSlash(p))
+			if err = os.MkdirAll(filepath.Dir(f), os.ModePerm); err != nil {
+				return
+			}
+			if err = WriteFile([]byte(code), f); err != nil {
+				return
+			}
+		}
+		return
+	}
+	for _, z := range dna.Zomes {
+		if err = write(filepath.Join(dnaPath, z.Name), z.Modules); err != nil {
+			return
+		}
+	}
+	err = write(filepath.Join(dnaPath, DefaultLibraryDir), dna.SharedModules)
+	return
+}
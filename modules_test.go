@@ -0,0 +1,130 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSRequires(t *testing.T) {
+	Convey("it should find the names required with string literals", t, func() {
+		code := `var a=require("./a");var b = require( 'lib/b' );require(name);notrequire("x")`
+		So(jsRequires(code), ShouldResemble, []string{"./a", "lib/b"})
+	})
+
+	Convey("it should skip requires in comments, strings and regular expressions", t, func() {
+		code := `// var x=require("./commented")
+/* require('./block') */ var s="require('./str')", t='it\'s require("./esc")', u=` + "`require('./tmpl')`" + `;
+var r=/require\('x'\)/, d=4/2/1; function f(){return /'/.test(s)}
+var a=require("./a"); x.require("./method");
+var b=require('./b')`
+		So(jsRequires(code), ShouldResemble, []string{"./a", "./b"})
+	})
+}
+
+func TestResolveModule(t *testing.T) {
+	files := map[string]bool{"zome:a.js": true, "zome:util/b.js": true, "zome:c/index.js": true, "lib:shared.js": true, "lib:x/y.js": true}
+	has := func(lib bool, p string) bool { return files[jsModuleKey(lib, p)] }
+
+	Convey("relative names should resolve from the requiring module's directory", t, func() {
+		p, lib, err := resolveModule(has, false, ".", "./a")
+		So(err, ShouldBeNil)
+		So(lib, ShouldBeFalse)
+		So(p, ShouldEqual, "a.js")
+		p, _, err = resolveModule(has, false, "util", "../a.js")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "a.js")
+		p, _, err = resolveModule(has, false, ".", "./c")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "c/index.js")
+		p, lib, err = resolveModule(has, true, "x", "../shared")
+		So(err, ShouldBeNil)
+		So(lib, ShouldBeTrue)
+		So(p, ShouldEqual, "shared.js")
+	})
+
+	Convey("other names should resolve in the library", t, func() {
+		p, lib, err := resolveModule(has, false, "util", "x/y")
+		So(err, ShouldBeNil)
+		So(lib, ShouldBeTrue)
+		So(p, ShouldEqual, "x/y.js")
+	})
+
+	Convey("it should not resolve outside of the directories", t, func() {
+		_, _, err := resolveModule(has, false, ".", "../a")
+		So(err.Error(), ShouldEqual, "module ../a is outside of its directory")
+		_, _, err = resolveModule(has, false, ".", "/etc/passwd")
+		So(err.Error(), ShouldEqual, "module /etc/passwd is outside of its directory")
+	})
+
+	Convey("it should report missing modules", t, func() {
+		_, _, err := resolveModule(has, false, ".", "./b")
+		So(err.Error(), ShouldEqual, "cannot find module ./b")
+	})
+}
+
+func TestLoadJSModules(t *testing.T) {
+	d, s, h := SetupTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	dnaPath := h.DNAPath()
+	zomePath := filepath.Join(dnaPath, "jsSampleZome")
+	code, _ := ReadFile(zomePath, "jsSampleZome.js")
+	os.MkdirAll(filepath.Join(zomePath, "util"), os.ModePerm)
+	os.MkdirAll(filepath.Join(dnaPath, DefaultLibraryDir), os.ModePerm)
+	WriteFile([]byte(string(code)+"\nvar helpers=require('./util/helpers');"), zomePath, "jsSampleZome.js.new")
+	os.Rename(filepath.Join(zomePath, "jsSampleZome.js.new"), filepath.Join(zomePath, "jsSampleZome.js"))
+	WriteFile([]byte(`var shared=require("shared");exports.twice=function(x){return shared.double(x)}`), zomePath, "util", "helpers.js")
+	WriteFile([]byte(`exports.double=function(x){return 2*x}`), dnaPath, DefaultLibraryDir, "shared.js")
+
+	Convey("it should load the required modules into the DNA", t, func() {
+		dna, err := s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err, ShouldBeNil)
+		var z Zome
+		for _, z = range dna.Zomes {
+			if z.Name == "jsSampleZome" {
+				break
+			}
+		}
+		So(len(z.Modules), ShouldEqual, 1)
+		So(z.Modules["util/helpers.js"], ShouldContainSubstring, "exports.twice")
+		So(dna.SharedModules["shared.js"], ShouldEqual, `exports.double=function(x){return 2*x}`)
+	})
+
+	Convey("required files should be part of the DNA hash", t, func() {
+		dna, err := s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err, ShouldBeNil)
+		h.nucleus.dna = dna
+		hash1, err := DNAHashofUngenedChain(h)
+		So(err, ShouldBeNil)
+
+		os.Remove(filepath.Join(dnaPath, DefaultLibraryDir, "shared.js"))
+		WriteFile([]byte(`exports.double=function(x){return x+x}`), dnaPath, DefaultLibraryDir, "shared.js")
+		dna, err = s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err, ShouldBeNil)
+		h.nucleus.dna = dna
+		hash2, err := DNAHashofUngenedChain(h)
+		So(err, ShouldBeNil)
+		So(hash2.String(), ShouldNotEqual, hash1.String())
+	})
+
+	Convey("the modules should be saved with the DNA", t, func() {
+		dna, err := s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err, ShouldBeNil)
+		root := filepath.Join(d, "saved")
+		So(MakeDirs(root), ShouldBeNil)
+		So(s.saveDNAFile(root, dna, h.encodingFormat, false), ShouldBeNil)
+		So(FileExists(root, ChainDNADir, "jsSampleZome", "util", "helpers.js"), ShouldBeTrue)
+		So(FileExists(root, ChainDNADir, DefaultLibraryDir, "shared.js"), ShouldBeTrue)
+		saved, err := s.loadDNA(filepath.Join(root, ChainDNADir), DNAFileName, h.encodingFormat)
+		So(err, ShouldBeNil)
+		So(saved.SharedModules, ShouldResemble, dna.SharedModules)
+	})
+
+	Convey("it should fail to load a DNA requiring a missing module", t, func() {
+		os.Remove(filepath.Join(dnaPath, DefaultLibraryDir, "shared.js"))
+		_, err := s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err.Error(), ShouldEqual, "in zome jsSampleZome: cannot find module shared")
+	})
+}
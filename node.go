@@ -80,6 +80,15 @@ const (
 	// Kademlia messages
 
 	FIND_NODE_REQUEST
+
+	// Transport messages
+
+	MESSAGE_CHUNK
+
+	// Mailbox messages
+
+	MAILBOX_PUT_REQUEST
+	MAILBOX_GET_REQUEST
 )
 
 func (msgType MsgType) String() string {
@@ -99,10 +108,24 @@ func (msgType MsgType) String() string {
 		"VALIDATE_MOD_REQUEST",
 		"APP_MESSAGE",
 		"LISTADD_REQUEST",
-		"FIND_NODE_REQUEST"}[msgType]
+		"FIND_NODE_REQUEST",
+		"MESSAGE_CHUNK",
+		"MAILBOX_PUT_REQUEST",
+		"MAILBOX_GET_REQUEST"}[msgType]
 }
 
 var ErrBlockedListed = errors.New("node blockedlisted")
+var ErrMessageSourceMismatch = errors.New("message source doesn't match its sender")
+
+// UnreachableError is returned by Send when no stream could be opened to the peer
+type UnreachableError struct {
+	Peer peer.ID
+	Err  error
+}
+
+func (e UnreachableError) Error() string {
+	return fmt.Sprintf("peer %v unreachable: %v", e.Peer, e.Err)
+}
 
 // Message represents data that can be sent to node in the network
 type Message struct {
@@ -130,6 +153,12 @@ type Node struct {
 	gossiping     chan bool
 	bootstrapping chan bool
 	refreshing    chan bool
+	persisting    chan bool
+	scheduling    []chan bool
+
+	// called in their own go routines when a peer connects or is no longer connected
+	peerConnected    func(peer.ID)
+	peerDisconnected func(peer.ID)
 
 	// items for the kademlia implementation
 	plk   sync.Mutex
@@ -140,10 +169,34 @@ type Node struct {
 
 // Protocol encapsulates data for our different protocols
 type Protocol struct {
-	ID       protocol.ID
+	ID       protocol.ID // speaks the versioned CBOR envelope
+	LegacyID protocol.ID // speaks gob, kept as a fallback for older nodes
 	Receiver ReceiverFn
 }
 
+const (
+	// protocol version suffixes, which also select the wire format of a stream
+	wireProtocolVersion   = "/1.0.0"
+	legacyProtocolVersion = "/0.0.0"
+)
+
+// newProtocol creates a protocol with both current and legacy identifiers
+func newProtocol(name string, receiver ReceiverFn) *Protocol {
+	return &Protocol{
+		ID:       protocol.ID(name + wireProtocolVersion),
+		LegacyID: protocol.ID(name + legacyProtocolVersion),
+		Receiver: receiver,
+	}
+}
+
+// WireFormat returns the format to use on a stream that negotiated the given identifier
+func (p *Protocol) WireFormat(id protocol.ID) WireFormat {
+	if id == p.LegacyID {
+		return GobWireFormat
+	}
+	return CBORWireFormat
+}
+
 const (
 	ActionProtocol = iota
 	ValidateProtocol
@@ -156,6 +209,9 @@ const (
 	PeerTTL                       = time.Minute * 10
 	DefaultRoutingRefreshInterval = time.Minute
 	DefaultGossipInterval         = time.Second * 2
+	DefaultPeerSaveInterval       = time.Minute * 5
+	BucketStaleInterval           = time.Hour        // buckets without a lookup for this long get refreshed
+	PingTimeout                   = time.Second * 10 // how long to wait for a peer to answer a liveness check
 )
 
 // implement peer found function for mdns discovery
@@ -188,12 +244,14 @@ func (h *Holochain) addPeer(pi pstore.PeerInfo, confirm bool) (err error) {
 		err = h.dht.AddGossiper(pi.ID)
 		if bootstrap {
 			RoutingRefreshTask(h)
+			go FetchMailTask(h)
 		}
 	}
 	return
 }
 
 // RoutingRefreshTask fills the routing table by searching for a random node
+// and refreshes any buckets that haven't been looked up in a while
 func RoutingRefreshTask(h *Holochain) {
 	s := fmt.Sprintf("%d", rand.Intn(1000000))
 	var hash Hash
@@ -201,6 +259,30 @@ func RoutingRefreshTask(h *Holochain) {
 	if err == nil {
 		h.node.FindPeer(h.node.ctx, PeerIDFromHash(hash))
 	}
+	h.node.RefreshBuckets(BucketStaleInterval)
+}
+
+// RefreshBuckets looks up a random id in each bucket that hasn't had a lookup
+// within the given interval
+func (node *Node) RefreshBuckets(interval time.Duration) {
+	for _, i := range node.routingTable.StaleBuckets(interval) {
+		id := node.routingTable.RandomID(i)
+		node.log.Logf("refreshing bucket %d with lookup of %v", i, id)
+		node.FindPeer(node.ctx, id)
+	}
+}
+
+// Ping checks that a peer is still alive by asking it for the peers closest to us
+func (node *Node) Ping(ctx context.Context, p peer.ID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, PingTimeout)
+	defer cancel()
+	_, err = node.findPeerSingle(ctx, p, HashFromPeerID(node.HashAddr))
+	return
+}
+
+// RoutingTableHealth returns the state of the routing table for diagnostics
+func (node *Node) RoutingTableHealth() RoutingTableHealth {
+	return node.routingTable.Health(BucketStaleInterval)
 }
 
 func (node *Node) isPeerActive(id peer.ID) bool {
@@ -355,20 +437,15 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 	ps.AddPrivKey(nodeID, priv)
 	ps.AddPubKey(nodeID, priv.GetPublic())
 
-	validateProtocolString := "/hc-validate-" + protoMux + "/0.0.0"
-	gossipProtocolString := "/hc-gossip-" + protoMux + "/0.0.0"
-	actionProtocolString := "/hc-action-" + protoMux + "/0.0.0"
-	kademliaProtocolString := "/hc-kademlia-" + protoMux + "/0.0.0"
-
-	n.log.Logf("Validate protocol identifier: " + validateProtocolString)
-	n.log.Logf("Gossip protocol identifier: " + gossipProtocolString)
-	n.log.Logf("Action protocol identifier: " + actionProtocolString)
-	n.log.Logf("Kademlia protocol identifier: " + kademliaProtocolString)
+	n.protocols[ValidateProtocol] = newProtocol("/hc-validate-"+protoMux, ValidateReceiver)
+	n.protocols[GossipProtocol] = newProtocol("/hc-gossip-"+protoMux, GossipReceiver)
+	n.protocols[ActionProtocol] = newProtocol("/hc-action-"+protoMux, ActionReceiver)
+	n.protocols[KademliaProtocol] = newProtocol("/hc-kademlia-"+protoMux, KademliaReceiver)
 
-	n.protocols[ValidateProtocol] = &Protocol{protocol.ID(validateProtocolString), ValidateReceiver}
-	n.protocols[GossipProtocol] = &Protocol{protocol.ID(gossipProtocolString), GossipReceiver}
-	n.protocols[ActionProtocol] = &Protocol{protocol.ID(actionProtocolString), ActionReceiver}
-	n.protocols[KademliaProtocol] = &Protocol{protocol.ID(kademliaProtocolString), KademliaReceiver}
+	n.log.Logf("Validate protocol identifier: %s", n.protocols[ValidateProtocol].ID)
+	n.log.Logf("Gossip protocol identifier: %s", n.protocols[GossipProtocol].ID)
+	n.log.Logf("Action protocol identifier: %s", n.protocols[ActionProtocol].ID)
+	n.log.Logf("Kademlia protocol identifier: %s", n.protocols[KademliaProtocol].ID)
 
 	ctx := context.Background()
 	n.ctx = ctx
@@ -389,6 +466,9 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 
 	m := pstore.NewMetrics()
 	n.routingTable = NewRoutingTable(KValue, nodeID, time.Minute, m)
+	n.routingTable.Ping = func(p peer.ID) bool {
+		return n.Ping(n.ctx, p) == nil
+	}
 	n.peers = make(map[peer.ID]*peerTracker)
 
 	node = &n
@@ -404,8 +484,7 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 	return
 }
 
-// Encode codes a message to gob format
-// @TODO generalize for other message encoding formats
+// Encode codes a message to gob format, see EncodeWire for other formats
 func (m *Message) Encode() (data []byte, err error) {
 	data, err = ByteEncoder(m)
 	if err != nil {
@@ -414,8 +493,7 @@ func (m *Message) Encode() (data []byte, err error) {
 	return
 }
 
-// Decode converts a message from gob format
-// @TODO generalize for other message encoding formats
+// Decode converts a message from gob format, see DecodeWire for other formats
 func (m *Message) Decode(r io.Reader) (err error) {
 	dec := gob.NewDecoder(r)
 	err = dec.Decode(m)
@@ -445,7 +523,7 @@ func (m Message) String() string {
 }
 
 // respondWith writes a message either error or otherwise, to the stream
-func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
+func (node *Node) respondWith(s net.Stream, format WireFormat, err error, body interface{}) {
 	var m *Message
 	if err != nil {
 		errResp := NewErrorResponse(err)
@@ -455,36 +533,46 @@ func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
 		m = node.NewMessage(OK_RESPONSE, body)
 	}
 
-	data, err := m.Encode()
-	if err != nil {
-		Infof("Response failed: unable to encode message: %v", m)
+	err = writeMessage(s, format, m)
+	if err == ErrMessageTooLarge {
+		// let the other side know rather than leaving it hanging
+		m = node.NewMessage(ERROR_RESPONSE, NewErrorResponse(err))
+		err = writeMessage(s, format, m)
 	}
-	_, err = s.Write(data)
 	if err != nil {
-		Infof("Response failed: write returned error: %v", err)
+		Infof("Response failed: unable to write message %v: %v", m, err)
 	}
 }
 
-// StartProtocol initiates listening for a protocol on the node
+// StartProtocol initiates listening for a protocol on the node.  Streams are
+// accepted on both the current and the legacy identifiers of the protocol and
+// the one negotiated determines the wire format of the stream.
 func (node *Node) StartProtocol(h *Holochain, proto int) (err error) {
-	node.host.SetStreamHandler(node.protocols[proto].ID, func(s net.Stream) {
+	p := node.protocols[proto]
+	handler := func(s net.Stream) {
+		format := p.WireFormat(s.Protocol())
 		var m Message
-		err := m.Decode(s)
+		err := readMessage(s, format, &m)
 		var response interface{}
 		if m.From == "" {
 			// @todo other sanity checks on From?
 			err = errors.New("message must have a source")
+		} else if m.From != s.Conn().RemotePeer() {
+			// handlers trust From, so it must be the peer that opened the stream
+			err = ErrMessageSourceMismatch
 		} else {
 			if node.IsBlocked(s.Conn().RemotePeer()) {
 				err = ErrBlockedListed
 			}
 
 			if err == nil {
-				response, err = node.protocols[proto].Receiver(h, &m)
+				response, err = p.Receiver(h, &m)
 			}
 		}
-		node.respondWith(s, err, response)
-	})
+		node.respondWith(s, format, err, response)
+	}
+	node.host.SetStreamHandler(p.ID, handler)
+	node.host.SetStreamHandler(p.LegacyID, handler)
 	return
 }
 
@@ -508,6 +596,19 @@ func (node *Node) Close() error {
 		node.bootstrapping = nil
 		stop <- true
 	}
+	if node.persisting != nil {
+		node.log.Log("Stopping peer saving")
+		stop := node.persisting
+		node.persisting = nil
+		stop <- true
+	}
+	if node.scheduling != nil {
+		node.log.Log("Stopping scheduled functions")
+		for _, stop := range node.scheduling {
+			stop <- true
+		}
+		node.scheduling = nil
+	}
 	return node.proc.Close()
 }
 
@@ -519,28 +620,25 @@ func (node *Node) Send(ctx context.Context, proto int, addr peer.ID, m *Message)
 		return
 	}
 
-	s, err := node.host.NewStream(ctx, addr, node.protocols[proto].ID)
+	// prefer the current wire format but fall back to gob if that's all the
+	// other node speaks
+	p := node.protocols[proto]
+	s, err := node.host.NewStream(ctx, addr, p.ID, p.LegacyID)
 	if err != nil {
+		err = UnreachableError{Peer: addr, Err: err}
 		return
 	}
 	defer s.Close()
+	format := p.WireFormat(s.Protocol())
 
 	// encode the message and send it
-	data, err := m.Encode()
+	err = writeMessage(s, format, m)
 	if err != nil {
 		return
 	}
 
-	n, err := s.Write(data)
-	if err != nil {
-		return
-	}
-	if n != len(data) {
-		err = errors.New("unable to send all data")
-	}
-
 	// decode the response
-	err = response.Decode(s)
+	err = readMessage(s, format, &response)
 	if err != nil {
 		node.log.Logf("failed to decode with err:%v ", err)
 		return
@@ -3,6 +3,7 @@ package holochain
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	ic "github.com/libp2p/go-libp2p-crypto"
@@ -12,6 +13,7 @@ import (
 	. "github.com/metacurrency/holochain/hash"
 	ma "github.com/multiformats/go-multiaddr"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -184,6 +186,14 @@ func TestNodeSend(t *testing.T) {
 		So(r.Body.(ErrorResponse).Message, ShouldEqual, "message must have a source")
 	})
 
+	Convey("It should fail on messages whose source isn't the sender", t, func() {
+		m := Message{Type: PUT_REQUEST, Body: "fish", From: node1.HashAddr}
+		r, err := node2.Send(context.Background(), ActionProtocol, node1.HashAddr, &m)
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, ERROR_RESPONSE)
+		So(r.Body.(ErrorResponse).Message, ShouldEqual, ErrMessageSourceMismatch.Error())
+	})
+
 	Convey("It should fail on incorrect message types", t, func() {
 		m := node1.NewMessage(PUT_REQUEST, "fish")
 		r, err := node1.Send(context.Background(), ValidateProtocol, node2.HashAddr, m)
@@ -245,6 +255,15 @@ func TestNodeSend(t *testing.T) {
 		So(err, ShouldEqual, ErrBlockedListed)
 	})
 
+	Convey("it should fall back to the legacy wire format", t, func() {
+		node1.Unblock(node2.HashAddr)
+		node1.host.RemoveStreamHandler(node1.protocols[GossipProtocol].ID)
+		m := node2.NewMessage(GOSSIP_REQUEST, GossipReq{})
+		r, err := node2.Send(context.Background(), GossipProtocol, node1.HashAddr, m)
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, OK_RESPONSE)
+		So(fmt.Sprintf("%T", r.Body), ShouldEqual, "holochain.Gossip")
+	})
 }
 
 func TestNodeBlockedList(t *testing.T) {
@@ -316,6 +335,104 @@ func TestMessageCoding(t *testing.T) {
 
 }
 
+func TestMessageWireCoding(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
+	bodies := []interface{}{
+		nil,
+		"foo",
+		DHTChangeOK,
+		PutReq{H: hash},
+		GetResp{Entry: GobEntry{C: "3"}, Sources: []string{"a", "b"}},
+		GetResp{Entry: GobEntry{C: AgentEntry{Identity: "zippy"}}},
+		ErrorResponse{Code: ErrHashNotFoundCode, Message: "hash not found"},
+		Gossip{Puts: []Put{Put{Idx: 1, M: *node.NewMessage(PUT_REQUEST, PutReq{H: hash})}}},
+	}
+
+	Convey("It should encode and decode messages in the CBOR envelope", t, func() {
+		for _, body := range bodies {
+			m := node.NewMessage(OK_RESPONSE, body)
+			d, err := m.EncodeWire(CBORWireFormat)
+			So(err, ShouldBeNil)
+
+			var m2 Message
+			err = m2.DecodeWire(CBORWireFormat, bytes.NewReader(d))
+			So(err, ShouldBeNil)
+			So(m2, ShouldResemble, *m)
+		}
+	})
+
+	Convey("It should dereference pointer bodies", t, func() {
+		m := node.NewMessage(OK_RESPONSE, &CloserPeersResp{CloserPeers: []PeerInfo{PeerInfo{ID: []byte(node.HashAddr)}}})
+		d, err := m.EncodeWire(CBORWireFormat)
+		So(err, ShouldBeNil)
+		var m2 Message
+		err = m2.DecodeWire(CBORWireFormat, bytes.NewReader(d))
+		So(err, ShouldBeNil)
+		So(m2.Body.(CloserPeersResp).CloserPeers[0].ID, ShouldResemble, []byte(node.HashAddr))
+	})
+
+	Convey("It should still encode and decode gob", t, func() {
+		m := node.NewMessage(OK_RESPONSE, GetResp{Entry: GobEntry{C: "3"}})
+		d, err := m.EncodeWire(GobWireFormat)
+		So(err, ShouldBeNil)
+		var m2 Message
+		err = m2.DecodeWire(GobWireFormat, bytes.NewReader(d))
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", m), ShouldEqual, fmt.Sprintf("%v", &m2))
+	})
+
+	Convey("It should reject unregistered body types", t, func() {
+		m := node.NewMessage(OK_RESPONSE, struct{ X int }{1})
+		_, err := m.EncodeWire(CBORWireFormat)
+		So(err.Error(), ShouldStartWith, ErrUnknownWireSchema.Error())
+	})
+
+	Convey("It should reject envelopes from the future and truncated ones", t, func() {
+		m := node.NewMessage(OK_RESPONSE, "foo")
+		d, err := m.EncodeWire(CBORWireFormat)
+		So(err, ShouldBeNil)
+		var m2 Message
+		err = m2.DecodeWire(CBORWireFormat, bytes.NewReader(d[:len(d)-1]))
+		So(err, ShouldNotBeNil)
+
+		// envelope starts with a 4 byte length, the map header, and the "v" key
+		So(d[7], ShouldEqual, WireVersion)
+		d[7] = WireVersion + 1
+		err = m2.DecodeWire(CBORWireFormat, bytes.NewReader(d))
+		So(err.Error(), ShouldEqual, "unsupported wire version: 2")
+	})
+
+	Convey("It should not trust the claimed envelope size or nesting", t, func() {
+		var m2 Message
+		d := []byte{0, 0, 0, 0, 0xa0}
+		binary.BigEndian.PutUint32(d, MaxEnvelopeSize)
+		err := m2.DecodeWire(CBORWireFormat, bytes.NewReader(d))
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+
+		// an array holding an array holding an array...
+		nested := append(bytes.Repeat([]byte{0x81}, 100000), 0xf6)
+		dec := cborDecoder{buf: nested}
+		_, err = dec.generic()
+		So(err, ShouldEqual, ErrWireTooDeep)
+		dec = cborDecoder{buf: nested}
+		_, err = dec.skip()
+		So(err, ShouldEqual, ErrWireTooDeep)
+	})
+
+	Convey("It should pick the wire format from the negotiated protocol", t, func() {
+		p := node.protocols[ActionProtocol]
+		So(p.WireFormat(p.ID), ShouldEqual, CBORWireFormat)
+		So(p.WireFormat(p.LegacyID), ShouldEqual, GobWireFormat)
+		So(string(p.LegacyID), ShouldEndWith, "/0.0.0")
+	})
+}
+
 func TestFingerprintMessage(t *testing.T) {
 	Convey("it should create a unique fingerprint for messages", t, func() {
 		var id peer.ID
@@ -56,6 +56,9 @@ func (nn *netNotifiee) Connected(n inet.Network, v inet.Conn) {
 	if ctx.Err() == nil {
 		node.routingTable.Update(v.RemotePeer())
 	}
+	if node.peerConnected != nil {
+		go node.peerConnected(v.RemotePeer())
+	}
 }
 
 func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
@@ -80,6 +83,9 @@ func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
 		delete(nn.peers, v.RemotePeer())
 		conn.cancel()
 		node.routingTable.Remove(v.RemotePeer())
+		if node.peerDisconnected != nil {
+			go node.peerDisconnected(v.RemotePeer())
+		}
 	}
 }
 
@@ -5,9 +5,11 @@
 package holochain
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/google/uuid"
 	. "github.com/metacurrency/holochain/hash"
+	"strings"
 )
 
 type DNA struct {
@@ -20,14 +22,52 @@ type DNA struct {
 	BasedOn                   Hash   // references hash of another holochain that these schemas and code are derived from
 	RequiresVersion           int
 	DHTConfig                 DHTConfig
+	ExecutionLimits           *ExecutionLimits `json:",omitempty"`
+	StrictValidation          bool             `json:",omitempty" toml:",omitempty"` // run validation callbacks without access to non-deterministic functions
 	Progenitor                Progenitor
 	Zomes                     []Zome
+	SharedModules             map[string]string `json:",omitempty" toml:",omitempty"` // JS modules of the library directory required by zomes, by path
 	propertiesSchemaValidator SchemaValidator
 }
 
 func (dna *DNA) check() (err error) {
 	if dna.RequiresVersion > Version {
 		err = fmt.Errorf("Chain requires Holochain version %d", dna.RequiresVersion)
+		return
+	}
+	if dna.ExecutionLimits != nil {
+		for i := range dna.Zomes {
+			if err = dna.ExecutionLimits.checkZome(&dna.Zomes[i]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// validateProperties checks the DNA's properties, with any instance properties overriding
+// them, against the DNA's properties schema
+func (dna *DNA) validateProperties(instance map[string]string) (err error) {
+	if dna.PropertiesSchema == "" {
+		return
+	}
+	if dna.propertiesSchemaValidator == nil {
+		var v *JSONSchemaValidator
+		if v, err = BuildJSONSchemaValidatorFromString(dna.PropertiesSchema); err != nil {
+			err = fmt.Errorf("error building validator for properties schema: %v", err)
+			return
+		}
+		dna.propertiesSchemaValidator = v
+	}
+	props := make(map[string]interface{})
+	for k, v := range dna.Properties {
+		props[k] = v
+	}
+	for k, v := range instance {
+		props[k] = v
+	}
+	if err = dna.propertiesSchemaValidator.Validate(props); err != nil {
+		err = fmt.Errorf("properties don't match the properties schema: %v", err)
 	}
 	return
 }
@@ -51,9 +91,85 @@ func NewNucleus(h *Holochain, dna *DNA) *Nucleus {
 		h:    h,
 		alog: &h.Config.Loggers.App,
 	}
+	dna.buildSchemaValidators()
 	return &nucleus
 }
 
+// buildSchemaValidators builds the validators of the functions' schemas that aren't yet
+// built, so that calls never have to.  A schema that fails to build is left for the calls
+// of its function to report.
+func (dna *DNA) buildSchemaValidators() {
+	for i := range dna.Zomes {
+		for j := range dna.Zomes[i].Functions {
+			f := &dna.Zomes[i].Functions[j]
+			if (f.InputSchema != "" && f.inputValidator == nil) || (f.OutputSchema != "" && f.outputValidator == nil) {
+				f.BuildSchemaValidators()
+			}
+		}
+	}
+}
+
+const (
+	// the optional lifecycle callbacks that zomes may define
+
+	PeerConnectedHook    = "onPeerConnected"    // (peerID) a peer connected to the node
+	PeerDisconnectedHook = "onPeerDisconnected" // (peerID) a peer is no longer connected
+	ShutdownHook         = "onShutdown"         // () the holochain is closing
+	HeldHook             = "onHeld"             // (hash, entryType) a valid entry was put in the local DHT shard
+	CountersignedHook    = "onCountersigned"    // (hash, warrant) all the parties signed an entry we countersigned
+
+	// the optional callbacks whose boolean answer holochain acts on
+
+	CountersignProposalHook = "onCountersignProposal" // (proposer, entryType, entry) return true to countersign the entry
+)
+
+// RunHook runs a lifecycle callback in each zome that defines it.  As nothing waits on the
+// callbacks their errors are logged to the app logger rather than returned.
+func (n *Nucleus) RunHook(hook string, args ...string) {
+	for _, zome := range n.dna.Zomes {
+		if !n.mayDefine(&zome, hook) {
+			continue
+		}
+		r, _, release, err := n.h.GetRibosome(zome.Name)
+		if err == nil {
+			err = r.Hook(hook, args...)
+			release()
+		}
+		if err != nil {
+			n.alog.Logf("%s in zome %s failed: %v", hook, zome.Name, err)
+		}
+	}
+}
+
+// DispatchHook runs a lifecycle callback in its own go routine
+func (n *Nucleus) DispatchHook(hook string, args ...string) {
+	go n.RunHook(hook, args...)
+}
+
+// mayDefine reports whether a zome's code mentions a callback at all, which saves making
+// a ribosome for each event just to find out that the zome doesn't define it
+func (n *Nucleus) mayDefine(zome *Zome, name string) bool {
+	code := zome.Code
+	if zome.RibosomeType == WasmRibosomeType {
+		b, err := base64.StdEncoding.DecodeString(code)
+		if err != nil {
+			return true
+		}
+		code = string(b)
+	}
+	if strings.Contains(code, name) {
+		return true
+	}
+	for _, modules := range []map[string]string{zome.Modules, n.dna.SharedModules} {
+		for _, m := range modules {
+			if strings.Contains(m, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (n *Nucleus) RunGenesis() (err error) {
 	var ribosome Ribosome
 	// run the init functions of each zome
@@ -61,6 +177,7 @@ func (n *Nucleus) RunGenesis() (err error) {
 		ribosome, err = zome.MakeRibosome(n.h)
 		if err == nil {
 			err = ribosome.ChainGenesis()
+			ribosome.Close()
 			if err != nil {
 				err = fmt.Errorf("In '%s' zome: %s", zome.Name, err.Error())
 				return
@@ -84,6 +201,7 @@ func (n *Nucleus) Start() (err error) {
 type AppMsg struct {
 	ZomeType string
 	Body     string
+	Sealed   []byte // Body encrypted to the recipient, in which case Body is empty
 }
 
 // ActionReceiver handles messages on the action protocol
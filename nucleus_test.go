@@ -1,6 +1,7 @@
 package holochain
 
 import (
+	"bytes"
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"os"
@@ -19,6 +20,88 @@ func TestNewNucleus(t *testing.T) {
 		So(nucleus.h, ShouldEqual, &h)
 		So(nucleus.alog, ShouldEqual, &h.Config.Loggers.App)
 	})
+
+	Convey("It should build the validators of the functions' schemas", t, func() {
+		dna := DNA{Zomes: []Zome{{Name: "z", Functions: []FunctionDef{
+			{Name: "checked", InputSchema: `{"type":"integer"}`},
+			{Name: "bad", OutputSchema: `{"type":`},
+			{Name: "unchecked"},
+		}}}}
+		NewNucleus(&h, &dna)
+		fns := dna.Zomes[0].Functions
+		So(fns[0].inputValidator, ShouldNotBeNil)
+		So(fns[1].outputValidator, ShouldBeNil)
+		So(fns[2].inputValidator, ShouldBeNil)
+	})
+}
+
+func TestEncodeDNAUnsetFields(t *testing.T) {
+	dna := DNA{Name: "test", Zomes: []Zome{{Name: "zome", Functions: []FunctionDef{{Name: "fn"}}}}}
+
+	Convey("fields added to the DNA should be left out when unset so the DNA hashes as before", t, func() {
+		for _, format := range []string{"json", "toml", "yaml"} {
+			var b bytes.Buffer
+			err := Encode(&b, format, &dna)
+			So(err, ShouldBeNil)
+			for _, field := range []string{"MaxEntrySize", "ExecutionLimits", "StrictValidation", "SharedModules", "Modules", "Interval", "InputSchema", "OutputSchema"} {
+				So(b.String(), ShouldNotContainSubstring, field)
+			}
+		}
+	})
+}
+
+func TestValidateProperties(t *testing.T) {
+	dna := DNA{
+		Properties:       map[string]string{"language": "en"},
+		PropertiesSchema: `{"type":"object","properties":{"language":{"enum":["en","fr"]}},"required":["language"]}`,
+	}
+
+	Convey("it should accept properties matching the schema", t, func() {
+		So(dna.validateProperties(nil), ShouldBeNil)
+		So(dna.validateProperties(map[string]string{"language": "fr"}), ShouldBeNil)
+	})
+
+	Convey("it should check instance properties over the DNA's", t, func() {
+		err := dna.validateProperties(map[string]string{"language": "klingon"})
+		So(err.Error(), ShouldStartWith, "properties don't match the properties schema: ")
+	})
+
+	Convey("it should reject DNA properties not matching the schema", t, func() {
+		bad := DNA{PropertiesSchema: dna.PropertiesSchema}
+		So(bad.validateProperties(nil), ShouldNotBeNil)
+	})
+
+	Convey("it should accept anything without a schema", t, func() {
+		none := DNA{Properties: map[string]string{"language": "klingon"}}
+		So(none.validateProperties(nil), ShouldBeNil)
+	})
+}
+
+func TestRunHook(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	var zome *Zome
+	for i := range h.nucleus.dna.Zomes {
+		if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" {
+			zome = &h.nucleus.dna.Zomes[i]
+		}
+	}
+
+	Convey("it should only make ribosomes for zomes that mention the callback", t, func() {
+		So(h.nucleus.mayDefine(zome, HeldHook), ShouldBeFalse)
+		So(h.nucleus.mayDefine(zome, "genesis"), ShouldBeTrue)
+	})
+
+	Convey("it should log errors from lifecycle callbacks to the app logger", t, func() {
+		code := zome.Code
+		defer func() { zome.Code = code; h.FlushRibosomes() }()
+		zome.Code = code + "\nfunction onPeerConnected(id) {throw new Error('no peers for '+id)}"
+		h.FlushRibosomes()
+		ShouldLog(h.nucleus.alog, "onPeerConnected in zome jsSampleZome failed: Error executing onPeerConnected: ", func() {
+			h.nucleus.RunHook(PeerConnectedHook, "QmFoo")
+		})
+	})
 }
 
 func TestAppMessages(t *testing.T) {
@@ -0,0 +1,266 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// passphrase protection of the agent's private key file
+//
+// An encrypted priv.key holds a header naming the format and the scrypt parameters, the
+// salt, the nonce and the key bytes sealed in a nacl secretbox with the key that scrypt
+// derives from the passphrase.  Keys written before encryption existed are raw key bytes,
+// which are still loaded as is.
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	// PassphraseEnvVar names the environment variable that may hold the passphrase of the
+	// agent's private key
+	PassphraseEnvVar = "HC_PASSPHRASE"
+
+	// PassphraseFDEnvVar names the environment variable that may hold the number of a
+	// file descriptor from which to read the passphrase
+	PassphraseFDEnvVar = "HC_PASSPHRASE_FD"
+
+	keyFileMagic     = "HCKEY"
+	keyFileVersion   = 1
+	keyFileSaltSize  = 32
+	keyFileNonceSize = 24
+	keyFileHeaderLen = len(keyFileMagic) + 4
+
+	// scrypt parameters for new key files, as log2 of N, r and p
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+var ErrNoPassphrase = errors.New("private key is encrypted but no passphrase was given")
+var ErrWrongPassphrase = errors.New("wrong passphrase for private key")
+
+// PassphrasePrompt, when set, is asked for the passphrase if neither of the passphrase
+// environment variables gives one, with confirm set when the passphrase is for a new key
+// file.  An empty passphrase means the key file isn't encrypted.  The command line tools
+// set this to prompt on the terminal.
+var PassphrasePrompt func(prompt string, confirm bool) (passphrase []byte, err error)
+
+// passphraseCache holds the passphrase read from a file descriptor or prompted for, as
+// those can only be asked once
+var passphraseCache struct {
+	lk         sync.Mutex
+	known      bool
+	passphrase []byte
+}
+
+// agentPassphrase returns the passphrase for the key file in path from, in order, the
+// passphrase environment variable, the file descriptor named by the file descriptor
+// environment variable, or PassphrasePrompt.  It returns nil if none of them gives one.
+func agentPassphrase(path string, confirm bool) (passphrase []byte, err error) {
+	if p := os.Getenv(PassphraseEnvVar); p != "" {
+		passphrase = []byte(p)
+		return
+	}
+	passphraseCache.lk.Lock()
+	defer passphraseCache.lk.Unlock()
+	if passphraseCache.known {
+		passphrase = passphraseCache.passphrase
+		return
+	}
+	if fdStr := os.Getenv(PassphraseFDEnvVar); fdStr != "" {
+		var fd int
+		fd, err = strconv.Atoi(fdStr)
+		if err != nil {
+			err = fmt.Errorf("bad %s: %v", PassphraseFDEnvVar, err)
+			return
+		}
+		f := os.NewFile(uintptr(fd), "passphrase")
+		var b []byte
+		b, err = ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			err = fmt.Errorf("error reading passphrase from file descriptor %d: %v", fd, err)
+			return
+		}
+		passphrase = bytes.TrimRight(b, "\r\n")
+	} else if PassphrasePrompt != nil {
+		passphrase, err = PassphrasePrompt("Passphrase for "+filepath.Join(path, PrivKeyFileName), confirm)
+		if err != nil {
+			return
+		}
+	} else {
+		return
+	}
+	if len(passphrase) == 0 {
+		passphrase = nil
+	}
+	passphraseCache.known = true
+	passphraseCache.passphrase = passphrase
+	return
+}
+
+// forgetPassphrase clears the cached passphrase
+func forgetPassphrase() {
+	passphraseCache.lk.Lock()
+	passphraseCache.known = false
+	passphraseCache.passphrase = nil
+	passphraseCache.lk.Unlock()
+}
+
+// IsEncryptedKey reports whether the contents of a key file are encrypted
+func IsEncryptedKey(data []byte) bool {
+	return len(data) >= keyFileHeaderLen && string(data[:len(keyFileMagic)]) == keyFileMagic
+}
+
+// EncryptKey seals private key bytes with a key derived from the passphrase
+func EncryptKey(k []byte, passphrase []byte) (data []byte, err error) {
+	var salt [keyFileSaltSize]byte
+	var nonce [keyFileNonceSize]byte
+	if _, err = io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return
+	}
+	var key *[32]byte
+	key, err = keyFileKey(passphrase, salt[:], scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return
+	}
+	data = append([]byte(keyFileMagic), keyFileVersion, scryptLogN, scryptR, scryptP)
+	data = append(data, salt[:]...)
+	data = append(data, nonce[:]...)
+	data = secretbox.Seal(data, k, &nonce, key)
+	return
+}
+
+// DecryptKey opens key file contents sealed with EncryptKey
+func DecryptKey(data []byte, passphrase []byte) (k []byte, err error) {
+	if !IsEncryptedKey(data) || len(data) < keyFileHeaderLen+keyFileSaltSize+keyFileNonceSize+secretbox.Overhead {
+		err = errors.New("not an encrypted key file")
+		return
+	}
+	header := data[len(keyFileMagic):keyFileHeaderLen]
+	if header[0] != keyFileVersion {
+		err = fmt.Errorf("unknown key file version %d", header[0])
+		return
+	}
+	salt := data[keyFileHeaderLen : keyFileHeaderLen+keyFileSaltSize]
+	var nonce [keyFileNonceSize]byte
+	copy(nonce[:], data[keyFileHeaderLen+keyFileSaltSize:])
+	var key *[32]byte
+	key, err = keyFileKey(passphrase, salt, header[1], header[2], header[3])
+	if err != nil {
+		return
+	}
+	k, ok := secretbox.Open(nil, data[keyFileHeaderLen+keyFileSaltSize+keyFileNonceSize:], &nonce, key)
+	if !ok {
+		err = ErrWrongPassphrase
+	}
+	return
+}
+
+// keyFileKey derives the key that seals a key file from the passphrase.  Parameters above
+// the ones EncryptKey writes are refused so that a tampered key file can't make loading it
+// take all the memory and time scrypt could be asked for.
+func keyFileKey(passphrase []byte, salt []byte, logN byte, r byte, p byte) (key *[32]byte, err error) {
+	if logN == 0 || logN > scryptLogN || r == 0 || r > scryptR || p == 0 || p > scryptP {
+		err = fmt.Errorf("bad key file scrypt parameters: logN=%d r=%d p=%d", logN, r, p)
+		return
+	}
+	var b []byte
+	b, err = scrypt.Key(passphrase, salt, 1<<logN, int(r), int(p), 32)
+	if err != nil {
+		return
+	}
+	key = new([32]byte)
+	copy(key[:], b)
+	return
+}
+
+// writeKeyFile writes the private key bytes to the key file in path, encrypted if there is
+// a passphrase, and leaves the file read-only.  The bytes go to a temporary file that is
+// then renamed over the key file, so a failed write never leaves the agent without a key.
+func writeKeyFile(path string, k []byte, passphrase []byte) (err error) {
+	return writeKeyFileAs(path, PrivKeyFileName, k, passphrase)
+}
+
+// writeKeyFileAs writes a key file under the given name
+func writeKeyFileAs(path string, name string, k []byte, passphrase []byte) (err error) {
+	data := k
+	if passphrase != nil {
+		data, err = EncryptKey(k, passphrase)
+		if err != nil {
+			return
+		}
+	}
+	var tmp *os.File
+	tmp, err = ioutil.TempFile(path, PrivKeyFileName+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(tmp.Name(), OS_USER_R); err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), filepath.Join(path, name))
+	return
+}
+
+// readKeyFile reads the private key bytes from the key file in path, decrypting them with
+// the agent's passphrase if the file is encrypted
+func readKeyFile(path string) (k []byte, err error) {
+	k, err = ReadFile(path, PrivKeyFileName)
+	if err != nil || !IsEncryptedKey(k) {
+		return
+	}
+	var passphrase []byte
+	passphrase, err = agentPassphrase(path, false)
+	if err != nil {
+		return
+	}
+	if passphrase == nil {
+		err = ErrNoPassphrase
+		return
+	}
+	k, err = DecryptKey(k, passphrase)
+	return
+}
+
+// SetAgentPassphrase rewrites the agent's key file in path encrypted with a new passphrase,
+// or unencrypted if newPassphrase is nil.  The current passphrase comes from the usual
+// sources and is only needed if the file is already encrypted, so this also encrypts key
+// files written before encryption existed.
+func SetAgentPassphrase(path string, newPassphrase []byte) (err error) {
+	var k []byte
+	k, err = readKeyFile(path)
+	if err != nil {
+		return
+	}
+	err = writeKeyFile(path, k, newPassphrase)
+	return
+}
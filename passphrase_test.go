@@ -0,0 +1,131 @@
+package holochain
+
+import (
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptKey(t *testing.T) {
+	k := []byte("some private key bytes")
+
+	Convey("it should decrypt what it encrypts with the same passphrase", t, func() {
+		data, err := EncryptKey(k, []byte("secret"))
+		So(err, ShouldBeNil)
+		So(IsEncryptedKey(data), ShouldBeTrue)
+		So(string(data), ShouldNotContainSubstring, string(k))
+		d, err := DecryptKey(data, []byte("secret"))
+		So(err, ShouldBeNil)
+		So(string(d), ShouldEqual, string(k))
+	})
+
+	Convey("it should fail to decrypt with the wrong passphrase", t, func() {
+		data, err := EncryptKey(k, []byte("secret"))
+		So(err, ShouldBeNil)
+		_, err = DecryptKey(data, []byte("guess"))
+		So(err, ShouldEqual, ErrWrongPassphrase)
+	})
+
+	Convey("it should not mistake raw keys for encrypted ones", t, func() {
+		So(IsEncryptedKey(k), ShouldBeFalse)
+		_, err := DecryptKey(k, []byte("secret"))
+		So(err.Error(), ShouldEqual, "not an encrypted key file")
+	})
+
+	Convey("it should refuse scrypt parameters above the ones it writes", t, func() {
+		data, err := EncryptKey(k, []byte("secret"))
+		So(err, ShouldBeNil)
+		data[len(keyFileMagic)+1] = scryptLogN + 1
+		_, err = DecryptKey(data, []byte("secret"))
+		So(err.Error(), ShouldEqual, fmt.Sprintf("bad key file scrypt parameters: logN=%d r=%d p=%d", scryptLogN+1, scryptR, scryptP))
+		data[len(keyFileMagic)+1] = scryptLogN
+		data[len(keyFileMagic)+2] = 255
+		_, err = DecryptKey(data, []byte("secret"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAgentPassphrase(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	defer forgetPassphrase()
+	a, _ := NewAgent(LibP2P, AgentIdentity("zippy@someemail.com"), MakeTestSeed(""))
+
+	Convey("it should encrypt the private key with the passphrase from the environment", t, func() {
+		os.Setenv(PassphraseEnvVar, "secret")
+		defer os.Unsetenv(PassphraseEnvVar)
+		err := SaveAgent(d, a)
+		So(err, ShouldBeNil)
+		k, _ := ReadFile(d, PrivKeyFileName)
+		So(IsEncryptedKey(k), ShouldBeTrue)
+		a2, err := LoadAgent(d)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+	})
+
+	Convey("it should fail to load an encrypted key without a passphrase", t, func() {
+		forgetPassphrase()
+		_, err := LoadAgent(d)
+		So(err, ShouldEqual, ErrNoPassphrase)
+	})
+
+	Convey("it should read the passphrase from a file descriptor", t, func() {
+		forgetPassphrase()
+		r, w, err := os.Pipe()
+		So(err, ShouldBeNil)
+		w.Write([]byte("secret\n"))
+		w.Close()
+		os.Setenv(PassphraseFDEnvVar, fmt.Sprintf("%d", r.Fd()))
+		defer os.Unsetenv(PassphraseFDEnvVar)
+		a2, err := LoadAgent(d)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+	})
+
+	Convey("it should ask the prompt for the passphrase, only once", t, func() {
+		forgetPassphrase()
+		asked := 0
+		PassphrasePrompt = func(prompt string, confirm bool) ([]byte, error) {
+			asked++
+			So(prompt, ShouldEqual, "Passphrase for "+filepath.Join(d, PrivKeyFileName))
+			So(confirm, ShouldBeFalse)
+			return []byte("guess"), nil
+		}
+		defer func() { PassphrasePrompt = nil }()
+		_, err := LoadAgent(d)
+		So(err, ShouldEqual, ErrWrongPassphrase)
+		_, err = LoadAgent(d)
+		So(err, ShouldEqual, ErrWrongPassphrase)
+		So(asked, ShouldEqual, 1)
+	})
+
+	Convey("it should encrypt keys saved without a passphrase", t, func() {
+		forgetPassphrase()
+		p := filepath.Join(d, "plain")
+		So(os.Mkdir(p, os.ModePerm), ShouldBeNil)
+		So(SaveAgent(p, a), ShouldBeNil)
+		k, _ := ReadFile(p, PrivKeyFileName)
+		So(IsEncryptedKey(k), ShouldBeFalse)
+
+		So(SetAgentPassphrase(p, []byte("secret")), ShouldBeNil)
+		k, _ = ReadFile(p, PrivKeyFileName)
+		So(IsEncryptedKey(k), ShouldBeTrue)
+		perms, _ := filePerms(p, PrivKeyFileName)
+		So(perms, ShouldEqual, OS_USER_R)
+		tmps, _ := filepath.Glob(filepath.Join(p, PrivKeyFileName+".tmp*"))
+		So(len(tmps), ShouldEqual, 0)
+
+		os.Setenv(PassphraseEnvVar, "secret")
+		defer os.Unsetenv(PassphraseEnvVar)
+		So(SetAgentPassphrase(p, []byte("new secret")), ShouldBeNil)
+		_, err := LoadAgent(p)
+		So(err, ShouldEqual, ErrWrongPassphrase)
+		os.Setenv(PassphraseEnvVar, "new secret")
+		a2, err := LoadAgent(p)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), a2.PrivKey()), ShouldBeTrue)
+	})
+}
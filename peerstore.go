@@ -0,0 +1,251 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// peerstore implements saving and restoring of known peers and the routing table so
+// that a node can reconnect right away after a restart without bootstrapping
+
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SavedPeersVersion is the version of the saved peers file format
+	SavedPeersVersion = 1
+)
+
+// SavedPeer holds a peer and its addresses as saved to disk
+type SavedPeer struct {
+	ID    string
+	Addrs []string
+}
+
+// SavedPeers holds the saved state of the peerstore and routing table
+type SavedPeers struct {
+	Version int
+	Peers   []SavedPeer
+	Buckets [][]string // ids of the peers in each bucket from most to least recently seen
+}
+
+// SavePeers writes the known peers, their addresses, and the routing table buckets
+// to the given file
+func (node *Node) SavePeers(path string) (err error) {
+	saved := SavedPeers{Version: SavedPeersVersion}
+
+	for _, id := range node.peerstore.Peers() {
+		if id == node.HashAddr || node.IsBlocked(id) {
+			continue
+		}
+		addrs := node.peerstore.Addrs(id)
+		if len(addrs) == 0 {
+			continue
+		}
+		p := SavedPeer{ID: peer.IDB58Encode(id)}
+		for _, a := range addrs {
+			p.Addrs = append(p.Addrs, a.String())
+		}
+		saved.Peers = append(saved.Peers, p)
+	}
+
+	node.routingTable.tabLock.RLock()
+	for _, b := range node.routingTable.Buckets {
+		var ids []string
+		for _, id := range b.Peers() {
+			ids = append(ids, peer.IDB58Encode(id))
+		}
+		saved.Buckets = append(saved.Buckets, ids)
+	}
+	node.routingTable.tabLock.RUnlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// write to a temp file and rename so a crash never leaves a partial file
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp, path)
+	return
+}
+
+// LoadPeers restores peers saved by SavePeers into the peerstore and routing table,
+// returning the restored peers in routing table order.  It's not an error for the
+// file not to exist.
+func (node *Node) LoadPeers(path string) (pis []pstore.PeerInfo, err error) {
+	all, pis, err := readSavedPeers(path, func(id peer.ID) bool {
+		return id == node.HashAddr || node.IsBlocked(id)
+	})
+	if err != nil {
+		return
+	}
+	for _, pi := range all {
+		node.peerstore.AddAddrs(pi.ID, pi.Addrs, PeerTTL)
+	}
+	for _, pi := range pis {
+		node.routingTable.Update(pi.ID)
+	}
+	return
+}
+
+// readSavedPeers decodes a file written by SavePeers, returning all the saved peers
+// and, least recently seen first, the ones that were in the routing table.  Peers for
+// which skip returns true are left out.
+func readSavedPeers(path string, skip func(peer.ID) bool) (all []pstore.PeerInfo, ordered []pstore.PeerInfo, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	var saved SavedPeers
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return
+	}
+	if saved.Version > SavedPeersVersion {
+		err = fmt.Errorf("unknown saved peers version: %d", saved.Version)
+		return
+	}
+
+	infos := make(map[peer.ID]pstore.PeerInfo)
+	for _, p := range saved.Peers {
+		var id peer.ID
+		id, err = peer.IDB58Decode(p.ID)
+		if err != nil {
+			return
+		}
+		if skip(id) {
+			continue
+		}
+		pi := pstore.PeerInfo{ID: id}
+		for _, s := range p.Addrs {
+			var a ma.Multiaddr
+			a, err = ma.NewMultiaddr(s)
+			if err != nil {
+				return
+			}
+			pi.Addrs = append(pi.Addrs, a)
+		}
+		infos[id] = pi
+		all = append(all, pi)
+	}
+
+	// take bucket members least recently seen first so each ends up where it was
+	for _, b := range saved.Buckets {
+		for i := len(b) - 1; i >= 0; i-- {
+			var id peer.ID
+			id, err = peer.IDB58Decode(b[i])
+			if err != nil {
+				return
+			}
+			pi, ok := infos[id]
+			if !ok {
+				continue
+			}
+			ordered = append(ordered, pi)
+		}
+	}
+	return
+}
+
+// SavedRoutingTableHealth returns the health of the routing table the node last saved,
+// for reporting on a holochain that isn't running.  It only reads the saved peers file
+// so it works on a holochain that hasn't been prepared, and never touches a running one.
+func (h *Holochain) SavedRoutingTableHealth() (health RoutingTableHealth, err error) {
+	_, pis, err := readSavedPeers(h.peersPath(), func(id peer.ID) bool {
+		return id == h.nodeID
+	})
+	if err != nil {
+		return
+	}
+	rt := NewRoutingTable(KValue, h.nodeID, time.Minute, pstore.NewMetrics())
+	for _, pi := range pis {
+		rt.Update(pi.ID)
+	}
+	health = rt.Health(BucketStaleInterval)
+	return
+}
+
+// peersPath returns the path of the saved peers file
+func (h *Holochain) peersPath() string {
+	return filepath.Join(h.DBPath(), PeerStoreFileName)
+}
+
+// SavePeers saves the node's peers to the chain's db directory
+func (h *Holochain) SavePeers() (err error) {
+	node := h.node
+	if node == nil {
+		return
+	}
+	return node.SavePeers(h.peersPath())
+}
+
+// PeerSaveTask periodically saves the peerstore and routing table
+func PeerSaveTask(h *Holochain) {
+	err := h.SavePeers()
+	if err != nil {
+		// the dht may already be gone if the task runs while we are closing
+		if dht := h.dht; dht != nil && dht.dlog != nil {
+			dht.dlog.Logf("error saving peers: %v", err)
+		} else {
+			h.Debugf("error saving peers: %v", err)
+		}
+	}
+}
+
+// restorePeers loads any saved peers and then confirms in the background that
+// they are still reachable, dropping the ones that aren't, and fetches any mail
+// held for us while we were away.  A saved peers file that can't be loaded is
+// discarded, as the node can always find its peers again by bootstrapping.
+func (h *Holochain) restorePeers() (err error) {
+	path := h.peersPath()
+	pis, err := h.node.LoadPeers(path)
+	if err != nil {
+		h.dht.dlog.Logf("discarding saved peers that couldn't be loaded: %v", err)
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			h.dht.dlog.Logf("error removing saved peers: %v", err)
+		}
+		err = nil
+		return
+	}
+	if len(pis) == 0 {
+		return
+	}
+	h.dht.dlog.Logf("restored %d saved peers", len(pis))
+	node := h.node
+	dlog := h.dht.dlog
+	go func() {
+		for _, pi := range pis {
+			select {
+			case <-node.Process().Closing():
+				return
+			default:
+			}
+			err := node.host.Connect(node.ctx, pi)
+			if err != nil {
+				dlog.Logf("Clearing saved peer %v, connection failed (%v)\n", pi.ID, err)
+				node.peerstore.ClearAddrs(pi.ID)
+				node.routingTable.Remove(pi.ID)
+			}
+		}
+		if !node.routingTable.IsEmpty() {
+			FetchMailTask(h)
+		}
+	}()
+	return
+}
@@ -0,0 +1,128 @@
+package holochain
+
+import (
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadPeers(t *testing.T) {
+	d := SetupTestDir()
+	defer os.RemoveAll(d)
+	path := filepath.Join(d, PeerStoreFileName)
+
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	// evict without pinging so the table doesn't change under us
+	node.routingTable.Ping = nil
+
+	var peers []peer.ID
+	for i := 0; i < 20; i++ {
+		p, _ := makePeer(fmt.Sprintf("peer_%d", i))
+		a, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 5000+i))
+		node.peerstore.AddAddrs(p, []ma.Multiaddr{a}, PeerTTL)
+		node.routingTable.Update(p)
+		peers = append(peers, p)
+	}
+	blocked, _ := makePeer("blocked")
+	a, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/6000")
+	node.peerstore.AddAddrs(blocked, []ma.Multiaddr{a}, PeerTTL)
+	node.Block(blocked)
+
+	var buckets [][]peer.ID
+	for _, b := range node.routingTable.Buckets {
+		buckets = append(buckets, b.Peers())
+	}
+
+	Convey("it should not be an error if there are no saved peers", t, func() {
+		pis, err := node.LoadPeers(path)
+		So(err, ShouldBeNil)
+		So(len(pis), ShouldEqual, 0)
+	})
+
+	Convey("it should save peers and buckets", t, func() {
+		err := node.SavePeers(path)
+		So(err, ShouldBeNil)
+		So(FileExists(path), ShouldBeTrue)
+	})
+	node.Close()
+
+	Convey("it should restore peers and buckets into a new node", t, func() {
+		node2, err := makeNode(1234, "node1")
+		So(err, ShouldBeNil)
+		defer node2.Close()
+		node2.Block(blocked)
+
+		pis, err := node2.LoadPeers(path)
+		So(err, ShouldBeNil)
+		So(len(pis), ShouldEqual, node.routingTable.Size())
+		So(node2.routingTable.Size(), ShouldEqual, node.routingTable.Size())
+		for i, b := range node2.routingTable.Buckets {
+			So(b.Peers(), ShouldResemble, buckets[i])
+		}
+		addrs := node2.peerstore.Addrs(peers[3])
+		So(len(addrs), ShouldEqual, 1)
+		So(addrs[0].String(), ShouldEqual, "/ip4/127.0.0.1/tcp/5003")
+		So(len(node2.peerstore.Addrs(blocked)), ShouldEqual, 0)
+	})
+}
+
+func TestHolochainRestorePeers(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	p, _ := makePeer("peer_1")
+	a, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/5001")
+	err := h.addPeer(pstore.PeerInfo{ID: p, Addrs: []ma.Multiaddr{a}}, false)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("closing should save the peers to the db directory", t, func() {
+		h.Close()
+		So(FileExists(h.DBPath(), PeerStoreFileName), ShouldBeTrue)
+	})
+
+	Convey("activating should restore the saved peers", t, func() {
+		err := h.Prepare()
+		So(err, ShouldBeNil)
+		So(h.node.routingTable.Size(), ShouldEqual, 0)
+		err = h.restorePeers()
+		So(err, ShouldBeNil)
+		So(h.node.routingTable.Find(p), ShouldEqual, p)
+	})
+
+	Convey("the health of the saved routing table should be read from the file alone", t, func() {
+		path := filepath.Join(h.DBPath(), PeerStoreFileName)
+		data := fmt.Sprintf(`{"Version":1,"Peers":[{"ID":"%s","Addrs":["/ip4/127.0.0.1/tcp/5001"]}],"Buckets":[["%s"]]}`, peer.IDB58Encode(p), peer.IDB58Encode(p))
+		err := ioutil.WriteFile(path, []byte(data), 0600)
+		So(err, ShouldBeNil)
+		health, err := h.SavedRoutingTableHealth()
+		So(err, ShouldBeNil)
+		So(health.Size, ShouldEqual, 1)
+	})
+
+	Convey("a saved peers file that can't be loaded should be discarded", t, func() {
+		path := filepath.Join(h.DBPath(), PeerStoreFileName)
+		for _, data := range []string{`{"Version":1,"Peers":[{"ID":"Qm`, `{"Version":99}`, `{"Version":1,"Peers":[{"ID":"bogus"}]}`} {
+			err := ioutil.WriteFile(path, []byte(data), 0600)
+			So(err, ShouldBeNil)
+			err = h.restorePeers()
+			So(err, ShouldBeNil)
+			So(FileExists(h.DBPath(), PeerStoreFileName), ShouldBeFalse)
+		}
+	})
+
+	Convey("saving peers should not fail once closed", t, func() {
+		h.Close()
+		PeerSaveTask(h)
+	})
+}
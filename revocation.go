@@ -2,14 +2,19 @@
 // Use of this source code is governed by GPLv3 found in the LICENSE file
 //----------------------------------------------------------------------------------------
 
-// interface for revoking keys
+// interface for revoking keys, and tracking of revoked keys on the DHT
 
 package holochain
 
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"strings"
+	"time"
 )
 
 type Revocation interface {
@@ -19,13 +24,16 @@ type Revocation interface {
 }
 
 var SelfRevocationDoesNotVerify = errors.New("self revocation does not verify")
+var ErrKeyRevoked = errors.New("header signed by a revoked key after its revocation")
 
 // SelfRevocation holds the old key being revoked and the new key, other revocation data and
 // the two cryptographic signatures of that data by the two keys to confirm the revocation
 type SelfRevocation struct {
-	Data   []byte // concatination of key length, two marshaled keys, and revocation properties
-	OldSig []byte // signature of oldnew by old key
-	NewSig []byte // signature by oldnew new key
+	Data    []byte     // concatination of key length, two marshaled keys, and revocation properties
+	OldSig  []byte     // signature of oldnew by old key
+	NewSig  []byte     // signature by oldnew new key
+	Time    *time.Time `json:",omitempty"` // when the revocation was made, if known
+	TimeSig []byte     `json:",omitempty"` // signature of the data and the time by the new key
 }
 
 func NewSelfRevocation(old, new ic.PrivKey, payload []byte) (rP *SelfRevocation, err error) {
@@ -58,6 +66,24 @@ func NewSelfRevocation(old, new ic.PrivKey, payload []byte) (rP *SelfRevocation,
 	return
 }
 
+// SetTime records when the revocation was made, signed by the new key so that the time
+// can't be changed by whoever passes the revocation on
+func (r *SelfRevocation) SetTime(new ic.PrivKey, at time.Time) (err error) {
+	var sig []byte
+	sig, err = new.Sign(r.timeData(at))
+	if err != nil {
+		return
+	}
+	r.Time = &at
+	r.TimeSig = sig
+	return
+}
+
+// timeData returns what the new key signs to record the time of the revocation
+func (r *SelfRevocation) timeData(at time.Time) []byte {
+	return append(append([]byte{}, r.Data...), at.UTC().Format(time.RFC3339Nano)...)
+}
+
 func (r *SelfRevocation) getOldKey() (key ic.PubKey, err error) {
 	l := int(r.Data[0])
 	bytes := r.Data[1 : l+1]
@@ -110,5 +136,103 @@ func (r *SelfRevocation) Verify() (err error) {
 	if !matches {
 		return SelfRevocationDoesNotVerify
 	}
+	if r.Time != nil {
+		matches, err = newPubKey.Verify(r.timeData(*r.Time), r.TimeSig)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			return SelfRevocationDoesNotVerify
+		}
+	}
+	return
+}
+
+// revokeKey records that the key of the given node was revoked at the given time, and flags
+// the entries already held from that node with the warning status.  Only the first time
+// recorded for a key counts.
+func (dht *DHT) revokeKey(id peer.ID, at time.Time) (err error) {
+	k := peer.IDB58Encode(id)
+	dht.dlog.Logf("revoke key %s at %v", k, at)
+	err = dht.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Get("revoked:" + k)
+		if err == nil {
+			return nil
+		}
+		if err != buntdb.ErrNotFound {
+			return err
+		}
+		_, _, err = tx.Set("revoked:"+k, at.Format(time.RFC3339Nano), nil)
+		if err != nil {
+			return err
+		}
+
+		var held []string
+		err = tx.AscendKeys("src:*", func(key, value string) bool {
+			if value == k {
+				held = append(held, strings.TrimPrefix(key, "src:"))
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, hash := range held {
+			status, err := tx.Get("status:" + hash)
+			if err != nil {
+				return err
+			}
+			if status == StatusLiveVal {
+				_, _, err = tx.Set("status:"+hash, StatusWarningVal, nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// keyRevokedAt returns when the key of the given node was revoked, if it was
+func (dht *DHT) keyRevokedAt(id peer.ID) (at time.Time, revoked bool, err error) {
+	err = dht.db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get("revoked:" + peer.IDB58Encode(id))
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		at, err = time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return fmt.Errorf("bad revocation time for %s: %v", peer.IDB58Encode(id), err)
+		}
+		revoked = true
+		return nil
+	})
+	return
+}
+
+// checkKeyRevocation returns ErrKeyRevoked if the key of any of the sources that signed the
+// header was revoked at or before the header's time, and reports whether any of their keys
+// were revoked after it
+func (dht *DHT) checkKeyRevocation(header *Header, sources []peer.ID) (revokedLater bool, err error) {
+	for _, id := range sources {
+		var at time.Time
+		var revoked bool
+		at, revoked, err = dht.keyRevokedAt(id)
+		if err != nil {
+			return
+		}
+		if !revoked {
+			continue
+		}
+		if !header.Time.Before(at) {
+			err = ErrKeyRevoked
+			return
+		}
+		revokedLater = true
+	}
 	return
 }
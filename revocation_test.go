@@ -2,8 +2,11 @@ package holochain
 
 import (
 	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestSelfRevocationVerify(t *testing.T) {
@@ -44,3 +47,84 @@ func TestSelfRevocationMarshal(t *testing.T) {
 		So(fmt.Sprintf("%v", newr), ShouldEqual, fmt.Sprintf("%v", revocation))
 	})
 }
+
+func TestRevokeKey(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	dht := h.dht
+	revokedPeer, _ := makePeer("peer1")
+	otherPeer, _ := makePeer("peer2")
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	otherHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "someType", hash, revokedPeer, []byte("some value"), StatusLive)
+	dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: otherHash}), "someType", otherHash, otherPeer, []byte("other value"), StatusLive)
+	at := time.Now().Round(0)
+
+	Convey("keys should start out unrevoked", t, func() {
+		_, revoked, err := dht.keyRevokedAt(revokedPeer)
+		So(err, ShouldBeNil)
+		So(revoked, ShouldBeFalse)
+	})
+
+	Convey("it should record the revocation and flag entries held from the key", t, func() {
+		err := dht.revokeKey(revokedPeer, at)
+		So(err, ShouldBeNil)
+		revokedAt, revoked, err := dht.keyRevokedAt(revokedPeer)
+		So(err, ShouldBeNil)
+		So(revoked, ShouldBeTrue)
+		So(revokedAt.Equal(at), ShouldBeTrue)
+
+		data, _, _, status, err := dht.get(hash, StatusDefault, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "some value")
+		So(status, ShouldEqual, StatusWarning)
+		_, _, _, status, err = dht.get(otherHash, StatusDefault, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, StatusLive)
+		_, _, _, _, err = dht.get(hash, StatusLive, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashNotFound)
+		_, _, _, _, err = dht.get(hash, StatusWarning, GetMaskDefault)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should still link on and get the links of flagged entries", t, func() {
+		m := h.node.NewMessage(LINK_REQUEST, LinkReq{Base: hash, Links: otherHash})
+		err := dht.putLink(m, hash.String(), otherHash.String(), "tag")
+		So(err, ShouldBeNil)
+		links, err := dht.getLinks(hash, "tag", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+		So(links[0].H, ShouldEqual, otherHash.String())
+	})
+
+	Convey("it should keep the first revocation time", t, func() {
+		err := dht.revokeKey(revokedPeer, at.Add(time.Hour))
+		So(err, ShouldBeNil)
+		revokedAt, _, _ := dht.keyRevokedAt(revokedPeer)
+		So(revokedAt.Equal(at), ShouldBeTrue)
+	})
+
+	Convey("it should reject headers signed after the revocation and report earlier ones", t, func() {
+		later, err := dht.checkKeyRevocation(&Header{Time: at.Add(-time.Minute)}, []peer.ID{revokedPeer})
+		So(err, ShouldBeNil)
+		So(later, ShouldBeTrue)
+		_, err = dht.checkKeyRevocation(&Header{Time: at}, []peer.ID{revokedPeer})
+		So(err, ShouldEqual, ErrKeyRevoked)
+		_, err = dht.checkKeyRevocation(&Header{Time: at.Add(time.Minute)}, []peer.ID{otherPeer, revokedPeer})
+		So(err, ShouldEqual, ErrKeyRevoked)
+		later, err = dht.checkKeyRevocation(&Header{Time: at.Add(time.Minute)}, []peer.ID{otherPeer})
+		So(err, ShouldBeNil)
+		So(later, ShouldBeFalse)
+	})
+
+	Convey("validation should reject entries signed by a revoked key after its revocation", t, func() {
+		entry := &GobEntry{C: "2"}
+		a := NewPutAction("evenNumbers", entry, &Header{Time: at.Add(time.Minute)})
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{revokedPeer})
+		So(err, ShouldEqual, ErrKeyRevoked)
+		a = NewPutAction("evenNumbers", entry, &Header{Time: at.Add(-time.Minute)})
+		_, err = h.ValidateAction(a, a.entryType, nil, []peer.ID{revokedPeer})
+		So(err, ShouldBeNil)
+	})
+}
@@ -7,6 +7,7 @@
 package holochain
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/metacurrency/holochain/hash"
@@ -47,11 +48,87 @@ const (
 
 var ValidationFailedErr = errors.New("Validation Failed")
 
+// strictValidationErr returns the error for a call to a non-deterministic function during
+// strict validation
+func strictValidationErr(fn string) error {
+	return fmt.Errorf("%s is not allowed in strict validation", fn)
+}
+
+// strictValidation reports whether the DNA asks for validation callbacks to be run in strict mode
+func strictValidation(h *Holochain) bool {
+	return h != nil && h.nucleus != nil && h.nucleus.dna != nil && h.nucleus.dna.StrictValidation
+}
+
 // FunctionDef holds the name and calling type of an DNA exposed function
 type FunctionDef struct {
 	Name        string
 	CallingType string
 	Exposure    string
+	// Interval is the number of milliseconds between scheduled runs of the function, which
+	// the node calls with no arguments once it starts its background tasks.  Zero means
+	// the function isn't scheduled, and otherwise it must be at least MinScheduledInterval.
+	Interval int `json:",omitempty" toml:",omitzero"`
+	// InputSchema and OutputSchema are optional JSON schemas that the function's arguments
+	// and result must match.  In a DNA file they may instead be given as the name of a file
+	// in the zome's directory, which is read into the schema when the DNA is loaded.
+	InputSchema      string `json:",omitempty" toml:",omitempty"`
+	InputSchemaFile  string `json:",omitempty" toml:",omitempty"`
+	OutputSchema     string `json:",omitempty" toml:",omitempty"`
+	OutputSchemaFile string `json:",omitempty" toml:",omitempty"`
+	inputValidator   SchemaValidator
+	outputValidator  SchemaValidator
+}
+
+// FunctionSchemaError is returned when the arguments or result of a call don't match the
+// function's schema
+type FunctionSchemaError struct {
+	Zome     string
+	Function string
+	Which    string // input or output
+	Message  string
+}
+
+func (e *FunctionSchemaError) Error() string {
+	return fmt.Sprintf("%s of %s:%s doesn't match its schema: %s", e.Which, e.Zome, e.Function, e.Message)
+}
+
+// BuildSchemaValidators builds the validators of the function's input and output schemas
+func (f *FunctionDef) BuildSchemaValidators() (err error) {
+	var v *JSONSchemaValidator
+	f.inputValidator, f.outputValidator = nil, nil
+	if f.InputSchema != "" {
+		if v, err = BuildJSONSchemaValidatorFromString(f.InputSchema); err != nil {
+			err = fmt.Errorf("error building input schema validator for %s: %v", f.Name, err)
+			return
+		}
+		f.inputValidator = v
+	}
+	if f.OutputSchema != "" {
+		if v, err = BuildJSONSchemaValidatorFromString(f.OutputSchema); err != nil {
+			err = fmt.Errorf("error building output schema validator for %s: %v", f.Name, err)
+			return
+		}
+		f.outputValidator = v
+	}
+	return
+}
+
+// checkSchema validates the arguments or result of a call of the function.  For JSON
+// calling functions it's their JSON value that must match the schema.
+func (f *FunctionDef) checkSchema(zome string, which string, v SchemaValidator, value interface{}) (err error) {
+	if v == nil {
+		return
+	}
+	input := value
+	if s, ok := value.(string); ok && f.CallingType == JSON_CALLING && s != "" {
+		if err = json.Unmarshal([]byte(s), &input); err != nil {
+			return &FunctionSchemaError{Zome: zome, Function: f.Name, Which: which, Message: "invalid JSON: " + err.Error()}
+		}
+	}
+	if err = v.Validate(input); err != nil {
+		err = &FunctionSchemaError{Zome: zome, Function: f.Name, Which: which, Message: err.Error()}
+	}
+	return
 }
 
 // ValidExposure verifies that the function can be called in the given context
@@ -73,6 +150,10 @@ type Ribosome interface {
 	Call(fn *FunctionDef, params interface{}) (interface{}, error)
 	Run(code string) (result interface{}, err error)
 	RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error)
+	Hook(hook string, args ...string) (err error)
+	// BoolHook runs a callback that answers with a boolean, false if the zome doesn't define it
+	BoolHook(hook string, args ...string) (result bool, err error)
+	Close() error // releases what the ribosome holds outside of memory, e.g. processes
 }
 
 var ribosomeFactories = make(map[string]RibosomeFactory)
@@ -93,10 +174,19 @@ func RegisterRibosome(name string, factory RibosomeFactory) {
 func RegisterBultinRibosomes() {
 	RegisterRibosome(ZygoRibosomeType, NewZygoRibosome)
 	RegisterRibosome(JSRibosomeType, NewJSRibosome)
+	RegisterRibosome(WasmRibosomeType, NewWasmRibosome)
 }
 
 // CreateRibosome returns a new Ribosome of the given type
 func CreateRibosome(h *Holochain, zome *Zome) (Ribosome, error) {
+	if zome.RibosomeType == ExecRibosomeType {
+		// exec zomes aren't registered with the built in types as they only run when the
+		// operator enables them
+		if h == nil || !h.Config.EnableExecZomes {
+			return nil, ErrExecZomesDisabled
+		}
+		return NewExecRibosome(h, zome)
+	}
 
 	factory, ok := ribosomeFactories[zome.RibosomeType]
 	if !ok {
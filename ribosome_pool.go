@@ -0,0 +1,159 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// pooling of initialized ribosomes so that zome code doesn't have to be reloaded on
+// every call
+
+package holochain
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultRibosomePoolSize is the number of idle ribosomes kept per zome when the
+	// config doesn't say otherwise
+	DefaultRibosomePoolSize = 4
+)
+
+// ResettableRibosome is implemented by ribosomes that can be put back into their freshly
+// initialized state after use, which allows them to be pooled
+type ResettableRibosome interface {
+	Ribosome
+	Reset() error
+}
+
+// ribosomePool holds the idle ribosomes of a zome
+type ribosomePool struct {
+	free   chan Ribosome
+	resets sync.WaitGroup // released ribosomes still being reset
+}
+
+// ribosomePools holds the pools of all the zomes of a holochain
+type ribosomePools struct {
+	lk    sync.Mutex
+	pools map[string]*ribosomePool
+}
+
+// ribosomePoolSize returns the configured pool size, where zero means the default and
+// a negative value turns pooling off
+func (config *Config) ribosomePoolSize() int {
+	if config.RibosomePoolSize == 0 {
+		return DefaultRibosomePoolSize
+	}
+	if config.RibosomePoolSize < 0 {
+		return 0
+	}
+	return config.RibosomePoolSize
+}
+
+// ribosomePool returns the pool for a zome, or nil if pooling is off
+func (h *Holochain) ribosomePool(zomeName string) *ribosomePool {
+	size := h.Config.ribosomePoolSize()
+	if size == 0 {
+		return nil
+	}
+	h.ribosomes.lk.Lock()
+	defer h.ribosomes.lk.Unlock()
+	if h.ribosomes.pools == nil {
+		h.ribosomes.pools = make(map[string]*ribosomePool)
+	}
+	p, ok := h.ribosomes.pools[zomeName]
+	if !ok {
+		p = &ribosomePool{free: make(chan Ribosome, size)}
+		h.ribosomes.pools[zomeName] = p
+	}
+	return p
+}
+
+// GetRibosome returns an initialized ribosome for the zome, taking an idle one from the
+// zome's pool if there is one.  The returned release function must be called when the
+// ribosome is no longer in use so that it can be reset and returned to the pool.
+func (h *Holochain) GetRibosome(zomeName string) (r Ribosome, z *Zome, release func(), err error) {
+	z, err = h.GetZome(zomeName)
+	if err != nil {
+		return
+	}
+	p := h.ribosomePool(zomeName)
+	if p != nil {
+		select {
+		case r = <-p.free:
+		default:
+		}
+	}
+	if r == nil {
+		r, err = z.MakeRibosome(h)
+		if err != nil {
+			return
+		}
+	}
+	release = func() { h.releaseRibosome(zomeName, p, r) }
+	return
+}
+
+// releaseRibosome resets a ribosome and returns it to its pool, unless the pool has
+// since been flushed or is full, in which case the ribosome is closed.  Resetting can
+// cost as much as making a new ribosome, e.g. zygo envs are rebuilt and exec processes
+// restarted, so it's done in the background rather than by the caller of release.
+func (h *Holochain) releaseRibosome(zomeName string, p *ribosomePool, r Ribosome) {
+	rr, ok := r.(ResettableRibosome)
+	if !ok || p == nil || !h.isCurrentPool(zomeName, p) {
+		r.Close()
+		return
+	}
+	p.resets.Add(1)
+	go func() {
+		defer p.resets.Done()
+		if err := rr.Reset(); err != nil {
+			h.Debugf("dropping ribosome for %s, reset failed: %v", zomeName, err)
+			r.Close()
+			return
+		}
+		// check the pool is still current while holding the lock so a flush can't miss
+		// the ribosome we return to it
+		h.ribosomes.lk.Lock()
+		pooled := false
+		if h.ribosomes.pools[zomeName] == p {
+			select {
+			case p.free <- r:
+				pooled = true
+			default:
+			}
+		}
+		h.ribosomes.lk.Unlock()
+		if !pooled {
+			r.Close()
+		}
+	}()
+}
+
+// isCurrentPool reports whether the pool is still the zome's pool, i.e. hasn't been flushed
+func (h *Holochain) isCurrentPool(zomeName string, p *ribosomePool) bool {
+	h.ribosomes.lk.Lock()
+	defer h.ribosomes.lk.Unlock()
+	return h.ribosomes.pools[zomeName] == p
+}
+
+// FlushRibosomes closes all pooled ribosomes, which is needed whenever something the
+// ribosomes captured at creation changes, e.g. the agent
+func (h *Holochain) FlushRibosomes() {
+	h.ribosomes.lk.Lock()
+	pools := h.ribosomes.pools
+	h.ribosomes.pools = nil
+	h.ribosomes.lk.Unlock()
+	for _, p := range pools {
+		p.close()
+	}
+}
+
+// close closes the idle ribosomes of a pool
+func (p *ribosomePool) close() {
+	for {
+		select {
+		case r := <-p.free:
+			r.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+)
+
+func TestGetRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should fail if the zome isn't defined in the DNA", t, func() {
+		_, _, _, err := h.GetRibosome("bogusZome")
+		So(err.Error(), ShouldEqual, "unknown zome: bogusZome")
+	})
+
+	Convey("it should reuse released ribosomes", t, func() {
+		r1, z, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(z.Name, ShouldEqual, "jsSampleZome")
+		release()
+		h.ribosomePool("jsSampleZome").resets.Wait()
+		r2, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldEqual, r1)
+
+		// a ribosome in use must not be handed out twice
+		r3, _, release3, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r3, ShouldNotEqual, r2)
+		release()
+		release3()
+	})
+
+	Convey("it should close ribosomes released while their pool is flushed", t, func() {
+		_, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		p := h.ribosomePool("zySampleZome")
+		release()
+		h.FlushRibosomes()
+		p.resets.Wait()
+		So(len(p.free), ShouldEqual, 0)
+	})
+
+	Convey("it should reset the ribosome state on release", t, func() {
+		r, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = r.Run("var poolLeftover = 1")
+		So(err, ShouldBeNil)
+		release()
+		h.ribosomePool("jsSampleZome").resets.Wait()
+		r, _, release, err = h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = r.Run("poolLeftover")
+		So(err, ShouldNotBeNil)
+		release()
+	})
+
+	Convey("it should reset zygo definitions on release", t, func() {
+		r, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = r.Run("(def poolLeftover 1)")
+		So(err, ShouldBeNil)
+		release()
+		h.ribosomePool("zySampleZome").resets.Wait()
+		r, _, release, err = h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = r.Run("poolLeftover")
+		So(err, ShouldNotBeNil)
+		release()
+	})
+
+	Convey("it should close the ribosomes it drops", t, func() {
+		h.Config.RibosomePoolSize = 1
+		h.Config.EnableExecZomes = true
+		defer func() {
+			h.Config.RibosomePoolSize = 0
+			h.Config.EnableExecZomes = false
+		}()
+		zomes := h.nucleus.dna.Zomes
+		h.nucleus.dna.Zomes = append(zomes, Zome{Name: "execZome", RibosomeType: ExecRibosomeType, Code: execTestZomeCode})
+		defer func() { h.nucleus.dna.Zomes = zomes }()
+
+		r1, _, release1, err := h.GetRibosome("execZome")
+		So(err, ShouldBeNil)
+		r2, _, release2, err := h.GetRibosome("execZome")
+		So(err, ShouldBeNil)
+		release1()
+		release2()
+		h.ribosomePool("execZome").resets.Wait()
+		// the pool only has room for whichever was reset first
+		_, err1 := os.Stat(r1.(*ExecRibosome).file)
+		_, err2 := os.Stat(r2.(*ExecRibosome).file)
+		So(os.IsNotExist(err1) != os.IsNotExist(err2), ShouldBeTrue)
+
+		h.FlushRibosomes()
+		_, err1 = os.Stat(r1.(*ExecRibosome).file)
+		_, err2 = os.Stat(r2.(*ExecRibosome).file)
+		So(os.IsNotExist(err1) && os.IsNotExist(err2), ShouldBeTrue)
+	})
+
+	Convey("it should drop pooled ribosomes on flush", t, func() {
+		r1, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		release()
+		h.ribosomePool("zySampleZome").resets.Wait()
+		h.FlushRibosomes()
+		r2, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldNotEqual, r1)
+		release()
+	})
+
+	Convey("it should not pool when the pool size is negative", t, func() {
+		h.Config.RibosomePoolSize = -1
+		defer func() { h.Config.RibosomePoolSize = 0 }()
+		r1, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		release()
+		r2, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldNotEqual, r1)
+		release()
+	})
+}
@@ -31,3 +31,47 @@ func TestValidExposure(t *testing.T) {
 		So(fn.ValidExposure(ZOME_EXPOSURE), ShouldBeTrue)
 	})
 }
+
+func TestFunctionSchemas(t *testing.T) {
+	fn := FunctionDef{Name: "double", CallingType: JSON_CALLING,
+		InputSchema:  `{"type":"object","properties":{"input":{"type":"integer"}},"required":["input"]}`,
+		OutputSchema: `{"type":"object","properties":{"output":{"type":"integer","maximum":10}}}`,
+	}
+	err := fn.BuildSchemaValidators()
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should accept values that match the schemas", t, func() {
+		So(fn.checkSchema("z", "input", fn.inputValidator, `{"input":2}`), ShouldBeNil)
+		So(fn.checkSchema("z", "output", fn.outputValidator, `{"input":2,"output":4}`), ShouldBeNil)
+	})
+
+	Convey("it should return schema errors for values that don't match", t, func() {
+		err := fn.checkSchema("z", "input", fn.inputValidator, `{"input":"two"}`)
+		se, ok := err.(*FunctionSchemaError)
+		So(ok, ShouldBeTrue)
+		So(se.Zome, ShouldEqual, "z")
+		So(se.Function, ShouldEqual, "double")
+		So(se.Which, ShouldEqual, "input")
+		So(err.Error(), ShouldStartWith, "input of z:double doesn't match its schema: ")
+
+		err = fn.checkSchema("z", "output", fn.outputValidator, `{"output":12}`)
+		So(err.(*FunctionSchemaError).Which, ShouldEqual, "output")
+
+		err = fn.checkSchema("z", "input", fn.inputValidator, `{input:2}`)
+		So(err.(*FunctionSchemaError).Message, ShouldStartWith, "invalid JSON: ")
+	})
+
+	Convey("string calling functions should have their strings validated", t, func() {
+		f := FunctionDef{Name: "lang", CallingType: STRING_CALLING, InputSchema: `{"type":"string","enum":["language"]}`}
+		So(f.BuildSchemaValidators(), ShouldBeNil)
+		So(f.checkSchema("z", "input", f.inputValidator, "language"), ShouldBeNil)
+		So(f.checkSchema("z", "input", f.inputValidator, "fish"), ShouldNotBeNil)
+	})
+
+	Convey("it should report bad schemas", t, func() {
+		f := FunctionDef{Name: "bad", InputSchema: `{"type":`}
+		So(f.BuildSchemaValidators().Error(), ShouldStartWith, "error building input schema validator for bad: ")
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// scheduled zome functions, which the node runs periodically on task tickers alongside
+// gossip and retry
+
+package holochain
+
+import (
+	"time"
+)
+
+const (
+	// MinScheduledInterval is the shortest interval in milliseconds a DNA may schedule a
+	// function at, so a zome can't keep the node busy running it
+	MinScheduledInterval = 1000
+)
+
+// ScheduledTask returns the task that runs a zome's scheduled function.  As each scheduled
+// function gets a ticker of its own, which runs the task synchronously, a run that takes
+// longer than the interval delays the next one rather than overlapping it.
+func ScheduledTask(zome string, function string) func(h *Holochain) {
+	return func(h *Holochain) {
+		// scheduled functions get no arguments, which for JSON calling is an empty object
+		args := ""
+		if z, err := h.GetZome(zome); err == nil {
+			if fn, err := z.GetFunctionDef(function); err == nil && fn.CallingType == JSON_CALLING {
+				args = "{}"
+			}
+		}
+		start := time.Now()
+		_, err := h.Call(zome, function, args, ZOME_EXPOSURE)
+		if err != nil {
+			h.Config.Loggers.App.Logf("scheduled %s:%s failed: %v", zome, function, err)
+			return
+		}
+		h.Config.Loggers.App.Logf("scheduled %s:%s ran in %v", zome, function, time.Since(start))
+	}
+}
+
+// startScheduledTasks starts a ticker for each of the DNA's scheduled functions
+func (h *Holochain) startScheduledTasks() {
+	for _, z := range h.nucleus.dna.Zomes {
+		for _, f := range z.Functions {
+			if f.Interval > 0 {
+				interval := time.Duration(f.Interval) * time.Millisecond
+				h.Debugf("Scheduling %s:%s every %v", z.Name, f.Name, interval)
+				h.node.scheduling = append(h.node.scheduling, h.TaskTicker(interval, ScheduledTask(z.Name, f.Name)))
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestScheduledTask(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should log runs of a scheduled function to the app logger", t, func() {
+		ShouldLog(&h.Config.Loggers.App, "scheduled jsSampleZome:testStrFn1 ran in ", func() {
+			ScheduledTask("jsSampleZome", "testStrFn1")(h)
+		})
+	})
+
+	Convey("it should pass JSON calling functions an empty object", t, func() {
+		ShouldLog(&h.Config.Loggers.App, "scheduled zySampleZome:testJsonFn2 ran in ", func() {
+			ScheduledTask("zySampleZome", "testJsonFn2")(h)
+		})
+	})
+
+	Convey("it should log failed runs to the app logger", t, func() {
+		ShouldLog(&h.Config.Loggers.App, "scheduled jsSampleZome:noSuchFn failed: ", func() {
+			ScheduledTask("jsSampleZome", "noSuchFn")(h)
+		})
+	})
+}
+
+func TestStartScheduledTasks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should start a ticker for each scheduled function", t, func() {
+		So(len(h.node.scheduling), ShouldEqual, 0)
+		for i, z := range h.nucleus.dna.Zomes {
+			if z.Name == "jsSampleZome" {
+				for j, f := range z.Functions {
+					if f.Name == "testStrFn1" {
+						h.nucleus.dna.Zomes[i].Functions[j].Interval = 60000
+					}
+				}
+			}
+		}
+		h.startScheduledTasks()
+		So(len(h.node.scheduling), ShouldEqual, 1)
+	})
+}
@@ -42,6 +42,7 @@ const (
 	DNAHashFileName      string = "dna.hash"    // Filename for storing the hash of the holochain
 	DHTStoreFileName     string = "dht.db"      // Filname for storing the dht
 	BridgeDBFileName     string = "bridge.db"   // Filname for storing bridge keys
+	PeerStoreFileName    string = "peers.json"  // Filename for storing known peers and routing table
 
 	TestConfigFileName string = "_config.json"
 
@@ -118,7 +119,10 @@ type DNAFile struct {
 	Zomes                []ZomeFile
 	RequiresVersion      int
 	DHTConfig            DHTConfig
+	ExecutionLimits      *ExecutionLimits `json:",omitempty"`
+	StrictValidation     bool             `json:",omitempty" toml:",omitempty"`
 	Progenitor           Progenitor
+	LibraryDir           string // directory of JS modules shared by the zomes, DefaultLibraryDir if not set
 }
 
 // AgentFixture defines an agent for the purposes of tests
@@ -356,6 +360,8 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 	dna.BasedOn = dnaFile.BasedOn
 	dna.RequiresVersion = dnaFile.RequiresVersion
 	dna.DHTConfig = dnaFile.DHTConfig
+	dna.ExecutionLimits = dnaFile.ExecutionLimits
+	dna.StrictValidation = dnaFile.StrictValidation
 	dna.Progenitor = dnaFile.Progenitor
 	dna.Properties = dnaFile.Properties
 	dna.PropertiesSchema = string(propertiesSchema)
@@ -366,6 +372,9 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		err = fmt.Errorf("dna failed check with: %v", err)
 		return
 	}
+	if err = dna.validateProperties(nil); err != nil {
+		return
+	}
 
 	dna.Zomes = make([]Zome, len(dnaFile.Zomes))
 	for i, zome := range dnaFile.Zomes {
@@ -376,6 +385,8 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 				ext = ".js"
 			case "zygo":
 				ext = ".zy"
+			case "wasm":
+				ext = ".wasm"
 			}
 			dnaFile.Zomes[i].CodeFile = zome.Name + ext
 		}
@@ -390,6 +401,18 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		dna.Zomes[i].Description = zome.Description
 		dna.Zomes[i].RibosomeType = zome.RibosomeType
 		dna.Zomes[i].Functions = zome.Functions
+		for j := range dna.Zomes[i].Functions {
+			if err = loadFunctionSchemas(&dna.Zomes[i].Functions[j], zomePath); err != nil {
+				return
+			}
+			if interval := dna.Zomes[i].Functions[j].Interval; interval < 0 {
+				err = fmt.Errorf("function %s of zome %s has a negative interval", zome.Functions[j].Name, zome.Name)
+				return
+			} else if interval > 0 && interval < MinScheduledInterval {
+				err = fmt.Errorf("function %s of zome %s has an interval under the minimum of %dms", zome.Functions[j].Name, zome.Name, MinScheduledInterval)
+				return
+			}
+		}
 		dna.Zomes[i].BridgeFuncs = zome.BridgeFuncs
 		if zome.BridgeTo != "" {
 			dna.Zomes[i].BridgeTo, err = NewHash(zome.BridgeTo)
@@ -423,7 +446,22 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		if err != nil {
 			return
 		}
-		dna.Zomes[i].Code = string(code[:])
+		if zome.RibosomeType == WasmRibosomeType {
+			// keep the binary module safe in text encodings of the DNA
+			dna.Zomes[i].Code = base64.StdEncoding.EncodeToString(code)
+		} else {
+			dna.Zomes[i].Code = string(code[:])
+		}
+		if zome.RibosomeType == JSRibosomeType {
+			libDir := dnaFile.LibraryDir
+			if libDir == "" {
+				libDir = DefaultLibraryDir
+			}
+			err = loadJSModules(&dna, &dna.Zomes[i], zomePath, filepath.Join(path, libDir))
+			if err != nil {
+				return
+			}
+		}
 
 		dna.Zomes[i].Entries = make([]EntryDef, len(zome.Entries))
 		for j, entry := range zome.Entries {
@@ -456,6 +494,27 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 	return
 }
 
+// loadFunctionSchemas reads any schema files of a function and builds its validators
+func loadFunctionSchemas(f *FunctionDef, zomePath string) (err error) {
+	var schema []byte
+	if f.InputSchemaFile != "" {
+		if schema, err = ReadFile(zomePath, f.InputSchemaFile); err != nil {
+			err = fmt.Errorf("error reading input schema file of %s: %v", f.Name, err)
+			return
+		}
+		f.InputSchema, f.InputSchemaFile = string(schema), ""
+	}
+	if f.OutputSchemaFile != "" {
+		if schema, err = ReadFile(zomePath, f.OutputSchemaFile); err != nil {
+			err = fmt.Errorf("error reading output schema file of %s: %v", f.Name, err)
+			return
+		}
+		f.OutputSchema, f.OutputSchemaFile = string(schema), ""
+	}
+	err = f.BuildSchemaValidators()
+	return
+}
+
 // load unmarshals a holochain structure for the named chain and format
 func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 	var h Holochain
@@ -480,6 +539,9 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 	if err != nil {
 		return
 	}
+	if err = dna.validateProperties(h.Config.InstanceProperties); err != nil {
+		return
+	}
 
 	h.encodingFormat = format
 	h.rootPath = root
@@ -579,6 +641,8 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 		suffix = ".js"
 	case ZygoRibosomeType:
 		suffix = ".zy"
+	case WasmRibosomeType:
+		suffix = ".wasm"
 	default:
 	}
 	return
@@ -929,22 +993,29 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 	defer f.Close()
 
 	dnaFile := DNAFile{
-		Version:              dna.Version,
-		UUID:                 dna.UUID,
-		Name:                 dna.Name,
-		Properties:           dna.Properties,
-		PropertiesSchemaFile: "properties_schema.json",
-		BasedOn:              dna.BasedOn,
-		RequiresVersion:      dna.RequiresVersion,
-		DHTConfig:            dna.DHTConfig,
-		Progenitor:           dna.Progenitor,
+		Version:          dna.Version,
+		UUID:             dna.UUID,
+		Name:             dna.Name,
+		Properties:       dna.Properties,
+		BasedOn:          dna.BasedOn,
+		RequiresVersion:  dna.RequiresVersion,
+		DHTConfig:        dna.DHTConfig,
+		ExecutionLimits:  dna.ExecutionLimits,
+		StrictValidation: dna.StrictValidation,
+		Progenitor:       dna.Progenitor,
 	}
 	for _, z := range dna.Zomes {
 		zpath := filepath.Join(dnaPath, z.Name)
 		if err = os.MkdirAll(zpath, os.ModePerm); err != nil {
 			return
 		}
-		if err = WriteFile([]byte(z.Code), zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
+		code := []byte(z.Code)
+		if z.RibosomeType == WasmRibosomeType {
+			if code, err = base64.StdEncoding.DecodeString(z.Code); err != nil {
+				return
+			}
+		}
+		if err = WriteFile(code, zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
 			return
 		}
 
@@ -974,9 +1045,13 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		}
 		dnaFile.Zomes = append(dnaFile.Zomes, zomeFile)
 	}
+	if err = saveJSModules(dna, dnaPath); err != nil {
+		return
+	}
 
 	if dna.PropertiesSchema != "" {
-		if err = WriteFile([]byte(dna.PropertiesSchema), dnaPath, "properties_schema.json"); err != nil {
+		dnaFile.PropertiesSchemaFile = "properties_schema.json"
+		if err = WriteFile([]byte(dna.PropertiesSchema), dnaPath, dnaFile.PropertiesSchemaFile); err != nil {
 			return
 		}
 	}
@@ -1711,6 +1786,7 @@ function validate(entry_type,entry,header,sources) {
   return false
 }
 function validateLink(linkEntryType,baseHash,linkHash,tag,pkg,sources){return true}
+function onCountersignProposal(proposer,entry_type,entry) {return entry_type=="oddNumbers" && entry!="13"}
 function validatePutPkg(entry_type) {
   req = {};
   req[HC.PkgReq.Chain]=HC.PkgReq.ChainOpt.Full;
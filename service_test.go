@@ -539,3 +539,77 @@ func TestGetScenarioData(t *testing.T) {
 		So(fmt.Sprintf("%v", scenarios), ShouldEqual, `[listener speaker]`)
 	})
 }
+
+func TestLoadFunctionSchemas(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	WriteFile([]byte(`{"type":"string"}`), d, "in.json")
+
+	Convey("it should read schema files into the function def", t, func() {
+		f := FunctionDef{Name: "fn", InputSchemaFile: "in.json", OutputSchema: `{"type":"string"}`}
+		err := loadFunctionSchemas(&f, d)
+		So(err, ShouldBeNil)
+		So(f.InputSchema, ShouldEqual, `{"type":"string"}`)
+		So(f.InputSchemaFile, ShouldEqual, "")
+		So(f.inputValidator, ShouldNotBeNil)
+		So(f.outputValidator, ShouldNotBeNil)
+	})
+
+	Convey("it should fail on missing schema files", t, func() {
+		f := FunctionDef{Name: "fn", OutputSchemaFile: "out.json"}
+		err := loadFunctionSchemas(&f, d)
+		So(err.Error(), ShouldStartWith, "error reading output schema file of fn: ")
+	})
+}
+
+func TestLoadDNAPropertiesSchema(t *testing.T) {
+	d, s, h := SetupTestChain("test")
+	defer CleanupTestChain(h, d)
+	dnaPath := h.DNAPath()
+
+	Convey("it should fail to load a chain whose instance properties don't match the schema", t, func() {
+		os.Remove(filepath.Join(dnaPath, "properties_schema.json"))
+		WriteFile([]byte(`{"type":"object","properties":{"language":{"enum":["en","fr"]}}}`), dnaPath, "properties_schema.json")
+		config := h.Config
+		config.InstanceProperties = map[string]string{"language": "klingon"}
+		f, err := os.Create(filepath.Join(h.rootPath, ConfigFileName+"."+h.encodingFormat))
+		So(err, ShouldBeNil)
+		err = Encode(f, h.encodingFormat, &config)
+		f.Close()
+		So(err, ShouldBeNil)
+		_, err = s.Load("test")
+		So(err.Error(), ShouldStartWith, "properties don't match the properties schema: ")
+	})
+
+	Convey("it should fail to load a DNA whose properties don't match its schema", t, func() {
+		os.Remove(filepath.Join(dnaPath, "properties_schema.json"))
+		WriteFile([]byte(`{"type":"object","required":["missing"]}`), dnaPath, "properties_schema.json")
+		_, err := s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err.Error(), ShouldStartWith, "properties don't match the properties schema: ")
+	})
+}
+
+func TestLoadDNAIntervals(t *testing.T) {
+	d, s, h := SetupTestChain("test")
+	defer CleanupTestChain(h, d)
+	dnaPath := h.DNAPath()
+
+	Convey("it should fail to load a DNA that schedules a function under the minimum interval", t, func() {
+		var dnaFile DNAFile
+		path := filepath.Join(dnaPath, DNAFileName+"."+h.encodingFormat)
+		f, err := os.Open(path)
+		So(err, ShouldBeNil)
+		err = Decode(f, h.encodingFormat, &dnaFile)
+		f.Close()
+		So(err, ShouldBeNil)
+		dnaFile.Zomes[0].Functions[0].Interval = MinScheduledInterval - 1
+		f, err = os.Create(path)
+		So(err, ShouldBeNil)
+		err = Encode(f, h.encodingFormat, &dnaFile)
+		f.Close()
+		So(err, ShouldBeNil)
+
+		_, err = s.loadDNA(dnaPath, DNAFileName, h.encodingFormat)
+		So(err.Error(), ShouldEndWith, fmt.Sprintf("has an interval under the minimum of %dms", MinScheduledInterval))
+	})
+}
@@ -8,7 +8,7 @@ package ui
 
 import (
 	"context"
-	_ "encoding/json"
+	"encoding/json"
 	"errors"
 	"fmt"
 	websocket "github.com/gorilla/websocket"
@@ -17,15 +17,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 )
 
 type WebServer struct {
-	h      *holo.Holochain
-	port   string
-	log    holo.Logger
-	errs   holo.Logger
-	stop   chan bool
-	server *http.Server
+	h       *holo.Holochain
+	port    string
+	log     holo.Logger
+	errs    holo.Logger
+	stop    chan bool
+	closing chan struct{} // closed on shutdown to end the event streams
+	server  *http.Server
 }
 
 func NewWebServer(h *holo.Holochain, port string) *WebServer {
@@ -33,9 +35,38 @@ func NewWebServer(h *holo.Holochain, port string) *WebServer {
 	w.log = holo.Logger{Format: "%{color:magenta}%{message}"}
 	w.errs = holo.Logger{Format: "%{color:red}%{time} %{message}", Enabled: true}
 	w.stop = make(chan bool, 1)
+	w.closing = make(chan struct{})
 	return &w
 }
 
+// subscriptions holds the names of the events a websocket client subscribed to
+type subscriptions struct {
+	lk    sync.Mutex
+	names map[string]bool
+}
+
+func (s *subscriptions) set(name string, subscribed bool) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if subscribed {
+		s.names[name] = true
+	} else {
+		delete(s.names, name)
+	}
+}
+
+func (s *subscriptions) has(name string) bool {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.names[name]
+}
+
+// eventJSON returns the JSON that an event is pushed to clients as
+func eventJSON(e holo.AppEvent) []byte {
+	b, _ := json.Marshal(map[string]string{"event": e.Name, "zome": e.Zome, "payload": e.Payload})
+	return b
+}
+
 //Start starts up a web server and returns a channel which will shutdown
 func (ws *WebServer) Start() {
 
@@ -60,6 +91,27 @@ func (ws *WebServer) Start() {
 			return
 		}
 
+		// events are pushed from their own go routine, so writes to the connection
+		// have to take turns
+		var wlk sync.Mutex
+		write := func(data []byte) error {
+			wlk.Lock()
+			defer wlk.Unlock()
+			return conn.WriteMessage(websocket.TextMessage, data)
+		}
+		subs := subscriptions{names: make(map[string]bool)}
+		events, unsubscribe := ws.h.SubscribeEvents()
+		defer unsubscribe()
+		go func() {
+			for e := range events {
+				if subs.has(e.Name) {
+					if err := write(eventJSON(e)); err != nil {
+						ws.errs.Log(err)
+					}
+				}
+			}
+		}()
+
 		for {
 			var v map[string]string
 			err := conn.ReadJSON(&v)
@@ -70,14 +122,22 @@ func (ws *WebServer) Start() {
 				ws.errs.Log(err)
 				return
 			}
+			if name, ok := v["subscribe"]; ok {
+				subs.set(name, true)
+				continue
+			}
+			if name, ok := v["unsubscribe"]; ok {
+				subs.set(name, false)
+				continue
+			}
 			zome := v["zome"]
 			function := v["fn"]
 			result, err := ws.call(zome, function, v["arg"])
 			switch t := result.(type) {
 			case string:
-				err = conn.WriteMessage(websocket.TextMessage, []byte(t))
+				err = write([]byte(t))
 			case []byte:
-				err = conn.WriteMessage(websocket.TextMessage, t)
+				err = write(t)
 				//err = conn.WriteJSON(t)
 			default:
 				err = fmt.Errorf("Unknown type from Call of %s:%s", zome, function)
@@ -90,6 +150,52 @@ func (ws *WebServer) Start() {
 		}
 	})
 
+	// server-sent events of the names given by event parameters, or of all names if none
+	mux.HandleFunc("/_events/", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", 500)
+			return
+		}
+		names := make(map[string]bool)
+		for _, name := range r.URL.Query()["event"] {
+			names[name] = true
+		}
+		events, unsubscribe := ws.h.SubscribeEvents()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(200)
+		flusher.Flush()
+		for {
+			select {
+			case e := <-events:
+				if len(names) > 0 && !names[e.Name] {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", sseEventName.Replace(e.Name), eventJSON(e))
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-ws.closing:
+				return
+			}
+		}
+	})
+
+	// the state of the running node, for diagnostics
+	mux.HandleFunc("/_status", func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]interface{}{
+			"Name":         ws.h.Name(),
+			"DNAHash":      ws.h.DNAHash().String(),
+			"NodeID":       ws.h.NodeIDStr(),
+			"RoutingTable": ws.h.Node().RoutingTableHealth(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+
 	mux.HandleFunc("/fn/", func(w http.ResponseWriter, r *http.Request) {
 
 		var err error
@@ -125,8 +231,10 @@ func (ws *WebServer) Start() {
 		result, err := ws.call(zome, function, args)
 		if err != nil {
 			ws.log.Logf("call of %s:%s resulted in error: %v\n", zome, function, err)
-			http.Error(w, err.Error(), 500)
-
+			if !schemaError(w, err) {
+				http.Error(w, err.Error(), 500)
+			}
+			err = nil
 			return
 		}
 		ws.log.Logf(" result: %v\n", result)
@@ -172,6 +280,10 @@ func (ws *WebServer) Start() {
 		result, err := ws.h.BridgeCall(zome, function, args, token)
 		if err != nil {
 			ws.log.Logf("call of %s:%s resulted in error: %v\n", zome, function, err)
+			if schemaError(w, err) {
+				err = nil
+				return
+			}
 			errCode, err = mkErr(err.Error(), 400)
 			return
 		}
@@ -213,11 +325,40 @@ func (ws *WebServer) Stop() {
 func (ws *WebServer) Wait() {
 	<-ws.stop
 	if ws.server != nil {
+		// the event streams never go idle so end them, otherwise Shutdown waits forever
+		close(ws.closing)
 		ws.server.Shutdown(context.Background())
 		ws.server = nil
 	}
 }
 
+// schemaError writes a function schema error as a JSON response, returning false if the
+// error is some other kind.  Input that doesn't match is a bad request, while output that
+// doesn't match is the app's fault.
+func schemaError(w http.ResponseWriter, err error) bool {
+	se, ok := err.(*holo.FunctionSchemaError)
+	if !ok {
+		return false
+	}
+	code := 400
+	if se.Which == "output" {
+		code = 500
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    se.Error(),
+		"zome":     se.Zome,
+		"function": se.Function,
+		"which":    se.Which,
+		"message":  se.Message,
+	})
+	return true
+}
+
+// sseEventName makes an event name safe for the event field of a server-sent event
+var sseEventName = strings.NewReplacer("\r", " ", "\n", " ")
+
 func mkErr(etext string, code int) (int, error) {
 	return code, errors.New(etext)
 }
@@ -226,9 +367,5 @@ func (ws *WebServer) call(zome string, function string, args string) (result int
 
 	ws.log.Logf("calling %s:%s(%s)\n", zome, function, args)
 	result, err = ws.h.Call(zome, function, args, holo.PUBLIC_EXPOSURE)
-
-	if err != nil {
-		_, err = mkErr(err.Error(), 400)
-	}
 	return
 }
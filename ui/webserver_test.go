@@ -1,7 +1,10 @@
 package ui
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	websocket "github.com/gorilla/websocket"
 	. "github.com/metacurrency/holochain"
 	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
@@ -34,6 +37,20 @@ func TestWebServer(t *testing.T) {
 		So(string(b), ShouldEqual, SampleHTML)
 	})
 
+	Convey("it should return the node's status", t, func() {
+		resp, err := http.Get("http://0.0.0.0:31415/_status")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var status struct {
+			NodeID       string
+			RoutingTable RoutingTableHealth
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		So(err, ShouldBeNil)
+		So(status.NodeID, ShouldEqual, h.NodeIDStr())
+		So(len(status.RoutingTable.Buckets), ShouldBeGreaterThan, 0)
+	})
+
 	Convey("it should should fail on bad function calls", t, func() {
 		resp, err := http.Get("http://0.0.0.0:31415/fn/bogus")
 		So(err, ShouldBeNil)
@@ -79,6 +96,104 @@ func TestWebServer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(string(b), ShouldEqual, "en")
 	})
+	Convey("it should return schema errors as bad requests", t, func() {
+		var fn *FunctionDef
+		dna := h.Nucleus().DNA()
+		for i := range dna.Zomes {
+			for j := range dna.Zomes[i].Functions {
+				if dna.Zomes[i].Name == "jsSampleZome" && dna.Zomes[i].Functions[j].Name == "getProperty" {
+					fn = &dna.Zomes[i].Functions[j]
+				}
+			}
+		}
+		fn.InputSchema = `{"type":"string","enum":["language"]}`
+		defer func() { fn.InputSchema = "" }()
+
+		body := bytes.NewBuffer([]byte("fish"))
+		resp, err := http.Post("http://0.0.0.0:31415/fn/jsSampleZome/getProperty", "", body)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/json")
+		var e map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		So(err, ShouldBeNil)
+		So(e["zome"], ShouldEqual, "jsSampleZome")
+		So(e["function"], ShouldEqual, "getProperty")
+		So(e["which"], ShouldEqual, "input")
+		So(e["error"], ShouldStartWith, "input of jsSampleZome:getProperty doesn't match its schema: ")
+
+		body = bytes.NewBuffer([]byte("fish"))
+		resp, err = http.Post("http://0.0.0.0:31415/bridge/"+token+"/jsSampleZome/getProperty", "", body)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		So(err, ShouldBeNil)
+		So(e["which"], ShouldEqual, "input")
+	})
+	Convey("it should return output schema errors as server errors", t, func() {
+		var fn *FunctionDef
+		dna := h.Nucleus().DNA()
+		for i := range dna.Zomes {
+			for j := range dna.Zomes[i].Functions {
+				if dna.Zomes[i].Name == "jsSampleZome" && dna.Zomes[i].Functions[j].Name == "getProperty" {
+					fn = &dna.Zomes[i].Functions[j]
+				}
+			}
+		}
+		fn.OutputSchema = `{"type":"string","enum":["fr"]}`
+		defer func() {
+			fn.OutputSchema = ""
+			fn.BuildSchemaValidators()
+		}()
+
+		body := bytes.NewBuffer([]byte("language"))
+		resp, err := http.Post("http://0.0.0.0:31415/fn/jsSampleZome/getProperty", "", body)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 500)
+		var e map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		So(err, ShouldBeNil)
+		So(e["which"], ShouldEqual, "output")
+	})
+
+	Convey("it should push subscribed events to websocket clients", t, func() {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:31415/_sock/", nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.WriteJSON(map[string]string{"subscribe": "fish"}), ShouldBeNil)
+		// the socket handles messages in order, so once a call returns the subscription is set
+		So(conn.WriteJSON(map[string]string{"zome": "jsSampleZome", "fn": "getProperty", "arg": "language"}), ShouldBeNil)
+		_, b, err := conn.ReadMessage()
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "en")
+
+		h.EmitEvent(AppEvent{Name: "cow", Zome: "jsSampleZome", Payload: "moo"})
+		h.EmitEvent(AppEvent{Name: "fish", Zome: "jsSampleZome", Payload: `{"fins":2}`})
+		_, b, err = conn.ReadMessage()
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"event":"fish","payload":"{\"fins\":2}","zome":"jsSampleZome"}`)
+	})
+
+	Convey("it should stream events to server-sent event clients", t, func() {
+		resp, err := http.Get("http://0.0.0.0:31415/_events/?event=fish")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+		h.EmitEvent(AppEvent{Name: "cow", Zome: "jsSampleZome", Payload: "moo"})
+		h.EmitEvent(AppEvent{Name: "fish", Zome: "jsSampleZome", Payload: "blub"})
+		r := bufio.NewReader(resp.Body)
+		line, err := r.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "event: fish\n")
+		line, err = r.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, `data: {"event":"fish","payload":"blub","zome":"jsSampleZome"}`+"\n")
+	})
+
 	ws.Stop()
 	ws.Wait()
 }
@@ -7,14 +7,19 @@
 package holochain
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
+	"time"
 )
 
 const (
 	SelfRevocationType = iota
+	CountersignType
+	InvalidEntryType
 )
 
 // Warrant abstracts the notion of a multi-party cryptographically verifiable signed claim
@@ -62,6 +67,12 @@ func DecodeWarrant(warrantType int, data []byte) (w Warrant, err error) {
 	case SelfRevocationType:
 		w = &SelfRevocationWarrant{}
 		err = w.Decode(data)
+	case CountersignType:
+		w = &CountersignWarrant{}
+		err = w.Decode(data)
+	case InvalidEntryType:
+		w = &InvalidEntryWarrant{}
+		err = w.Decode(data)
 	default:
 		err = UnknownWarrantTypeErr
 	}
@@ -141,6 +152,15 @@ func (w *SelfRevocationWarrant) Property(key string) (value interface{}, err err
 		value = data[l*2+1 : len(data)]
 		return
 	}
+	if key == "time" {
+		// zero if the revocation doesn't say when it was made
+		var at time.Time
+		if w.Revocation.Time != nil {
+			at = *w.Revocation.Time
+		}
+		value = at
+		return
+	}
 	err = WarrantPropertyNotFoundErr
 	return
 }
@@ -154,3 +174,285 @@ func (w *SelfRevocationWarrant) Decode(data []byte) (err error) {
 	err = w.Revocation.Unmarshal(data)
 	return
 }
+
+var CountersignDoesNotVerify = errors.New("countersignature does not verify")
+var ErrCountersignKeyRevoked = errors.New("countersignature signed with a revoked key")
+
+// CountersignWarrant warrants that all of its parties signed an entry together
+type CountersignWarrant struct {
+	EntryType string
+	EntryHash string
+	Signers   []string // node ids of the parties, the proposer first
+	Keys      [][]byte // marshaled public keys of the parties
+	Sigs      [][]byte // signatures of the parties
+}
+
+// countersignData returns what each party of a countersigned entry signs
+func countersignData(entryType string, entryHash string, parties []string) (data []byte, err error) {
+	data, err = json.Marshal(struct {
+		EntryType string
+		EntryHash string
+		Parties   []string
+	}{entryType, entryHash, parties})
+	return
+}
+
+// sign adds a party's signature to the warrant
+func (w *CountersignWarrant) sign(priv ic.PrivKey) (err error) {
+	var data, key, sig []byte
+	data, err = countersignData(w.EntryType, w.EntryHash, w.Signers)
+	if err != nil {
+		return
+	}
+	key, err = ic.MarshalPublicKey(priv.GetPublic())
+	if err != nil {
+		return
+	}
+	sig, err = priv.Sign(data)
+	if err != nil {
+		return
+	}
+	w.Keys = append(w.Keys, key)
+	w.Sigs = append(w.Sigs, sig)
+	return
+}
+
+func (w *CountersignWarrant) Type() int {
+	return CountersignType
+}
+
+func (w *CountersignWarrant) Parties() (parties []Hash, err error) {
+	for _, p := range w.Signers {
+		var party Hash
+		party, err = NewHash(p)
+		if err != nil {
+			return
+		}
+		parties = append(parties, party)
+	}
+	return
+}
+
+// Verify checks that every party signed the entry with the key of its node id, and that
+// none of those keys are known to be revoked.  The warrant has no time of its own, so a key
+// revoked at any time voids it.
+func (w *CountersignWarrant) Verify(h *Holochain) (err error) {
+	if len(w.Signers) < 2 {
+		err = errors.New("countersignature needs at least two parties")
+		return
+	}
+	if len(w.Keys) != len(w.Signers) || len(w.Sigs) != len(w.Signers) {
+		err = errors.New("countersignature is missing signatures")
+		return
+	}
+	var data []byte
+	data, err = countersignData(w.EntryType, w.EntryHash, w.Signers)
+	if err != nil {
+		return
+	}
+	for i, p := range w.Signers {
+		var key ic.PubKey
+		key, err = ic.UnmarshalPublicKey(w.Keys[i])
+		if err != nil {
+			return
+		}
+		var ID peer.ID
+		ID, err = peer.IDFromPublicKey(key)
+		if err != nil {
+			return
+		}
+		if peer.IDB58Encode(ID) != p {
+			err = fmt.Errorf("countersignature key doesn't match party %s", p)
+			return
+		}
+		var matches bool
+		matches, err = key.Verify(data, w.Sigs[i])
+		if err != nil {
+			return
+		}
+		if !matches {
+			err = CountersignDoesNotVerify
+			return
+		}
+		if h != nil && h.dht != nil {
+			var revoked bool
+			_, revoked, err = h.dht.keyRevokedAt(ID)
+			if err != nil {
+				return
+			}
+			if revoked {
+				err = ErrCountersignKeyRevoked
+				return
+			}
+		}
+	}
+	return
+}
+
+func (w *CountersignWarrant) Property(key string) (value interface{}, err error) {
+	switch key {
+	case "entryType":
+		value = w.EntryType
+	case "entryHash":
+		value = w.EntryHash
+	default:
+		err = WarrantPropertyNotFoundErr
+	}
+	return
+}
+
+func (w *CountersignWarrant) Encode() (data []byte, err error) {
+	data, err = json.Marshal(w)
+	return
+}
+
+func (w *CountersignWarrant) Decode(data []byte) (err error) {
+	err = json.Unmarshal(data, w)
+	return
+}
+
+var InvalidEntryWarrantDoesNotVerify = errors.New("invalid entry warrant does not verify")
+var ErrWarrantedEntryValid = errors.New("warranted entry is valid")
+
+// isInvalidEntry reports whether a validation error shows the entry itself to be invalid,
+// rather than that it couldn't be validated, which is all that an author can be warranted for
+func isInvalidEntry(err error) bool {
+	return err == ValidationFailedErr
+}
+
+// InvalidEntryWarrant warrants that an agent authored an entry that doesn't validate.  It
+// carries the entry with its signed header and validation package so that any node can
+// validate the entry again rather than take the word of the node that rejected it.
+type InvalidEntryWarrant struct {
+	Author    string // node id of the entry's author
+	Key       []byte // marshaled public key of the author
+	EntryType string
+	Header    Header
+	Entry     GobEntry
+	Package   Package
+}
+
+// invalidEntryWarrantData is the encoding of an InvalidEntryWarrant, with the header and
+// entry in their own binary encodings so they hash and verify as they did when committed
+type invalidEntryWarrantData struct {
+	Author    string
+	Key       []byte
+	EntryType string
+	Header    []byte
+	Entry     []byte
+	Package   Package
+}
+
+// NewInvalidEntryWarrant returns a warrant of an entry of the author that didn't validate
+func NewInvalidEntryWarrant(author peer.ID, key ic.PubKey, entryType string, header *Header, entry *GobEntry, pkg *Package) (w *InvalidEntryWarrant, err error) {
+	var k []byte
+	k, err = ic.MarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	w = &InvalidEntryWarrant{Author: peer.IDB58Encode(author), Key: k, EntryType: entryType, Header: *header, Entry: *entry, Package: *pkg}
+	return
+}
+
+func (w *InvalidEntryWarrant) Type() int {
+	return InvalidEntryType
+}
+
+func (w *InvalidEntryWarrant) Parties() (parties []Hash, err error) {
+	var author Hash
+	author, err = NewHash(w.Author)
+	if err == nil {
+		parties = []Hash{author}
+	}
+	return
+}
+
+// Verify checks that the author signed the header of the entry and that the entry still
+// fails validation
+func (w *InvalidEntryWarrant) Verify(h *Holochain) (err error) {
+	var key ic.PubKey
+	key, err = ic.UnmarshalPublicKey(w.Key)
+	if err != nil {
+		return
+	}
+	var author peer.ID
+	author, err = peer.IDFromPublicKey(key)
+	if err != nil {
+		return
+	}
+	if peer.IDB58Encode(author) != w.Author {
+		err = fmt.Errorf("invalid entry warrant key doesn't match author %s", w.Author)
+		return
+	}
+	var matches bool
+	matches, err = key.Verify(w.Header.EntryLink.H, w.Header.Sig.S)
+	if err != nil {
+		return
+	}
+	if !matches || w.Header.Type != w.EntryType {
+		err = InvalidEntryWarrantDoesNotVerify
+		return
+	}
+	var hash Hash
+	hash, err = w.Entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(&w.Header.EntryLink) {
+		err = InvalidEntryWarrantDoesNotVerify
+		return
+	}
+
+	// only entries of types the app defines are evidence, not ones this node can't validate
+	if _, _, err = h.GetEntryDef(w.EntryType); err != nil {
+		return
+	}
+	a := NewPutAction(w.EntryType, &w.Entry, &w.Header)
+	if _, e := h.ValidateAction(a, w.EntryType, &w.Package, []peer.ID{author}); e == nil {
+		err = ErrWarrantedEntryValid
+	} else if !isInvalidEntry(e) {
+		err = fmt.Errorf("warranted entry couldn't be validated: %v", e)
+	}
+	return
+}
+
+func (w *InvalidEntryWarrant) Property(key string) (value interface{}, err error) {
+	switch key {
+	case "entryType":
+		value = w.EntryType
+	case "entryHash":
+		value = w.Header.EntryLink.String()
+	default:
+		err = WarrantPropertyNotFoundErr
+	}
+	return
+}
+
+func (w *InvalidEntryWarrant) Encode() (data []byte, err error) {
+	d := invalidEntryWarrantData{Author: w.Author, Key: w.Key, EntryType: w.EntryType, Package: w.Package}
+	d.Header, err = w.Header.Marshal()
+	if err != nil {
+		return
+	}
+	d.Entry, err = w.Entry.Marshal()
+	if err != nil {
+		return
+	}
+	data, err = json.Marshal(d)
+	return
+}
+
+func (w *InvalidEntryWarrant) Decode(data []byte) (err error) {
+	var d invalidEntryWarrantData
+	err = json.Unmarshal(data, &d)
+	if err != nil {
+		return
+	}
+	w.Author, w.Key, w.EntryType, w.Package = d.Author, d.Key, d.EntryType, d.Package
+	err = w.Header.Unmarshal(d.Header, 0)
+	if err != nil {
+		return
+	}
+	err = w.Entry.Unmarshal(d.Entry)
+	return
+}
@@ -3,9 +3,11 @@ package holochain
 import (
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"testing"
+	"time"
 )
 
 func TestSelfRevocationWarrant(t *testing.T) {
@@ -86,4 +88,167 @@ func TestSelfRevocationWarrant(t *testing.T) {
 		So(err, ShouldEqual, UnknownWarrantTypeErr)
 
 	})
+
+	Convey("it should encode and decode the signed revocation time", t, func() {
+		timed := *revocation
+		now := time.Now().Round(0)
+		So(timed.SetTime(newPrivKey, now), ShouldBeNil)
+		So(timed.Verify(), ShouldBeNil)
+		tw, _ := NewSelfRevocationWarrant(&timed)
+		encoded, err := tw.Encode()
+		So(err, ShouldBeNil)
+		w1, err := DecodeWarrant(SelfRevocationType, encoded)
+		So(err, ShouldBeNil)
+		So(w1.(*SelfRevocationWarrant).Revocation.Verify(), ShouldBeNil)
+		at, err := w1.Property("time")
+		So(err, ShouldBeNil)
+		So(at.(time.Time).Equal(now), ShouldBeTrue)
+
+		// revocations without a time still decode, with a zero time
+		encoded, _ = revocation.Marshal()
+		w1, err = DecodeWarrant(SelfRevocationType, encoded)
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", w1.(*SelfRevocationWarrant).Revocation), ShouldEqual, fmt.Sprintf("%v", *revocation))
+		at, _ = w1.Property("time")
+		So(at.(time.Time).IsZero(), ShouldBeTrue)
+	})
+
+	Convey("it should not verify a revocation time that was changed or not signed by the new key", t, func() {
+		timed := *revocation
+		So(timed.SetTime(newPrivKey, time.Now()), ShouldBeNil)
+		later := timed.Time.Add(time.Hour)
+		timed.Time = &later
+		So(timed.Verify(), ShouldEqual, SelfRevocationDoesNotVerify)
+
+		So(timed.SetTime(oldPrivKey, time.Now()), ShouldBeNil)
+		So(timed.Verify(), ShouldEqual, SelfRevocationDoesNotVerify)
+	})
+
+}
+
+func TestCountersignWarrant(t *testing.T) {
+	id1, key1 := makePeer("peer1")
+	id2, key2 := makePeer("peer2")
+
+	w := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2",
+		Signers: []string{peer.IDB58Encode(id1), peer.IDB58Encode(id2)}}
+
+	Convey("it should have a type and the parties", t, func() {
+		So(w.Type(), ShouldEqual, CountersignType)
+		parties, err := w.Parties()
+		So(err, ShouldBeNil)
+		So(len(parties), ShouldEqual, 2)
+		So(parties[0].String(), ShouldEqual, peer.IDB58Encode(id1))
+		So(parties[1].String(), ShouldEqual, peer.IDB58Encode(id2))
+	})
+
+	Convey("it should have the entry properties", t, func() {
+		entryHash, err := w.Property("entryHash")
+		So(err, ShouldBeNil)
+		So(entryHash, ShouldEqual, w.EntryHash)
+		_, err = w.Property("foo")
+		So(err, ShouldEqual, WarrantPropertyNotFoundErr)
+	})
+
+	Convey("verification should fail until all the parties signed", t, func() {
+		So(w.Verify(nil).Error(), ShouldEqual, "countersignature is missing signatures")
+		So(w.sign(key1), ShouldBeNil)
+		So(w.Verify(nil).Error(), ShouldEqual, "countersignature is missing signatures")
+		So(w.sign(key2), ShouldBeNil)
+		So(w.Verify(nil), ShouldBeNil)
+	})
+
+	Convey("verification should fail if signed with the wrong key or tampered with", t, func() {
+		w1 := &CountersignWarrant{EntryType: w.EntryType, EntryHash: w.EntryHash, Signers: w.Signers}
+		w1.sign(key2)
+		w1.sign(key1)
+		So(w1.Verify(nil).Error(), ShouldStartWith, "countersignature key doesn't match party")
+
+		w1 = &CountersignWarrant{EntryType: "evenNumbers", EntryHash: w.EntryHash, Signers: w.Signers, Keys: w.Keys, Sigs: w.Sigs}
+		So(w1.Verify(nil), ShouldEqual, CountersignDoesNotVerify)
+	})
+
+	Convey("it should encode and decode warrants", t, func() {
+		encoded, err := w.Encode()
+		So(err, ShouldBeNil)
+		w1, err := DecodeWarrant(CountersignType, encoded)
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", w1), ShouldEqual, fmt.Sprintf("%v", w))
+		So(w1.Verify(nil), ShouldBeNil)
+	})
+}
+
+func TestInvalidEntryWarrant(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	makeWarrant := func(entryType string, content string) *InvalidEntryWarrant {
+		entry := &GobEntry{C: content}
+		_, header, err := newHeader(h.hashSpec, time.Now(), entryType, entry, h.agent.PrivKey(), NullHash(), NullHash(), nil)
+		if err != nil {
+			panic(err)
+		}
+		w, err := NewInvalidEntryWarrant(h.nodeID, h.agent.PubKey(), entryType, header, entry, &Package{})
+		if err != nil {
+			panic(err)
+		}
+		return w
+	}
+	w := makeWarrant("oddNumbers", "4")
+
+	Convey("it should have a type and the author as its party", t, func() {
+		So(w.Type(), ShouldEqual, InvalidEntryType)
+		parties, err := w.Parties()
+		So(err, ShouldBeNil)
+		So(len(parties), ShouldEqual, 1)
+		So(parties[0].String(), ShouldEqual, h.nodeIDStr)
+	})
+
+	Convey("it should have the entry properties", t, func() {
+		entryHash, err := w.Property("entryHash")
+		So(err, ShouldBeNil)
+		So(entryHash, ShouldEqual, w.Header.EntryLink.String())
+		entryType, err := w.Property("entryType")
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+	})
+
+	Convey("verification should succeed if the entry doesn't validate", t, func() {
+		So(w.Verify(h), ShouldBeNil)
+	})
+
+	Convey("verification should fail if the entry validates", t, func() {
+		So(makeWarrant("oddNumbers", "7").Verify(h), ShouldEqual, ErrWarrantedEntryValid)
+	})
+
+	Convey("verification should fail if the entry failed other than by not validating", t, func() {
+		h.nucleus.dna.DHTConfig.MaxEntrySize = 1
+		defer func() { h.nucleus.dna.DHTConfig.MaxEntrySize = 0 }()
+		So(w.Verify(h).Error(), ShouldEqual, "warranted entry couldn't be validated: "+ErrEntryTooLarge.Error())
+	})
+
+	Convey("verification should fail if the evidence was tampered with", t, func() {
+		w1 := *w
+		w1.Entry = GobEntry{C: "6"}
+		So(w1.Verify(h), ShouldEqual, InvalidEntryWarrantDoesNotVerify)
+
+		w1 = *w
+		w1.EntryType = "evenNumbers"
+		So(w1.Verify(h), ShouldEqual, InvalidEntryWarrantDoesNotVerify)
+
+		other, _ := makePeer("other")
+		w1 = *w
+		w1.Author = peer.IDB58Encode(other)
+		So(w1.Verify(h).Error(), ShouldStartWith, "invalid entry warrant key doesn't match author")
+	})
+
+	Convey("it should encode and decode warrants", t, func() {
+		encoded, err := w.Encode()
+		So(err, ShouldBeNil)
+		w1, err := DecodeWarrant(InvalidEntryType, encoded)
+		So(err, ShouldBeNil)
+		So(w1.(*InvalidEntryWarrant).Header.EntryLink.String(), ShouldEqual, w.Header.EntryLink.String())
+		So(w1.(*InvalidEntryWarrant).Entry.C, ShouldEqual, "4")
+		So(w1.Verify(h), ShouldBeNil)
+	})
 }
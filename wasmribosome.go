@@ -0,0 +1,390 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// WasmRibosome implements a WebAssembly use of the Ribosome interface
+//
+// Values cross between the host and the module as JSON in the module's linear memory.
+// The module must export its memory and an `alloc(size i32) i32` function which the host
+// uses to place values in it.  Every other function in either direction has the signature
+// `(ptr i32, len i32) i64` where ptr and len locate the JSON input and the i64 returned
+// packs the pointer to the output in its high 32 bits and the output's length in its low
+// 32 bits.
+//
+// The API is imported from the "hc" module, i.e. (import "hc" "commit" ...).  It takes a
+// JSON array of the function's arguments and returns {"result":...} or {"error":"..."}.
+// Exposed zome functions get their parameter string as is and return their result string.
+// The callbacks (genesis, bridgeGenesis, receive, validateCommit, validatePutPkg, etc.)
+// get a JSON array of the same arguments as the JS callbacks and return JSON.  The lifecycle
+// callbacks (onPeerConnected, onHeld, etc.) are optional and only called if exported.
+
+package holochain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"strings"
+)
+
+const (
+	WasmRibosomeType = "wasm"
+)
+
+// compiled modules are shared by all the wasm ribosomes so zome code is compiled only once
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+// WasmRibosome holds data needed for the WebAssembly runtime
+type WasmRibosome struct {
+	h          *Holochain
+	zome       *Zome
+	rt         wazero.Runtime
+	compiled   wazero.CompiledModule
+	mod        api.Module
+	strict     bool  // set while running validation callbacks in strict mode
+	validating bool  // set while running validation callbacks
+	hostErr    error // set when an API call can't hand its response to the module
+}
+
+// Type returns the string value under which this ribosome is registered
+func (wr *WasmRibosome) Type() string { return WasmRibosomeType }
+
+// NewWasmRibosome factory function to build a WebAssembly execution environment for a zome.
+// The zome's code is the base64 encoding of the module's binary.
+func NewWasmRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	code, err := base64.StdEncoding.DecodeString(zome.Code)
+	if err != nil {
+		err = fmt.Errorf("wasm zome code should be base64 encoded: %v", err)
+		return
+	}
+	ctx := context.Background()
+	wr := WasmRibosome{
+		h:    h,
+		zome: zome,
+		rt: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+			WithCompilationCache(wasmCompilationCache).
+			WithCloseOnContextDone(true)),
+	}
+
+	hc := wr.rt.NewHostModuleBuilder("hc")
+	for _, fn := range jsonAPIFns() {
+		name := fn
+		hc.NewFunctionBuilder().
+			WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) uint64 {
+				return wr.hostCall(ctx, m, name, ptr, size)
+			}).
+			Export(name)
+	}
+	_, err = hc.Instantiate(ctx)
+	if err == nil {
+		wr.compiled, err = wr.rt.CompileModule(ctx, code)
+	}
+	if err == nil {
+		err = wr.instantiate()
+	}
+	if err != nil {
+		wr.rt.Close(ctx)
+		return
+	}
+	n = &wr
+	return
+}
+
+// instantiate makes a fresh instance of the zome's module
+func (wr *WasmRibosome) instantiate() (err error) {
+	wr.mod, err = wr.rt.InstantiateModule(context.Background(), wr.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return
+	}
+	if wr.mod.Memory() == nil || wr.mod.ExportedFunction("alloc") == nil {
+		err = errors.New("wasm zome code must export memory and alloc")
+	}
+	return
+}
+
+// Reset replaces the module instance with a fresh one, dropping all its memory
+func (wr *WasmRibosome) Reset() (err error) {
+	ctx := context.Background()
+	if wr.mod != nil {
+		wr.mod.Close(ctx)
+	}
+	err = wr.instantiate()
+	return
+}
+
+// Close closes the runtime, releasing the compiled code it holds
+func (wr *WasmRibosome) Close() error {
+	return wr.rt.Close(context.Background())
+}
+
+// hostCall runs an API function called by the module and returns the packed location of
+// the JSON response, which it places in the module's memory
+func (wr *WasmRibosome) hostCall(ctx context.Context, m api.Module, fn string, ptr, size uint32) uint64 {
+	var rsp jsonAPIResult
+	var raw []json.RawMessage
+	in, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		rsp.Error = fmt.Sprintf("arguments to %s out of memory bounds", fn)
+	} else if err := json.Unmarshal(in, &raw); err != nil {
+		rsp.Error = fmt.Sprintf("arguments to %s should be a JSON array: %v", fn, err)
+	} else {
+		rsp.Result, err = jsonAPICall(wr.h, wr.zome, wr.validating, wr.strict, fn, raw)
+		if err != nil {
+			rsp.Result = nil
+			rsp.Error = err.Error()
+		}
+	}
+	out, err := json.Marshal(rsp)
+	if err == nil {
+		var packed uint64
+		packed, err = wasmWrite(ctx, m, out)
+		if err == nil {
+			return packed
+		}
+	}
+	// there is no way to tell the module, so abort the call and report it from there
+	wr.hostErr = fmt.Errorf("unable to return the result of %s: %v", fn, err)
+	m.CloseWithExitCode(ctx, 1)
+	return 0
+}
+
+// wasmWrite places data in the module's memory and returns its packed location
+func wasmWrite(ctx context.Context, m api.Module, data []byte) (packed uint64, err error) {
+	r, err := m.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return
+	}
+	ptr := uint32(r[0])
+	if !m.Memory().Write(ptr, data) {
+		err = errors.New("alloc returned memory out of bounds")
+		return
+	}
+	packed = uint64(ptr)<<32 | uint64(len(data))
+	return
+}
+
+// call runs an exported function of the module under the limits for the given kind of
+// execution.  Only the Timeout limit applies to wasm code.
+func (wr *WasmRibosome) call(kind string, fnName string, input []byte) (output []byte, err error) {
+	fn := wr.mod.ExportedFunction(fnName)
+	if fn == nil {
+		err = fmt.Errorf("function %s not exported", fnName)
+		return
+	}
+	ctx := context.Background()
+	g := newExecGuard(wr.h, wr.zome, kind)
+	if g != nil && g.timeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout())
+		defer cancel()
+	}
+	packed, err := wasmWrite(ctx, wr.mod, input)
+	if err != nil {
+		return
+	}
+	wr.hostErr = nil
+	r, err := fn.Call(ctx, packed>>32, packed&0xffffffff)
+	if err != nil {
+		aborted := true
+		if ctx.Err() == context.DeadlineExceeded {
+			err = g.exceeded("time")
+		} else if wr.hostErr != nil {
+			err = wr.hostErr
+		} else {
+			aborted = false
+		}
+		if aborted {
+			// the module was closed, so replace it for whoever runs next
+			if ierr := wr.instantiate(); ierr != nil {
+				wr.h.Debugf("unable to reinstantiate %s: %v", wr.zome.Name, ierr)
+			}
+		}
+		return
+	}
+	ptr, size := uint32(r[0]>>32), uint32(r[0])
+	out, ok := wr.mod.Memory().Read(ptr, size)
+	if !ok {
+		err = fmt.Errorf("%s returned memory out of bounds", fnName)
+		return
+	}
+	// copy as the view is only valid until the memory grows
+	output = append([]byte{}, out...)
+	return
+}
+
+// callJSON calls a callback with a JSON array of arguments and decodes its JSON result
+func (wr *WasmRibosome) callJSON(kind string, fnName string, result interface{}, args ...interface{}) (err error) {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return
+	}
+	output, err := wr.call(kind, fnName, input)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		return
+	}
+	err = json.Unmarshal(output, result)
+	if err != nil {
+		err = fmt.Errorf("%s should return JSON: %v", fnName, err)
+	}
+	return
+}
+
+func (wr *WasmRibosome) boolFn(fnName string, args ...interface{}) (err error) {
+	var b interface{}
+	err = wr.callJSON(GenesisExecution, fnName, &b, args...)
+	if err != nil {
+		return
+	}
+	r, ok := b.(bool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, b)
+	} else if !r {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (wr *WasmRibosome) ChainGenesis() (err error) {
+	err = wr.boolFn("genesis")
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (wr *WasmRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	err = wr.boolFn("bridgeGenesis", side, dnaHash.String(), data)
+	return
+}
+
+// Hook runs the lifecycle callback of the given name, if the module exports it
+func (wr *WasmRibosome) Hook(hook string, args ...string) (err error) {
+	if wr.mod.ExportedFunction(hook) == nil {
+		return
+	}
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a
+	}
+	var r interface{}
+	err = wr.callJSON(ReceiveExecution, hook, &r, params...)
+	return
+}
+
+// BoolHook runs the callback of the given name, which must return a boolean, and returns
+// false if the module doesn't export it
+func (wr *WasmRibosome) BoolHook(hook string, args ...string) (result bool, err error) {
+	if wr.mod.ExportedFunction(hook) == nil {
+		return
+	}
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a
+	}
+	var r interface{}
+	err = wr.callJSON(ReceiveExecution, hook, &r, params...)
+	if err != nil {
+		return
+	}
+	b, ok := r.(bool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", hook, r)
+		return
+	}
+	result = b
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (wr *WasmRibosome) Receive(from string, msg string) (response string, err error) {
+	var r json.RawMessage
+	err = wr.callJSON(ReceiveExecution, "receive", &r, from, json.RawMessage(msg))
+	if err == nil {
+		response = string(r)
+	}
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (wr *WasmRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	wr.validating = true
+	defer func() { wr.validating = false }()
+	if strictValidation(wr.h) {
+		wr.strict = true
+		defer func() { wr.strict = false }()
+	}
+	var r map[string]interface{}
+	err = wr.callJSON(ValidateExecution, fnName, &r, def.Name)
+	if err == nil && r != nil {
+		req = r
+	}
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (wr *WasmRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	args, err := jsonValidateArgs(action, def, pkg, sources)
+	if err != nil {
+		return
+	}
+	wr.validating = true
+	defer func() { wr.validating = false }()
+	if strictValidation(wr.h) {
+		wr.strict = true
+		defer func() { wr.strict = false }()
+	}
+	fnName := "validate" + strings.Title(action.Name())
+	var b interface{}
+	err = wr.callJSON(ValidateExecution, fnName, &b, args...)
+	if err != nil {
+		return
+	}
+	r, ok := b.(bool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, b)
+	} else if !r {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// Call calls an exported function of the module, passing the params string as is
+func (wr *WasmRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	if fn.CallingType != STRING_CALLING && fn.CallingType != JSON_CALLING {
+		err = errors.New("params type not implemented")
+		return
+	}
+	wr.h.Debugf("Wasm Call: %s(%s)", fn.Name, params)
+	var output []byte
+	output, err = wr.call(CallExecution, fn.Name, []byte(params.(string)))
+	if err == nil {
+		result = string(output)
+	}
+	return
+}
+
+// Run is not supported as a wasm module can't be extended with source code at run time
+func (wr *WasmRibosome) Run(code string) (result interface{}, err error) {
+	err = errors.New("wasm ribosome can't run code")
+	return
+}
+
+// RunAsyncSendResponse calls the callback given to send with the response
+func (wr *WasmRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	var r json.RawMessage
+	err = wr.callJSON(CallExecution, callback, &r, json.RawMessage(response.Body), callbackID)
+	if err == nil {
+		result = string(r)
+	}
+	return
+}
@@ -0,0 +1,97 @@
+//go:build go1.18
+// +build go1.18
+
+package holochain
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// a hand assembled module that exports memory, a bump allocator and:
+//
+//	echo: returns its input
+//	genesis: returns true
+//	version: calls the version API function with no arguments and returns its response
+const testWasmCode = `AGFzbQEAAAABDAJgAX8Bf2ACf38BfgIOAQJoYwd2ZXJzaW9uAAEDBQQAAQEBBQMBAAEGBwF/AUGACAsHLQUGbWVtb3J5AgAFYWxsb2MAAQRlY2hvAAIHZ2VuZXNpcwADB3ZlcnNpb24ABAotBAsAIwAjACAAaiQACwwAIACtQiCGIAGthAsJAEKEgICAgAILCABBIEECEAALCxECAEEQCwR0cnVlAEEgCwJbXQ==`
+
+func TestNewWasmRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &Zome{Name: "wasmZome", RibosomeType: WasmRibosomeType, Code: testWasmCode,
+		Functions: []FunctionDef{{Name: "echo", CallingType: STRING_CALLING}, {Name: "version", CallingType: STRING_CALLING}},
+	}
+
+	Convey("it should fail on code that isn't base64 or a module", t, func() {
+		_, err := NewWasmRibosome(h, &Zome{Name: "bad", RibosomeType: WasmRibosomeType, Code: "(not base64)"})
+		So(err, ShouldNotBeNil)
+		_, err = NewWasmRibosome(h, &Zome{Name: "bad", RibosomeType: WasmRibosomeType, Code: "AAAA"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("it should call exported functions", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, WasmRibosomeType)
+		result, err := v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "fish")
+
+		_, err = v.Call(&FunctionDef{Name: "bogus", CallingType: STRING_CALLING}, "")
+		So(err.Error(), ShouldEqual, "function bogus not exported")
+	})
+
+	Convey("it should run genesis", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		err = v.ChainGenesis()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should expose the API through imports", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		result, err := v.Call(&zome.Functions[1], "")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, `{"result":"`+VersionStr+`"}`)
+	})
+
+	Convey("it should be resettable", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		err = v.(*WasmRibosome).Reset()
+		So(err, ShouldBeNil)
+		result, err := v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "fish")
+	})
+
+	Convey("it should abort the call instead of panicking when it can't return a result", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		wr := v.(*WasmRibosome)
+		ctx := context.Background()
+		m := wr.mod
+		m.Close(ctx) // so alloc can't be called
+		So(func() { wr.hostCall(ctx, m, "version", 0, 0) }, ShouldNotPanic)
+		So(wr.hostErr, ShouldNotBeNil)
+	})
+
+	Convey("it should close its runtime", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		err = v.Close()
+		So(err, ShouldBeNil)
+		_, err = v.Call(&zome.Functions[0], "fish")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("it should not run code strings", t, func() {
+		v, err := NewWasmRibosome(h, zome)
+		So(err, ShouldBeNil)
+		_, err = v.Run("1+1")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,24 @@
+//go:build !go1.18
+// +build !go1.18
+
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// The WebAssembly runtime needs go1.18 or later, so holochain built with an older go
+// can't load wasm zomes.
+
+package holochain
+
+import (
+	"errors"
+)
+
+const (
+	WasmRibosomeType = "wasm"
+)
+
+// NewWasmRibosome fails as this build has no WebAssembly runtime
+func NewWasmRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	err = errors.New("wasm zomes need holochain built with go1.18 or later")
+	return
+}
@@ -0,0 +1,934 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// wire implements the versioned, language neutral envelope used to put Messages on
+// the wire.  Envelopes and their bodies are encoded in CBOR (RFC 7049) so that nodes
+// not written in go can interoperate with us.  The legacy gob encoding is kept as a
+// fallback and which of the two is used is negotiated per stream (see StartProtocol)
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// WireFormat identifies an encoding used for Messages on a stream
+type WireFormat int
+
+const (
+	// GobWireFormat is the legacy, go only, gob encoding
+	GobWireFormat WireFormat = iota
+
+	// CBORWireFormat is the versioned CBOR envelope
+	CBORWireFormat
+)
+
+const (
+	// WireVersion is the version of the envelope format produced by this node
+	WireVersion = 1
+
+	// MaxEnvelopeSize is the largest envelope we are willing to read off a stream
+	MaxEnvelopeSize = MaxMessageSize
+
+	// MaxWireDepth is the deepest nesting of values we are willing to decode
+	MaxWireDepth = 128
+)
+
+// cbor major types
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cbor simple values and tags used by the envelope
+const (
+	cborFalse     = 20
+	cborTrue      = 21
+	cborNull      = 22
+	cborUndefined = 23
+	cborFloat32   = 26
+	cborFloat64   = 27
+
+	cborTagTime   = 0  // RFC 3339 date/time string
+	cborTagObject = 27 // [schema name, value] for typed values held in interfaces
+)
+
+// wireTimeLayout is RFC 3339 but always with a numeric zone offset so that
+// local times survive the round trip the same way they do with gob
+const wireTimeLayout = "2006-01-02T15:04:05.999999999-07:00"
+
+var ErrUnknownWireSchema = errors.New("unknown wire schema")
+var ErrWireVersion = errors.New("unsupported wire version")
+var ErrEnvelopeTooLarge = errors.New("envelope too large")
+var ErrWireTooDeep = errors.New("wire: values nested too deeply")
+
+var errWireTruncated = errors.New("wire: truncated data")
+
+var timeType = reflect.TypeOf(time.Time{})
+var peerIDType = reflect.TypeOf(peer.ID(""))
+var maxInt = uint64(^uint(0) >> 1)
+
+var wireSchemaTypes = make(map[string]reflect.Type)
+var wireSchemaNames = make(map[reflect.Type]string)
+
+// RegisterWireSchema records the schema name under which values of the given type
+// are identified on the wire.  Like gob.Register this must be done for every type
+// sent as a Message body or held in an interface field of one.
+func RegisterWireSchema(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	wireSchemaTypes[name] = t
+	wireSchemaNames[t] = name
+}
+
+// registerMessageBody registers a type for both the legacy and the CBOR encodings
+func registerMessageBody(value interface{}) {
+	gob.Register(value)
+	RegisterWireSchema(reflect.TypeOf(value).Name(), value)
+}
+
+func init() {
+	// schemas for bodies which aren't structs
+	RegisterWireSchema("string", "")
+	RegisterWireSchema("bytes", []byte{})
+	RegisterWireSchema("int", 0)
+	RegisterWireSchema("int64", int64(0))
+	RegisterWireSchema("uint64", uint64(0))
+	RegisterWireSchema("bool", false)
+	RegisterWireSchema("float", float64(0))
+	RegisterWireSchema("map", map[string]interface{}{})
+	RegisterWireSchema("list", []interface{}{})
+}
+
+// EncodeWire codes a message in the given wire format
+func (m *Message) EncodeWire(format WireFormat) (data []byte, err error) {
+	switch format {
+	case GobWireFormat:
+		data, err = m.Encode()
+	case CBORWireFormat:
+		data, err = m.encodeEnvelope()
+	default:
+		err = fmt.Errorf("unknown wire format: %d", format)
+	}
+	return
+}
+
+// DecodeWire converts a message from the given wire format
+func (m *Message) DecodeWire(format WireFormat, r io.Reader) (err error) {
+	switch format {
+	case GobWireFormat:
+		err = m.Decode(r)
+	case CBORWireFormat:
+		err = m.decodeEnvelope(r)
+	default:
+		err = fmt.Errorf("unknown wire format: %d", format)
+	}
+	return
+}
+
+// encodeEnvelope codes a message as a length prefixed CBOR map of the form:
+// {"v": version, "t": type, "ts": time, "f": from, "s": body schema, "b": body}
+func (m *Message) encodeEnvelope() (data []byte, err error) {
+	var schema string
+	body := reflect.ValueOf(m.Body)
+	for body.IsValid() && body.Kind() == reflect.Ptr {
+		if body.IsNil() {
+			body = reflect.Value{}
+		} else {
+			body = body.Elem()
+		}
+	}
+	if body.IsValid() {
+		var ok bool
+		schema, ok = wireSchemaNames[body.Type()]
+		if !ok {
+			err = fmt.Errorf("%v: %v", ErrUnknownWireSchema, body.Type())
+			return
+		}
+	}
+
+	var e cborEncoder
+	e.head(cborMap, 6)
+	e.text("v")
+	e.head(cborUint, WireVersion)
+	e.text("t")
+	e.int(int64(m.Type))
+	e.text("ts")
+	e.time(m.Time)
+	e.text("f")
+	e.bytes([]byte(m.From))
+	e.text("s")
+	e.text(schema)
+	e.text("b")
+	err = e.value(body)
+	if err != nil {
+		return
+	}
+
+	var b bytes.Buffer
+	err = binary.Write(&b, binary.BigEndian, uint32(len(e.buf)))
+	if err != nil {
+		return
+	}
+	b.Write(e.buf)
+	data = b.Bytes()
+	return
+}
+
+// decodeEnvelope reads a length prefixed CBOR envelope.  Keys it doesn't know
+// about are ignored so that fields can be added without bumping the version.
+func (m *Message) decodeEnvelope(r io.Reader) (err error) {
+	var size uint32
+	err = binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return
+	}
+	if size > MaxEnvelopeSize {
+		err = ErrEnvelopeTooLarge
+		return
+	}
+	// the size is only what the sender claims, so the buffer grows with what actually
+	// arrives rather than being allocated up front
+	var b bytes.Buffer
+	var read int64
+	read, err = io.Copy(&b, io.LimitReader(r, int64(size)))
+	if err != nil {
+		return
+	}
+	if read < int64(size) {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+
+	d := cborDecoder{buf: b.Bytes()}
+	major, _, n, err := d.head()
+	if err != nil {
+		return
+	}
+	if major != cborMap {
+		err = errors.New("wire: envelope must be a map")
+		return
+	}
+
+	var version uint64
+	var schema string
+	var body []byte
+	for i := uint64(0); i < n; i++ {
+		var key string
+		err = d.decode(reflect.ValueOf(&key).Elem())
+		if err != nil {
+			return
+		}
+		switch key {
+		case "v":
+			err = d.decode(reflect.ValueOf(&version).Elem())
+		case "t":
+			err = d.decode(reflect.ValueOf(&m.Type).Elem())
+		case "ts":
+			err = d.decode(reflect.ValueOf(&m.Time).Elem())
+		case "f":
+			err = d.decode(reflect.ValueOf(&m.From).Elem())
+		case "s":
+			err = d.decode(reflect.ValueOf(&schema).Elem())
+		case "b":
+			body, err = d.skip()
+		default:
+			_, err = d.skip()
+		}
+		if err != nil {
+			return
+		}
+	}
+	if version == 0 || version > WireVersion {
+		err = fmt.Errorf("%v: %d", ErrWireVersion, version)
+		return
+	}
+
+	m.Body = nil
+	if schema != "" {
+		t, ok := wireSchemaTypes[schema]
+		if !ok {
+			err = fmt.Errorf("%v: %s", ErrUnknownWireSchema, schema)
+			return
+		}
+		v := reflect.New(t).Elem()
+		bd := cborDecoder{buf: body}
+		err = bd.decode(v)
+		if err != nil {
+			return
+		}
+		m.Body = v.Interface()
+	}
+	return
+}
+
+// cborEncoder builds up the CBOR encoding of values in buf
+type cborEncoder struct {
+	buf []byte
+}
+
+func (e *cborEncoder) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, m|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, m|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		e.buf = append(e.buf, m|27)
+		for s := uint(56); ; s -= 8 {
+			e.buf = append(e.buf, byte(n>>s))
+			if s == 0 {
+				break
+			}
+		}
+	}
+}
+
+func (e *cborEncoder) int(i int64) {
+	if i < 0 {
+		e.head(cborNegInt, uint64(-1-i))
+	} else {
+		e.head(cborUint, uint64(i))
+	}
+}
+
+func (e *cborEncoder) bytes(b []byte) {
+	e.head(cborBytes, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cborEncoder) simple(v byte) {
+	e.buf = append(e.buf, cborSimple<<5|v)
+}
+
+func (e *cborEncoder) float(f float64) {
+	e.simple(cborFloat64)
+	b := math.Float64bits(f)
+	for s := uint(56); ; s -= 8 {
+		e.buf = append(e.buf, byte(b>>s))
+		if s == 0 {
+			break
+		}
+	}
+}
+
+func (e *cborEncoder) time(t time.Time) {
+	layout := wireTimeLayout
+	if t.Location() == time.UTC {
+		layout = time.RFC3339Nano
+	}
+	e.head(cborTag, cborTagTime)
+	e.text(t.Format(layout))
+}
+
+// value encodes structs as maps keyed by field name, and values held in
+// interfaces whose type has a registered schema as tagged [name, value] pairs
+func (e *cborEncoder) value(v reflect.Value) (err error) {
+	if !v.IsValid() {
+		e.simple(cborNull)
+		return
+	}
+	switch v.Type() {
+	case timeType:
+		e.time(v.Interface().(time.Time))
+		return
+	case peerIDType:
+		e.bytes([]byte(v.String()))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.simple(cborTrue)
+		} else {
+			e.simple(cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(v.Float())
+	case reflect.String:
+		e.text(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.simple(cborNull)
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.bytes(v.Bytes())
+			return
+		}
+		err = e.array(v)
+	case reflect.Array:
+		err = e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.simple(cborNull)
+			return
+		}
+		err = e.mapping(v)
+	case reflect.Struct:
+		err = e.fields(v)
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.simple(cborNull)
+			return
+		}
+		err = e.value(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			e.simple(cborNull)
+			return
+		}
+		elem := v.Elem()
+		for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct && elem.Type() != timeType {
+			name, ok := wireSchemaNames[elem.Type()]
+			if !ok {
+				err = fmt.Errorf("%v: %v", ErrUnknownWireSchema, elem.Type())
+				return
+			}
+			e.head(cborTag, cborTagObject)
+			e.head(cborArray, 2)
+			e.text(name)
+		}
+		err = e.value(elem)
+	default:
+		err = fmt.Errorf("wire: unsupported type %v", v.Type())
+	}
+	return
+}
+
+func (e *cborEncoder) array(v reflect.Value) (err error) {
+	e.head(cborArray, uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		err = e.value(v.Index(i))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// mapping encodes map entries sorted by their encoded key so that the same
+// map always produces the same bytes
+func (e *cborEncoder) mapping(v reflect.Value) (err error) {
+	type pair struct{ k, v []byte }
+	pairs := make([]pair, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		var ke, ve cborEncoder
+		err = ke.value(key)
+		if err != nil {
+			return
+		}
+		err = ve.value(v.MapIndex(key))
+		if err != nil {
+			return
+		}
+		pairs = append(pairs, pair{ke.buf, ve.buf})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].k, pairs[j].k) < 0 })
+	e.head(cborMap, uint64(len(pairs)))
+	for _, p := range pairs {
+		e.buf = append(e.buf, p.k...)
+		e.buf = append(e.buf, p.v...)
+	}
+	return
+}
+
+func (e *cborEncoder) fields(v reflect.Value) (err error) {
+	t := v.Type()
+	var exported []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			exported = append(exported, i)
+		}
+	}
+	e.head(cborMap, uint64(len(exported)))
+	for _, i := range exported {
+		e.text(t.Field(i).Name)
+		err = e.value(v.Field(i))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// cborDecoder reads CBOR encoded values out of buf
+type cborDecoder struct {
+	buf   []byte
+	pos   int
+	depth int
+}
+
+// nest is called on entering each nested item, and the returned func on leaving it, so
+// that a hostile payload can't nest deeply enough to exhaust the stack
+func (d *cborDecoder) nest() (leave func(), err error) {
+	if d.depth >= MaxWireDepth {
+		err = ErrWireTooDeep
+		return
+	}
+	d.depth++
+	leave = func() { d.depth-- }
+	return
+}
+
+// head reads the initial byte (and argument) of the next item.  Indefinite
+// lengths are never produced by us and aren't supported.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	if d.pos >= len(d.buf) {
+		err = errWireTruncated
+		return
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	major = b >> 5
+	info = b & 0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		n := 1 << (info - 24)
+		if d.pos+n > len(d.buf) {
+			err = errWireTruncated
+			return
+		}
+		for _, c := range d.buf[d.pos : d.pos+n] {
+			arg = arg<<8 | uint64(c)
+		}
+		d.pos += n
+	default:
+		err = fmt.Errorf("wire: unsupported cbor additional info %d", info)
+	}
+	return
+}
+
+func (d *cborDecoder) take(n uint64) (b []byte, err error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		err = errWireTruncated
+		return
+	}
+	b = d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return
+}
+
+// count checks that a container of n items could possibly fit in what's left
+func (d *cborDecoder) count(n uint64) (int, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return 0, errWireTruncated
+	}
+	return int(n), nil
+}
+
+// skip passes over the next item returning its raw encoding
+func (d *cborDecoder) skip() (raw []byte, err error) {
+	leave, err := d.nest()
+	if err != nil {
+		return
+	}
+	defer leave()
+	start := d.pos
+	major, _, arg, err := d.head()
+	if err != nil {
+		return
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = d.take(arg)
+	case cborArray, cborMap:
+		var n int
+		n, err = d.count(arg)
+		if major == cborMap {
+			n *= 2
+		}
+		for i := 0; i < n && err == nil; i++ {
+			_, err = d.skip()
+		}
+	case cborTag:
+		_, err = d.skip()
+	}
+	if err != nil {
+		return
+	}
+	raw = d.buf[start:d.pos]
+	return
+}
+
+func mismatch(major byte, t reflect.Type) error {
+	return fmt.Errorf("wire: can't decode cbor major type %d into %v", major, t)
+}
+
+// decode reads the next item into v which must be settable
+func (d *cborDecoder) decode(v reflect.Value) (err error) {
+	leave, err := d.nest()
+	if err != nil {
+		return
+	}
+	defer leave()
+	if v.Kind() == reflect.Interface {
+		var x interface{}
+		x, err = d.generic()
+		if err != nil {
+			return
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(v.Type()) {
+			err = fmt.Errorf("wire: %v does not implement %v", xv.Type(), v.Type())
+			return
+		}
+		v.Set(xv)
+		return
+	}
+
+	start := d.pos
+	major, info, arg, err := d.head()
+	if err != nil {
+		return
+	}
+	if major == cborSimple && (info == cborNull || info == cborUndefined) {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+
+	if v.Type() == timeType {
+		if major != cborTag || arg != cborTagTime {
+			return mismatch(major, v.Type())
+		}
+		var s string
+		err = d.decode(reflect.ValueOf(&s).Elem())
+		if err != nil {
+			return
+		}
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, s)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return
+	}
+
+	if major == cborTag {
+		// a typed value where we already know the type, so just check its shape
+		if arg == cborTagObject {
+			var n uint64
+			major, _, n, err = d.head()
+			if err != nil {
+				return
+			}
+			if major != cborArray || n != 2 {
+				return errors.New("wire: malformed typed value")
+			}
+			_, err = d.skip()
+			if err != nil {
+				return
+			}
+		}
+		return d.decode(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		d.pos = start
+		p := reflect.New(v.Type().Elem())
+		err = d.decode(p.Elem())
+		if err == nil {
+			v.Set(p)
+		}
+	case reflect.Bool:
+		if major != cborSimple || (info != cborFalse && info != cborTrue) {
+			return mismatch(major, v.Type())
+		}
+		v.SetBool(info == cborTrue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (major != cborUint && major != cborNegInt) || arg > math.MaxInt64 {
+			return mismatch(major, v.Type())
+		}
+		i := int64(arg)
+		if major == cborNegInt {
+			i = -1 - i
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("wire: %d overflows %v", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if major != cborUint {
+			return mismatch(major, v.Type())
+		}
+		if v.OverflowUint(arg) {
+			return fmt.Errorf("wire: %d overflows %v", arg, v.Type())
+		}
+		v.SetUint(arg)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch {
+		case major == cborSimple && info == cborFloat64:
+			f = math.Float64frombits(arg)
+		case major == cborSimple && info == cborFloat32:
+			f = float64(math.Float32frombits(uint32(arg)))
+		case major == cborUint:
+			f = float64(arg)
+		case major == cborNegInt:
+			f = -1 - float64(arg)
+		default:
+			return mismatch(major, v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if major != cborText && major != cborBytes {
+			return mismatch(major, v.Type())
+		}
+		var b []byte
+		b, err = d.take(arg)
+		if err == nil {
+			v.SetString(string(b))
+		}
+	case reflect.Slice:
+		if major == cborBytes && v.Type().Elem().Kind() == reflect.Uint8 {
+			var b []byte
+			b, err = d.take(arg)
+			if err == nil {
+				v.SetBytes(append([]byte{}, b...))
+			}
+			return
+		}
+		if major != cborArray {
+			return mismatch(major, v.Type())
+		}
+		var n int
+		n, err = d.count(arg)
+		if err != nil {
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			err = d.decode(s.Index(i))
+			if err != nil {
+				return
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		if major != cborArray || arg != uint64(v.Len()) {
+			return mismatch(major, v.Type())
+		}
+		for i := 0; i < v.Len(); i++ {
+			err = d.decode(v.Index(i))
+			if err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		if major != cborMap {
+			return mismatch(major, v.Type())
+		}
+		var n int
+		n, err = d.count(arg)
+		if err != nil {
+			return
+		}
+		t := v.Type()
+		m := reflect.MakeMap(t)
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			err = d.decode(key)
+			if err != nil {
+				return
+			}
+			val := reflect.New(t.Elem()).Elem()
+			err = d.decode(val)
+			if err != nil {
+				return
+			}
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		if major != cborMap {
+			return mismatch(major, v.Type())
+		}
+		var n int
+		n, err = d.count(arg)
+		if err != nil {
+			return
+		}
+		for i := 0; i < n; i++ {
+			var name string
+			err = d.decode(reflect.ValueOf(&name).Elem())
+			if err != nil {
+				return
+			}
+			f := v.FieldByName(name)
+			if f.IsValid() && f.CanSet() {
+				err = d.decode(f)
+			} else {
+				// fields we don't know about are from a newer schema
+				_, err = d.skip()
+			}
+			if err != nil {
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("wire: unsupported type %v", v.Type())
+	}
+	return
+}
+
+// generic decodes the next item into the natural go value for it, using the
+// schema registry to reconstruct typed values
+func (d *cborDecoder) generic() (x interface{}, err error) {
+	leave, err := d.nest()
+	if err != nil {
+		return
+	}
+	defer leave()
+	major, info, arg, err := d.head()
+	if err != nil {
+		return
+	}
+	switch major {
+	case cborUint:
+		if arg <= maxInt {
+			x = int(arg)
+		} else {
+			x = arg
+		}
+	case cborNegInt:
+		if arg < maxInt {
+			x = -1 - int(arg)
+		} else if arg < math.MaxInt64 {
+			x = -1 - int64(arg)
+		} else {
+			err = errors.New("wire: negative integer overflow")
+		}
+	case cborBytes:
+		var b []byte
+		b, err = d.take(arg)
+		x = append([]byte{}, b...)
+	case cborText:
+		var b []byte
+		b, err = d.take(arg)
+		x = string(b)
+	case cborArray:
+		var n int
+		n, err = d.count(arg)
+		if err != nil {
+			return
+		}
+		l := make([]interface{}, n)
+		for i := 0; i < n && err == nil; i++ {
+			l[i], err = d.generic()
+		}
+		x = l
+	case cborMap:
+		var n int
+		n, err = d.count(arg)
+		if err != nil {
+			return
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			var k, val interface{}
+			k, err = d.generic()
+			if err != nil {
+				return
+			}
+			val, err = d.generic()
+			if err != nil {
+				return
+			}
+			m[fmt.Sprintf("%v", k)] = val
+		}
+		x = m
+	case cborTag:
+		switch arg {
+		case cborTagTime:
+			var t time.Time
+			err = d.decode(reflect.ValueOf(&t).Elem())
+			x = t
+		case cborTagObject:
+			var n uint64
+			major, _, n, err = d.head()
+			if err != nil {
+				return
+			}
+			if major != cborArray || n != 2 {
+				err = errors.New("wire: malformed typed value")
+				return
+			}
+			var name string
+			err = d.decode(reflect.ValueOf(&name).Elem())
+			if err != nil {
+				return
+			}
+			t, ok := wireSchemaTypes[name]
+			if !ok {
+				err = fmt.Errorf("%v: %s", ErrUnknownWireSchema, name)
+				return
+			}
+			v := reflect.New(t).Elem()
+			err = d.decode(v)
+			x = v.Interface()
+		default:
+			// tags we don't know about just pass through their content
+			x, err = d.generic()
+		}
+	case cborSimple:
+		switch info {
+		case cborFalse:
+			x = false
+		case cborTrue:
+			x = true
+		case cborNull, cborUndefined:
+			x = nil
+		case cborFloat32:
+			x = float64(math.Float32frombits(uint32(arg)))
+		case cborFloat64:
+			x = math.Float64frombits(arg)
+		default:
+			err = fmt.Errorf("wire: unsupported cbor simple value %d", info)
+		}
+	}
+	return
+}
@@ -17,8 +17,9 @@ type Zome struct {
 	Entries      []EntryDef
 	RibosomeType string
 	Functions    []FunctionDef
-	BridgeFuncs  []string // functions in zome that can be bridged to by fromApp
-	BridgeTo     Hash     // dna Hash of toApp that this zome is a client of
+	BridgeFuncs  []string          // functions in zome that can be bridged to by fromApp
+	BridgeTo     Hash              // dna Hash of toApp that this zome is a client of
+	Modules      map[string]string `json:",omitempty" toml:",omitempty"` // JS modules required by the zome's code, by path in the zome's directory
 }
 
 // GetEntryDef returns the entry def structure
@@ -47,9 +48,9 @@ func (z *Zome) GetPrivateEntryDefs() (privateDefs []EntryDef) {
 
 // GetFunctionDef returns the exposed function spec for the given zome and function
 func (zome *Zome) GetFunctionDef(fnName string) (fn *FunctionDef, err error) {
-	for _, f := range zome.Functions {
-		if f.Name == fnName {
-			fn = &f
+	for i := range zome.Functions {
+		if zome.Functions[i].Name == fnName {
+			fn = &zome.Functions[i]
 			break
 		}
 	}
@@ -69,6 +70,10 @@ func (zome *Zome) CodeFileName() string {
 		return zome.Name + ".zy"
 	} else if zome.RibosomeType == JSRibosomeType {
 		return zome.Name + ".js"
+	} else if zome.RibosomeType == WasmRibosomeType {
+		return zome.Name + ".wasm"
+	} else if zome.RibosomeType == ExecRibosomeType {
+		return zome.Name
 	}
 	panic("unknown ribosome type:" + zome.RibosomeType)
 }
@@ -39,4 +39,10 @@ func TestGetFunctionDef(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(fn.Name, ShouldEqual, "getDNA")
 	})
+	Convey("it should return the zome's own Fn structure rather than a copy", t, func() {
+		fn, err := z.GetFunctionDef("getDNA")
+		So(err, ShouldBeNil)
+		fn2, _ := z.GetFunctionDef("getDNA")
+		So(fn2, ShouldEqual, fn)
+	})
 }
@@ -10,10 +10,10 @@ import (
 	"errors"
 	"fmt"
 	zygo "github.com/glycerine/zygomys/repl"
-	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +30,13 @@ type ZygoRibosome struct {
 	env        *zygo.Glisp
 	lastResult zygo.Sexp
 	library    string
+	guard      *execGuard // limits on the code that is currently running, if any
+	spoiled    bool       // set when running code was aborted, leaving the env unusable
+	strict     bool       // set while running validation callbacks in strict mode
+	validating bool       // set while running validation callbacks
+
+	// the App globals that host functions can change
+	appKeyHash, appAgentStr, appAgentTopHash zygo.SexpStr
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -54,7 +61,7 @@ func (z *ZygoRibosome) boolFn(fnName string, args string) (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.runLimited(GenesisExecution)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -75,6 +82,59 @@ func (z *ZygoRibosome) boolFn(fnName string, args string) (err error) {
 
 }
 
+// Hook runs the lifecycle callback of the given name, if the zome defines it
+func (z *ZygoRibosome) Hook(hook string, args ...string) (err error) {
+	if _, defined := z.env.FindObject(hook); !defined {
+		return
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = `"` + sanitizeZyString(a) + `"`
+	}
+	code := "(" + strings.TrimSpace(hook+" "+strings.Join(quoted, " ")) + ")"
+	z.h.Debug(code)
+	err = z.env.LoadString(code)
+	if err != nil {
+		return
+	}
+	_, err = z.runLimited(ReceiveExecution)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+	}
+	return
+}
+
+// BoolHook runs the callback of the given name, which must return a boolean, and returns
+// false if the zome doesn't define it
+func (z *ZygoRibosome) BoolHook(hook string, args ...string) (result bool, err error) {
+	if _, defined := z.env.FindObject(hook); !defined {
+		return
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = `"` + sanitizeZyString(a) + `"`
+	}
+	code := "(" + strings.TrimSpace(hook+" "+strings.Join(quoted, " ")) + ")"
+	z.h.Debug(code)
+	err = z.env.LoadString(code)
+	if err != nil {
+		return
+	}
+	var r zygo.Sexp
+	r, err = z.runLimited(ReceiveExecution)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", hook, err)
+		return
+	}
+	b, ok := r.(*zygo.SexpBool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", hook, r)
+		return
+	}
+	result = b.Val
+	return
+}
+
 // Receive calls the app receive function for node-to-node messages
 func (z *ZygoRibosome) Receive(from string, msg string) (response string, err error) {
 	var code string
@@ -87,7 +147,7 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 		return
 	}
 	var result interface{}
-	result, err = z.env.Run()
+	result, err = z.runLimited(ReceiveExecution)
 	if err == nil {
 		switch t := result.(type) {
 		case *zygo.SexpStr:
@@ -109,11 +169,16 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`(%s "%s")`, fnName, def.Name)
 	z.h.Debug(code)
+	z.validating = true
+	defer func() { z.validating = false }()
+	if strictValidation(z.h) {
+		defer z.enterStrict()()
+	}
 	err = z.env.LoadString(code)
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.runLimited(ValidateExecution)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -229,10 +294,288 @@ func (z *ZygoRibosome) ValidateAction(action Action, def *EntryDef, pkg *Validat
 		return
 	}
 	z.h.Debug(code)
+	z.validating = true
+	defer func() { z.validating = false }()
+	if strictValidation(z.h) {
+		defer z.enterStrict()()
+	}
 	err = z.runValidate(action.Name(), code)
 	return
 }
 
+// zyResultHashFns are the host functions that return their result or error in a hash of
+// the form (hash result: ...) or (hash error: "...") instead of failing the zygo code
+var zyResultHashFns = map[string]bool{
+	"send":     true,
+	"get":      true,
+	"getLinks": true,
+}
+
+// bindHostFn adds a function of the host API to the env.  Non-deterministic functions return
+// an error instead of running when called during strict validation.
+func (z *ZygoRibosome) bindHostFn(fn *HostFn) {
+	z.env.AddFunction(fn.Name, func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+		if z.strict && fn.NonDeterministic {
+			return zygo.SexpNull, strictValidationErr(fn.Name)
+		}
+		args := fn.Args()
+		err := zyProcessArgs(z, args, zyargs)
+		if err != nil {
+			return zygo.SexpNull, err
+		}
+		var r interface{}
+		r, err = fn.run(z.h, z.zome, args, z.validating)
+		if err == nil && fn.UpdatesApp {
+			z.appKeyHash.S = z.h.nodeIDStr
+			z.appAgentTopHash.S = z.h.agentTopHash.String()
+			z.appAgentStr.S = string(z.h.Agent().Identity())
+		}
+		var result zygo.Sexp = zygo.SexpNull
+		if err == nil {
+			result, err = z.toSexp(env, r)
+		}
+		if zyResultHashFns[fn.Name] {
+			return makeResult(env, result, err)
+		}
+		if err != nil {
+			return zygo.SexpNull, err
+		}
+		return result, nil
+	})
+}
+
+// toSexp converts the result of a host function to a zygo value
+func (z *ZygoRibosome) toSexp(env *zygo.Glisp, r interface{}) (result zygo.Sexp, err error) {
+	switch t := r.(type) {
+	case nil:
+		result = zygo.SexpNull
+	case string:
+		result = &zygo.SexpStr{S: t}
+	case bool:
+		result = &zygo.SexpBool{Val: t}
+	case int:
+		result = &zygo.SexpInt{Val: int64(t)}
+	case int64:
+		result = &zygo.SexpInt{Val: t}
+	case float64:
+		result = &zygo.SexpFloat{Val: t}
+	case []string:
+		items := make([]zygo.Sexp, len(t))
+		for i := range t {
+			items[i] = &zygo.SexpStr{S: t[i]}
+		}
+		result = env.NewSexpArray(items)
+	case []interface{}:
+		items := make([]zygo.Sexp, len(t))
+		for i := range t {
+			items[i], err = z.toSexp(env, t[i])
+			if err != nil {
+				return
+			}
+		}
+		result = env.NewSexpArray(items)
+	case map[string]interface{}:
+		var hash *zygo.SexpHash
+		hash, err = zygo.MakeHash(nil, "hash", env)
+		if err != nil {
+			return
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var v zygo.Sexp
+			v, err = z.toSexp(env, t[k])
+			if err == nil {
+				err = hash.HashSet(env.MakeSymbol(k), v)
+			}
+			if err != nil {
+				return
+			}
+		}
+		result = hash
+	case *hostQueryResult:
+		result, err = zyQuerySexp(env, t)
+	case *hostGetResult:
+		result, err = zyGetSexp(env, t)
+	case hostSignature:
+		result = &zygo.SexpStr{S: string(t)}
+	case *hostLinksResult:
+		// links are returned as their JSON
+		var j []byte
+		j, err = json.Marshal(t.links)
+		if err == nil {
+			result = &zygo.SexpStr{S: string(j)}
+		}
+	default:
+		var j []byte
+		j, err = json.Marshal(r)
+		if err == nil {
+			result = &zygo.SexpStr{S: string(j)}
+		}
+	}
+	return
+}
+
+func zyQuerySexp(env *zygo.Glisp, q *hostQueryResult) (zygo.Sexp, error) {
+	var err error
+	results := make([]zygo.Sexp, len(q.results))
+	for i, result := range q.results {
+		var sexp zygo.Sexp
+		var hashSexp, entrySexp *zygo.SexpStr
+		var headerSexp *zygo.SexpHash
+		var returnCount int
+		if q.options.Return.Hashes {
+			returnCount += 1
+			hashSexp = &zygo.SexpStr{S: result.Header.EntryLink.String()}
+			sexp = hashSexp
+		}
+		if q.options.Return.Headers {
+			returnCount += 1
+			headerSexp, err = zygo.MakeHash(nil, "hash", env)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			sexp = headerSexp
+			// TODO REFACTOR!!
+			err = headerSexp.HashSet(env.MakeSymbol("Time"), &zygo.SexpStr{S: fmt.Sprintf("%v", result.Header.Time)})
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			err = headerSexp.HashSet(env.MakeSymbol("Type"), &zygo.SexpStr{S: result.Header.Type})
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			err = headerSexp.HashSet(env.MakeSymbol("EntryLink"), &zygo.SexpStr{S: result.Header.EntryLink.String()})
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			err = headerSexp.HashSet(env.MakeSymbol("HeaderLink"), &zygo.SexpStr{S: result.Header.HeaderLink.String()})
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			err = headerSexp.HashSet(env.MakeSymbol("TypeLink"), &zygo.SexpStr{S: result.Header.TypeLink.String()})
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+		}
+
+		if q.options.Return.Entries {
+			returnCount += 1
+
+			def := q.defs[result.Header.Type]
+			r := result.Entry.Content()
+			var content string
+			switch def.DataFormat {
+			case DataFormatRawZygo:
+				fallthrough
+			case DataFormatRawJS:
+				fallthrough
+			case DataFormatString:
+				fallthrough
+			case DataFormatLinks:
+				fallthrough
+			case DataFormatJSON:
+				content = r.(string)
+			case DataFormatSysAgent:
+				j, err := json.Marshal(r.(AgentEntry))
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+				content = string(j)
+			default:
+				return zygo.SexpNull, fmt.Errorf("data format not implemented: %s", def.DataFormat)
+			}
+			entrySexp = &zygo.SexpStr{S: content}
+			sexp = entrySexp
+
+		}
+		if returnCount > 1 {
+			var result *zygo.SexpHash
+			result, err = zygo.MakeHash(nil, "hash", env)
+			if err == nil && headerSexp != nil {
+				err = result.HashSet(env.MakeSymbol("Header"), headerSexp)
+			}
+			if err == nil && hashSexp != nil {
+				err = result.HashSet(env.MakeSymbol("Hash"), hashSexp)
+			}
+			if err == nil && entrySexp != nil {
+				err = result.HashSet(env.MakeSymbol("Entry"), entrySexp)
+			}
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			sexp = result
+		}
+		results[i] = sexp
+	}
+
+	return env.NewSexpArray(results), nil
+}
+
+// zyGetSexp returns what get found, with the entry as its JSON
+func zyGetSexp(env *zygo.Glisp, g *hostGetResult) (resultValue zygo.Sexp, err error) {
+	resultValue = zygo.SexpNull
+	var entryStr string
+	var singleValueReturn bool
+	if g.mask&GetMaskEntry != 0 {
+		j, err := json.Marshal(g.resp.Entry.Content())
+		if err == nil {
+			if GetMaskEntry == g.mask {
+				singleValueReturn = true
+				resultValue = &zygo.SexpStr{S: string(j)}
+			} else {
+				entryStr = string(j)
+			}
+		}
+	}
+	if g.mask&GetMaskEntryType != 0 {
+		if GetMaskEntryType == g.mask {
+			singleValueReturn = true
+			resultValue = &zygo.SexpStr{S: g.resp.EntryType}
+		}
+	}
+	var zSources *zygo.SexpArray
+	if g.mask&GetMaskSources != 0 {
+		sources := make([]zygo.Sexp, len(g.resp.Sources))
+		for i := range g.resp.Sources {
+			sources[i] = &zygo.SexpStr{S: g.resp.Sources[i]}
+		}
+		zSources = env.NewSexpArray(sources)
+		if GetMaskSources == g.mask {
+			singleValueReturn = true
+			resultValue = zSources
+		}
+	}
+	if !singleValueReturn {
+		// build the return object
+		var respObj *zygo.SexpHash
+		respObj, err = zygo.MakeHash(nil, "hash", env)
+		if err == nil {
+			resultValue = respObj
+			if g.mask&GetMaskEntry != 0 {
+				err = respObj.HashSet(env.MakeSymbol("Entry"), &zygo.SexpStr{S: entryStr})
+			}
+			if err == nil && g.mask&GetMaskEntryType != 0 {
+				err = respObj.HashSet(env.MakeSymbol("EntryType"), &zygo.SexpStr{S: g.resp.EntryType})
+			}
+			if err == nil && g.mask&GetMaskSources != 0 {
+				err = respObj.HashSet(env.MakeSymbol("Sources"), zSources)
+			}
+		}
+	}
+	return
+}
+
+// enterStrict puts the ribosome into strict validation mode and returns the function that
+// leaves it.  The sandboxed env has no clock or random functions so only the API needs guarding.
+func (z *ZygoRibosome) enterStrict() (leave func()) {
+	z.strict = true
+	return func() { z.strict = false }
+}
+
 func mkZySources(sources []string) (srcs string) {
 	var err error
 	var b []byte
@@ -269,7 +612,7 @@ func (z *ZygoRibosome) runValidate(fnName string, code string) (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.runLimited(ValidateExecution)
 	if err != nil {
 		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
@@ -341,7 +684,7 @@ func (z *ZygoRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	if err != nil {
 		return
 	}
-	result, err = z.env.Run()
+	result, err = z.runLimited(CallExecution)
 	if err == nil {
 		switch fn.CallingType {
 		case STRING_CALLING:
@@ -377,6 +720,7 @@ const (
 		`(def HC_Status_Rejected ` + StatusRejectedVal + ")" +
 		`(def HC_Status_Deleted ` + StatusDeletedVal + ")" +
 		`(def HC_Status_Modified ` + StatusModifiedVal + ")" +
+		`(def HC_Status_Warning ` + StatusWarningVal + ")" +
 		`(def HC_Status_Any ` + StatusAnyVal + ")" +
 		`(def HC_GetMask_Default ` + GetMaskDefaultStr + ")" +
 		`(def HC_GetMask_Entry ` + GetMaskEntryStr + ")" +
@@ -471,7 +815,7 @@ func zyProcessArgs(z *ZygoRibosome, args []Arg, zyArgs []zygo.Sexp) (err error)
 			case *zygo.SexpStr:
 				args[i].value = t.S
 			case *zygo.SexpHash:
-				args[i].value = cleanZygoJson(zygo.SexpToJson(t))
+				args[i].value = json.RawMessage(cleanZygoJson(zygo.SexpToJson(t)))
 			default:
 				return argErr("string or hash", i+1, args[i])
 			}
@@ -566,682 +910,97 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z := ZygoRibosome{
 		h:    h,
 		zome: zome,
-		env:  zygo.NewGlispSandbox(),
 	}
-
-	z.env.AddFunction("version",
-		func(env *zygo.Glisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
-			return &zygo.SexpStr{S: VersionStr}, nil
-		})
-
-	addExtras(&z)
-
-	var appKeyHash, appAgentStr, appAgentHash, appAgentTopHash zygo.SexpStr
-	if h != nil {
-		appKeyHash = zygo.SexpStr{S: h.nodeIDStr}
-		appAgentStr = zygo.SexpStr{S: sanitizeZyString(string(h.Agent().Identity()))}
-		appAgentHash = zygo.SexpStr{S: h.agentHash.String()}
-		appAgentTopHash = zygo.SexpStr{S: h.agentTopHash.String()}
+	err = z.load()
+	if err != nil {
+		return
 	}
+	n = &z
+	return
+}
 
-	// use a closure so that the registered zygo function can call Expose on the correct ZygoRibosome obj
-
-	z.env.AddFunction("property",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionProperty{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			a.prop = args[0].value.(string)
-
-			var p interface{}
-			p, err = a.Do(h)
-
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			result := zygo.SexpStr{S: p.(string)}
-			return &result, err
-		})
-
-	z.env.AddFunction("debug",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionDebug{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			a.msg = args[0].value.(string)
-			a.Do(h)
-			return zygo.SexpNull, err
-		})
-
-	z.env.AddFunction("makeHash",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionMakeHash{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			a.entryType = args[0].value.(string)
-			a.entry = &GobEntry{C: args[1].value.(string)}
-			var r interface{}
-			r, err = a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			var entryHash Hash
-			if r != nil {
-				entryHash = r.(Hash)
-			}
-			var result = zygo.SexpStr{S: entryHash.String()}
-			return &result, nil
-		})
-
-	z.env.AddFunction("getBridges",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionGetBridges{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			r, err := a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			var zbridges *zygo.SexpArray
-
-			var bridges []zygo.Sexp
-			for _, b := range r.([]Bridge) {
-				var bridge *zygo.SexpHash
-				bridge, err = zygo.MakeHash(nil, "hash", env)
-				if err != nil {
-					return zygo.SexpNull, err
-				}
-				if b.Side == BridgeTo {
-					err = bridge.HashSet(env.MakeSymbol("Side"), &zygo.SexpInt{Val: int64(b.Side)})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = bridge.HashSet(env.MakeSymbol("Token"), &zygo.SexpStr{S: b.Token})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-				} else {
-					err = bridge.HashSet(env.MakeSymbol("Side"), &zygo.SexpInt{Val: int64(b.Side)})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = bridge.HashSet(env.MakeSymbol("ToApp"), &zygo.SexpStr{S: b.ToApp.String()})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-				}
-				bridges = append(bridges, bridge)
-			}
-			zbridges = env.NewSexpArray(bridges)
-			return zbridges, err
-		})
-
-	z.env.AddFunction("send",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionSend{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			msg := args[1].value.(map[string]interface{})
-			var j []byte
-			j, err = json.Marshal(msg)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			a.msg.ZomeType = z.zome.Name
-			a.msg.Body = string(j)
-
-			if args[2].value != nil {
-				a.options = &SendOptions{}
-				opts := args[2].value.(map[string]interface{})
-				cbmap, ok := opts["Callback"]
-				if ok {
-					callback := Callback{zomeType: zome.Name}
-					v, ok := cbmap.(map[string]interface{})["Function"]
-					if !ok {
-						return zygo.SexpNull, errors.New("callback option requires Function")
-					}
-					callback.Function = v.(string)
-					v, ok = cbmap.(map[string]interface{})["ID"]
-					if !ok {
-						return zygo.SexpNull, errors.New("callback option requires ID")
-					}
-					callback.ID = v.(string)
-					a.options.Callback = &callback
-				}
-				timeout, ok := opts["Timeout"]
-				if ok {
-					a.options.Timeout = int(timeout.(int64))
-				}
-			}
-
-			var r interface{}
-			r, err = a.Do(h)
-			var resp zygo.Sexp
-			if err == nil {
-				switch t := r.(type) {
-				case string:
-					resp = &zygo.SexpStr{S: t}
-				case nil:
-					resp = zygo.SexpNull
-				default:
-					return zygo.SexpNull, errors.New("send should return nil or string")
-				}
-			}
-			return makeResult(env, resp, err)
-		})
-
-	z.env.AddFunction("call",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionCall{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			a.zome = args[0].value.(string)
-			var zome *Zome
-			zome, err = h.GetZome(a.zome)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			a.function = args[1].value.(string)
-			var fn *FunctionDef
-			fn, err = zome.GetFunctionDef(a.function)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			if fn.CallingType == JSON_CALLING {
-				switch zyargs[2].(type) {
-				case *zygo.SexpHash:
-					a.args = args[2].value
-				default:
-					return zygo.SexpNull, errors.New("function calling type requires hash argument type")
-				}
-
-			} else {
-				a.args = args[2].value.(string)
-			}
-			var r interface{}
-			r, err = a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			return &zygo.SexpStr{S: r.(string)}, err
-		})
-
-	z.env.AddFunction("bridge",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionBridge{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			hash := args[0].value.(Hash)
-			a.token, a.url, err = h.GetBridgeToken(hash)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			a.zome = args[1].value.(string)
-			a.function = args[2].value.(string)
-			a.args = args[3].value.(string)
-
-			var r interface{}
-			r, err = a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			return &zygo.SexpStr{S: r.(string)}, err
-		})
-
-	z.env.AddFunction("commit",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			var a Action = &ActionCommit{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			entryType := args[0].value.(string)
-			entry := args[1].value.(string)
-			var r interface{}
-			e := GobEntry{C: entry}
-			r, err = NewCommitAction(entryType, &e).Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			var entryHash Hash
-			if r != nil {
-				entryHash = r.(Hash)
-			}
-			var result = zygo.SexpStr{S: entryHash.String()}
-			return &result, nil
-		})
-
-	z.env.AddFunction("query",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionQuery{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			if len(zyargs) == 1 {
-				options := QueryOptions{}
-				var j []byte
-				j, err = json.Marshal(args[0].value)
-				if err != nil {
-					return zygo.SexpNull, err
-				}
-				z.h.Debugf("Query options: %s", string(j))
-				err = json.Unmarshal(j, &options)
-				if err != nil {
-					return zygo.SexpNull, err
-				}
-				a.options = &options
-			}
-
-			r, err := a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			qr := r.([]QueryResult)
-
-			defs := make(map[string]*EntryDef)
-			results := make([]zygo.Sexp, len(qr))
-			for i, result := range qr {
-				var sexp zygo.Sexp
-				var hashSexp, entrySexp *zygo.SexpStr
-				var headerSexp *zygo.SexpHash
-				var returnCount int
-				if a.options.Return.Hashes {
-					returnCount += 1
-					hashSexp = &zygo.SexpStr{S: result.Header.EntryLink.String()}
-					sexp = hashSexp
-				}
-				if a.options.Return.Headers {
-					returnCount += 1
-					headerSexp, err = zygo.MakeHash(nil, "hash", env)
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					sexp = headerSexp
-					// TODO REFACTOR!!
-					err = headerSexp.HashSet(env.MakeSymbol("Time"), &zygo.SexpStr{S: fmt.Sprintf("%v", result.Header.Time)})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = headerSexp.HashSet(env.MakeSymbol("Type"), &zygo.SexpStr{S: result.Header.Type})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = headerSexp.HashSet(env.MakeSymbol("EntryLink"), &zygo.SexpStr{S: result.Header.EntryLink.String()})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = headerSexp.HashSet(env.MakeSymbol("HeaderLink"), &zygo.SexpStr{S: result.Header.HeaderLink.String()})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					err = headerSexp.HashSet(env.MakeSymbol("TypeLink"), &zygo.SexpStr{S: result.Header.TypeLink.String()})
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-				}
-
-				if a.options.Return.Entries {
-					returnCount += 1
-
-					var def *EntryDef
-					var ok bool
-					def, ok = defs[result.Header.Type]
-					if !ok {
-						_, def, err = h.GetEntryDef(result.Header.Type)
-						if err != nil {
-							return zygo.SexpNull, err
-						}
-						defs[result.Header.Type] = def
-					}
-					r := result.Entry.Content()
-					var content string
-					switch def.DataFormat {
-					case DataFormatRawZygo:
-						fallthrough
-					case DataFormatRawJS:
-						fallthrough
-					case DataFormatString:
-						fallthrough
-					case DataFormatLinks:
-						fallthrough
-					case DataFormatJSON:
-						content = result.Entry.Content().(string)
-					case DataFormatSysAgent:
-						j, err := json.Marshal(r.(AgentEntry))
-						if err != nil {
-							return zygo.SexpNull, err
-						}
-						content = string(j)
-					default:
-						return zygo.SexpNull, fmt.Errorf("data format not implemented: %s", def.DataFormat)
-					}
-					entrySexp = &zygo.SexpStr{S: content}
-					sexp = entrySexp
-
-				}
-				if returnCount > 1 {
-					var result *zygo.SexpHash
-					result, err = zygo.MakeHash(nil, "hash", env)
-					if err == nil && headerSexp != nil {
-						err = result.HashSet(env.MakeSymbol("Header"), headerSexp)
-					}
-					if err == nil && hashSexp != nil {
-						err = result.HashSet(env.MakeSymbol("Hash"), hashSexp)
-					}
-					if err == nil && entrySexp != nil {
-						err = result.HashSet(env.MakeSymbol("Entry"), entrySexp)
-					}
-					if err != nil {
-						return zygo.SexpNull, err
-					}
-					sexp = result
-				}
-				results[i] = sexp
-			}
-
-			return env.NewSexpArray(results), nil
-		})
-
-	z.env.AddFunction("get",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			var a Action = &ActionGet{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			options := GetOptions{StatusMask: StatusDefault, GetMask: GetMaskDefault}
-			if len(zyargs) == 2 {
-				opts := args[1].value.(map[string]interface{})
-				mask, ok := opts["StatusMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int StatusMask attribute, got %T", mask)
-					}
-					options.StatusMask = int(maskval)
-				}
-				mask, ok = opts["GetMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int GetMask attribute, got %T", mask)
-					}
-					options.GetMask = int(maskval)
-				}
-				local, ok := opts["Local"]
-				if ok {
-					options.Local = local.(bool)
-				}
-
-			}
-			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
-
-			var r interface{}
-			r, err = NewGetAction(req, &options).Do(h)
-			mask := options.GetMask
-			if mask == GetMaskDefault {
-				mask = GetMaskEntry
-			}
-			var resultValue zygo.Sexp
-			resultValue = zygo.SexpNull
-			if err == nil {
-				getResp := r.(GetResp)
-				var entryStr string
-				var singleValueReturn bool
-				if mask&GetMaskEntry != 0 {
-					j, err := json.Marshal(getResp.Entry.Content())
-					if err == nil {
-						if GetMaskEntry == mask {
-							singleValueReturn = true
-							resultValue = &zygo.SexpStr{S: string(j)}
-						} else {
-							entryStr = string(j)
-						}
-					}
-				}
-				if mask&GetMaskEntryType != 0 {
-					if GetMaskEntryType == mask {
-						singleValueReturn = true
-						resultValue = &zygo.SexpStr{S: getResp.EntryType}
-					}
-				}
-				var zSources *zygo.SexpArray
-				if mask&GetMaskSources != 0 {
-					sources := make([]zygo.Sexp, len(getResp.Sources))
-					for i := range getResp.Sources {
-						sources[i] = &zygo.SexpStr{S: getResp.Sources[i]}
-					}
-					zSources = env.NewSexpArray(sources)
-					if GetMaskSources == mask {
-						singleValueReturn = true
-						resultValue = zSources
-					}
-				}
-				if err == nil && !singleValueReturn {
-					// build the return object
-					var respObj *zygo.SexpHash
-					respObj, err = zygo.MakeHash(nil, "hash", env)
-					if err == nil {
-						resultValue = respObj
-						if mask&GetMaskEntry != 0 {
-							err = respObj.HashSet(env.MakeSymbol("Entry"), &zygo.SexpStr{S: entryStr})
-						}
-						if err == nil && mask&GetMaskEntryType != 0 {
-							err = respObj.HashSet(env.MakeSymbol("EntryType"), &zygo.SexpStr{S: getResp.EntryType})
-						}
-						if err == nil && mask&GetMaskSources != 0 {
-							err = respObj.HashSet(env.MakeSymbol("Sources"), zSources)
-						}
-					}
-				}
-			}
-			return makeResult(env, resultValue, err)
-		})
-
-	z.env.AddFunction("update",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			var a Action = &ActionMod{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			entryType := args[0].value.(string)
-			entryStr := args[1].value.(string)
-			replaces := args[2].value.(Hash)
-
-			entry := GobEntry{C: entryStr}
-			resp, err := NewModAction(entryType, &entry, replaces).Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			var entryHash Hash
-			if resp != nil {
-				entryHash = resp.(Hash)
-			}
-			var result = zygo.SexpStr{S: entryHash.String()}
-			return &result, nil
-		})
-
-	z.env.AddFunction("updateAgent",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			a := &ActionModAgent{}
-			//		var a Action = &ActionModAgent{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-
-			opts := args[0].value.(map[string]interface{})
-			id, idok := opts["Identity"]
-			if idok {
-				a.Identity = AgentIdentity(id.(string))
-			}
-			rev, revok := opts["Revocation"]
-			if revok {
-				a.Revocation = rev.(string)
-			}
-
-			resp, err := a.Do(h)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			var agentEntryHash Hash
-			if resp != nil {
-				agentEntryHash = resp.(Hash)
-			}
-
-			if revok {
-				appKeyHash.S = h.nodeIDStr
-			}
-
-			// there's always a new agent entry
-			appAgentTopHash.S = h.agentTopHash.String()
-
-			// but not always a new identity to update
-			if idok {
-				appAgentStr.S = string(a.Identity)
-			}
-			var result = zygo.SexpStr{S: agentEntryHash.String()}
-			return &result, nil
-		})
-
-	z.env.AddFunction("remove",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			var a Action = &ActionDel{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			entry := DelEntry{
-				Hash:    args[0].value.(Hash),
-				Message: args[1].value.(string),
-			}
-			header, err := h.chain.GetEntryHeader(entry.Hash)
-			if err == nil {
-				resp, err := NewDelAction(header.Type, entry).Do(h)
-				if err != nil {
-					return zygo.SexpNull, err
-				}
-				var entryHash Hash
-				if resp != nil {
-					entryHash = resp.(Hash)
-				}
-				return &zygo.SexpStr{S: entryHash.String()}, err
-			}
-			return zygo.SexpNull, err
-		})
+// load builds a fresh env with the API and App globals and runs the library and zome
+// code in it
+func (z *ZygoRibosome) load() (err error) {
+	h := z.h
+	z.env = zygo.NewGlispSandbox()
+	z.lastResult = nil
+	z.spoiled = false
+
+	z.env.AddPreHook(func(env *zygo.Glisp, name string, args []zygo.Sexp) {
+		if z.guard != nil {
+			z.guard.step()
+		}
+	})
 
-	z.env.AddFunction("getLinks",
-		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
-			var a Action = &ActionGetLinks{}
-			args := a.Args()
-			err := zyProcessArgs(&z, args, zyargs)
-			if err != nil {
-				return zygo.SexpNull, err
-			}
-			base := args[0].value.(Hash)
-			tag := args[1].value.(string)
-
-			options := GetLinksOptions{Load: false, StatusMask: StatusLive}
-			if len(zyargs) == 3 {
-				opts := args[2].value.(map[string]interface{})
-				load, ok := opts["Load"]
-				if ok {
-					loadval, ok := load.(bool)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting boolean Load attribute in object, got %T", load)
-					}
-					options.Load = loadval
-				}
-				mask, ok := opts["StatusMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int StatusMask attribute in object, got %T", mask)
-					}
-					options.StatusMask = int(maskval)
-				}
-			}
+	addExtras(z)
 
-			var r interface{}
-			r, err = NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
-			var resultValue zygo.Sexp
-			if err == nil {
-				response := r.(*LinkQueryResp)
-				resultValue = zygo.SexpNull
-				var j []byte
-				j, err = json.Marshal(response.Links)
-				if err == nil {
-					resultValue = &zygo.SexpStr{S: string(j)}
-				}
-			}
-			return makeResult(env, resultValue, err)
-		})
+	for i := range HostFns {
+		z.bindHostFn(&HostFns[i])
+	}
 
 	l := ZygoLibrary
 	if h != nil {
+		z.appKeyHash.S = h.nodeIDStr
+		z.appAgentStr.S = sanitizeZyString(string(h.Agent().Identity()))
+		z.appAgentTopHash.S = h.agentTopHash.String()
 		z.env.AddGlobal("App_Name", &zygo.SexpStr{S: h.Name()})
 		z.env.AddGlobal("App_DNA_Hash", &zygo.SexpStr{S: h.dnaHash.String()})
-		z.env.AddGlobal("App_Key_Hash", &appKeyHash)
-		z.env.AddGlobal("App_Agent_String", &appAgentStr)
-		z.env.AddGlobal("App_Agent_Hash", &appAgentHash)
-		z.env.AddGlobal("App_Agent_TopHash", &appAgentTopHash)
+		z.env.AddGlobal("App_Key_Hash", &z.appKeyHash)
+		z.env.AddGlobal("App_Agent_String", &z.appAgentStr)
+		z.env.AddGlobal("App_Agent_Hash", &zygo.SexpStr{S: h.agentHash.String()})
+		z.env.AddGlobal("App_Agent_TopHash", &z.appAgentTopHash)
 	}
 	z.library = l
 
-	_, err = z.Run(l + zome.Code)
-	if err != nil {
-		return
+	_, err = z.Run(l + z.zome.Code)
+	return
+}
+
+// Reset puts the ribosome back into the state it was in right after loading the zome code.
+// Zygo envs can't be copied the way the JS vm is, so the env is rebuilt from the library and
+// zome code, which also recovers an env left unusable by aborted code.
+func (z *ZygoRibosome) Reset() (err error) {
+	z.env.Clear()
+	err = z.load()
+	return
+}
+
+// Close does nothing as the env holds nothing but memory
+func (z *ZygoRibosome) Close() error {
+	return nil
+}
+
+// runLimited runs the loaded code under the DNA's execution limits for the given kind of
+// execution.  The guard is stepped by a pre hook on every function call.
+func (z *ZygoRibosome) runLimited(kind string) (result zygo.Sexp, err error) {
+	g := newExecGuard(z.h, z.zome, kind)
+	if g == nil {
+		return z.env.Run()
 	}
-	n = &z
+	z.guard = g
+	defer func() {
+		z.guard = nil
+		if r := recover(); r != nil && r != g.hit {
+			panic(r)
+		}
+		if g.hit != nil {
+			z.spoiled = true
+			result = nil
+			err = g.hit
+		}
+	}()
+	result, err = z.env.Run()
 	return
 }
 
 // Run executes zygo code
 func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
+	return z.run("", code)
+}
+
+// run executes zygo code under the limits for the given kind of execution
+func (z *ZygoRibosome) run(kind string, code string) (result interface{}, err error) {
 	c := fmt.Sprintf("(begin %s %s)", z.library, code)
 	err = z.env.LoadString(c)
 	if err != nil {
@@ -1249,7 +1008,7 @@ func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 		return
 	}
 	var sexp zygo.Sexp
-	sexp, err = z.env.Run()
+	sexp, err = z.runLimited(kind)
 	if err != nil {
 		err = errors.New("Zygomys exec error: " + err.Error())
 		return
@@ -1322,6 +1081,6 @@ func addExtras(z *ZygoRibosome) {
 func (z *ZygoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
 	code := fmt.Sprintf(`(%s (unjson (raw "%s")) "%s")`, callback, sanitizeZyString(response.Body), sanitizeZyString(callbackID))
 	z.h.Debugf("Calling %s\n", code)
-	result, err = z.Run(code)
+	result, err = z.run(CallExecution, code)
 	return
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	zygo "github.com/glycerine/zygomys/repl"
+	b58 "github.com/jbenet/go-base58"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
@@ -160,6 +162,52 @@ func TestNewZygoRibosome(t *testing.T) {
 			So(hash1.String(), ShouldEqual, profileHash.String())
 		})
 
+		Convey("verifyCountersign", func() {
+			encode := func(w Warrant) string {
+				data, _ := w.Encode()
+				return string(data)
+			}
+			other, key := makePeer("other")
+			w := &CountersignWarrant{EntryType: "oddNumbers", EntryHash: h.nodeIDStr, Signers: []string{h.nodeIDStr, peer.IDB58Encode(other)}}
+			w.sign(h.agent.PrivKey())
+			_, err = z.Run(fmt.Sprintf(`(verifyCountersign %q)`, encode(w)))
+			So(err.Error(), ShouldContainSubstring, "countersignature is missing signatures")
+
+			w.sign(key)
+			_, err = z.Run(fmt.Sprintf(`(hget (verifyCountersign %q) "EntryType")`, encode(w)))
+			So(err, ShouldBeNil)
+			z := v.(*ZygoRibosome)
+			So(z.lastResult.(*zygo.SexpStr).S, ShouldEqual, "oddNumbers")
+		})
+
+		Convey("encrypt and decrypt", func() {
+			_, err = z.Run(`(decrypt (encrypt App_Key_Hash "some secret"))`)
+			So(err, ShouldBeNil)
+			z := v.(*ZygoRibosome)
+			So(z.lastResult.(*zygo.SexpStr).S, ShouldEqual, "some secret")
+
+			_, err = z.Run(`(decrypt "bm90IHNlYWxlZA==")`)
+			So(err.Error(), ShouldContainSubstring, ErrDecryptionFailed.Error())
+		})
+
+		Convey("sign and verifySignature", func() {
+			_, err = z.Run(`(sign "3")`)
+			So(err, ShouldBeNil)
+			z := v.(*ZygoRibosome)
+			sig, err := h.agent.PrivKey().Sign([]byte("3"))
+			So(err, ShouldBeNil)
+			So(z.lastResult.(*zygo.SexpStr).S, ShouldEqual, string(sig))
+			pubKey, err := ic.MarshalPublicKey(h.agent.PubKey())
+			So(err, ShouldBeNil)
+
+			_, err = z.Run(fmt.Sprintf(`(verifySignature "%s" "3" "%s")`, b58.Encode(sig), b58.Encode(pubKey)))
+			So(err, ShouldBeNil)
+			So(z.lastResult.(*zygo.SexpBool).Val, ShouldBeTrue)
+			_, err = z.Run(fmt.Sprintf(`(verifySignature "%s" "34" "%s")`, b58.Encode(sig), b58.Encode(pubKey)))
+			So(err, ShouldBeNil)
+			So(z.lastResult.(*zygo.SexpBool).Val, ShouldBeFalse)
+		})
+
 		Convey("getBridges", func() {
 			_, err = z.Run(`(getBridges)`)
 			So(err, ShouldBeNil)
@@ -344,6 +392,40 @@ func TestZyReceive(t *testing.T) {
 	})
 }
 
+func TestZyHook(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	Convey("it should call a lifecycle callback the zome defines", t, func() {
+		v, _ := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(def held "") (defn onHeld [hash type] (set held (concat hash ":" type)))`})
+		err := v.Hook(HeldHook, "QmFoo", "evenNumbers")
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		_, err = z.Run("held")
+		So(err, ShouldBeNil)
+		So(z.lastResult.(*zygo.SexpStr).S, ShouldEqual, "QmFoo:evenNumbers")
+	})
+
+	Convey("it should skip lifecycle callbacks the zome doesn't define", t, func() {
+		v, _ := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(+ 1 1)`})
+		So(v.Hook(ShutdownHook), ShouldBeNil)
+	})
+
+	Convey("it should return the answer of boolean callbacks, false if not defined", t, func() {
+		v, _ := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn onCountersignProposal [from type entry] (== entry "yes"))`})
+		ok, err := v.BoolHook(CountersignProposalHook, "QmFoo", "evenNumbers", "yes")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = v.BoolHook(CountersignProposalHook, "QmFoo", "evenNumbers", "no")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		v, _ = NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(+ 1 1)`})
+		ok, err = v.BoolHook(CountersignProposalHook)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
 func TestZybuildValidate(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -493,6 +575,19 @@ func TestZySanitize(t *testing.T) {
 	})
 }
 
+func TestZyEmit(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	Convey("emit should send an event to the subscribers", t, func() {
+		events, unsubscribe := h.SubscribeEvents()
+		defer unsubscribe()
+		v, err := NewZygoRibosome(h, &Zome{Name: "zyZome", RibosomeType: ZygoRibosomeType, Code: `(emit "cow" "moo")`})
+		So(err, ShouldBeNil)
+		So(v, ShouldNotBeNil)
+		So(<-events, ShouldResemble, AppEvent{Name: "cow", Zome: "zyZome", Payload: "moo"})
+	})
+}
+
 func TestZygoExposeCall(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -747,6 +842,11 @@ func TestZygoDHT(t *testing.T) {
 		So(string(payload.([]byte)), ShouldEqual, "some revocation data")
 		So(fmt.Sprintf("%v", entry.Content().(AgentEntry).PublicKey), ShouldEqual, fmt.Sprintf("%v", newPubKey))
 
+		// the new key should be saved for the chain
+		a, err := LoadAgent(h.rootPath)
+		So(err, ShouldBeNil)
+		So(ic.KeyEqual(a.PrivKey(), h.agent.PrivKey()), ShouldBeTrue)
+
 		// the new Key should be available on the DHT
 		newKey, _ := NewHash(h.nodeIDStr)
 		data, _, _, _, err := h.dht.get(newKey, StatusDefault, GetMaskDefault)
@@ -778,6 +878,12 @@ func TestZygoDHT(t *testing.T) {
 		So(len(peerList.Records), ShouldEqual, 1)
 		So(peerList.Records[0].ID, ShouldEqual, oldPeer)
 		So(h.node.IsBlocked(oldPeer), ShouldBeTrue)
+
+		// and its key revoked as of the new agent entry
+		at, revoked, err := h.dht.keyRevokedAt(oldPeer)
+		So(err, ShouldBeNil)
+		So(revoked, ShouldBeTrue)
+		So(at.Equal(header.Time), ShouldBeTrue)
 	})
 
 	Convey("updateAgent function should update library values", t, func() {
@@ -996,3 +1102,64 @@ func TestZyProcessArgs(t *testing.T) {
 		So(args[0].value.(string), ShouldEqual, `{"H":"fakehashvalue","I":314}`)
 	})
 }
+
+func TestZyExecutionLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.ExecutionLimits = &ExecutionLimits{}
+	defer func() { h.nucleus.dna.ExecutionLimits = nil }()
+
+	zome := &Zome{Name: "looper", RibosomeType: ZygoRibosomeType,
+		Code:      `(defn receive [from msg] (for [(def i 0) true (set i (+ i 1))] i)) (defn loop [x] (for [(def i 0) true (set i (+ i 1))] i))`,
+		Functions: []FunctionDef{{Name: "loop", CallingType: STRING_CALLING}},
+	}
+	fn := &zome.Functions[0]
+
+	Convey("it should stop code that runs past the timeout", t, func() {
+		h.nucleus.dna.ExecutionLimits.Receive.Timeout = 100
+		z, err := NewZygoRibosome(h, zome)
+		So(err, ShouldBeNil)
+		_, err = z.Receive("fakehash", `{}`)
+		So(err.Error(), ShouldEqual, "receive code in zome looper stopped: exceeded time limit")
+	})
+
+	Convey("it should stop code that runs past the step limit", t, func() {
+		h.nucleus.dna.ExecutionLimits.Call.MaxSteps = 1000
+		z, err := NewZygoRibosome(h, zome)
+		So(err, ShouldBeNil)
+		_, err = z.Call(fn, "")
+		So(err.Error(), ShouldEqual, "call code in zome looper stopped: exceeded step limit")
+
+		// the ribosome is usable again after being reset
+		err = z.(*ZygoRibosome).Reset()
+		So(err, ShouldBeNil)
+		_, err = z.Run("(+ 1 1)")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestZyStrictValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.nucleus.dna.StrictValidation = true
+	defer func() { h.nucleus.dna.StrictValidation = false }()
+
+	hdr := mkTestHeader("evenNumbers")
+	def := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+	a.header = &hdr
+
+	Convey("it should reject network touching API calls", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn validateCommit [name entry header pkg sources] (get (hget header %EntryLink)) true)`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err.Error(), ShouldContainSubstring, "get is not allowed in strict validation")
+	})
+
+	Convey("it should allow deterministic API calls", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn validateCommit [name entry header pkg sources] (makeHash "evenNumbers" entry) true)`})
+		So(err, ShouldBeNil)
+		err = v.ValidateAction(a, &def, nil, nil)
+		So(err, ShouldBeNil)
+	})
+}